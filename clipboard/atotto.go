@@ -0,0 +1,22 @@
+package clipboard
+
+import (
+	"github.com/atotto/clipboard"
+)
+
+// Atotto talks to the clipboard of the machine the program is running on (e.g. using pbcopy, xclip, or the Windows
+// API), which means it won't reach the user's clipboard over SSH
+// It doesn't distinguish the primary selection from the regular clipboard.
+type Atotto struct{}
+
+func NewAtotto() *Atotto {
+	return &Atotto{}
+}
+
+func (atotto *Atotto) Read(selection Selection) (string, error) {
+	return clipboard.ReadAll()
+}
+
+func (atotto *Atotto) Write(selection Selection, text string) error {
+	return clipboard.WriteAll(text)
+}
@@ -0,0 +1,23 @@
+// Package clipboard provides the system clipboards that back Vim's "+" and "*" registers
+package clipboard
+
+// Selection is one of the clipboards that a system can have
+type Selection int
+
+const (
+	// The regular clipboard, used by Vim's "+" register
+	Selection_Clipboard Selection = iota
+
+	// The X11 primary selection, used by Vim's "*" register
+	// On systems without one, this is the same as the regular clipboard
+	Selection_Primary
+)
+
+// Clipboard is a backend for reading and writing the system clipboard
+type Clipboard interface {
+	// Read gets the current contents of the given clipboard
+	Read(selection Selection) (string, error)
+
+	// Write replaces the contents of the given clipboard
+	Write(selection Selection, text string) error
+}
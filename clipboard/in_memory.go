@@ -0,0 +1,21 @@
+package clipboard
+
+// InMemory is a clipboard that only lives inside the program, for tests and for environments without any clipboard
+type InMemory struct {
+	contents map[Selection]string
+}
+
+func NewInMemory() *InMemory {
+	return &InMemory{
+		contents: map[Selection]string{},
+	}
+}
+
+func (clipboard *InMemory) Read(selection Selection) (string, error) {
+	return clipboard.contents[selection], nil
+}
+
+func (clipboard *InMemory) Write(selection Selection, text string) error {
+	clipboard.contents[selection] = text
+	return nil
+}
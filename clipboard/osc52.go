@@ -0,0 +1,56 @@
+package clipboard
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+)
+
+// OSC52 writes to the clipboard of the user's terminal using the OSC 52 escape sequence, so that it works over SSH
+// Reading the terminal's clipboard would mean intercepting the terminal's reply on stdin (which Bubble Tea owns), so
+// reads instead return whatever was last written.
+type OSC52 struct {
+	output io.Writer
+
+	// The escaping needed to get the sequence through a terminal multiplexer, if any
+	mode osc52.Mode
+
+	lastWrittenText map[Selection]string
+}
+
+// NewOSC52 creates a clipboard that writes its escape sequences to the given output (which should be the terminal,
+// e.g. os.Stderr)
+// The sequences get wrapped for tmux or screen when the program looks to be running inside one.
+func NewOSC52(output io.Writer) *OSC52 {
+	mode := osc52.DefaultMode
+	if os.Getenv("TMUX") != "" {
+		mode = osc52.TmuxMode
+	} else if strings.HasPrefix(os.Getenv("TERM"), "screen") {
+		mode = osc52.ScreenMode
+	}
+
+	return &OSC52{
+		output:          output,
+		mode:            mode,
+		lastWrittenText: map[Selection]string{},
+	}
+}
+
+func (clipboard *OSC52) Read(selection Selection) (string, error) {
+	return clipboard.lastWrittenText[selection], nil
+}
+
+func (clipboard *OSC52) Write(selection Selection, text string) error {
+	sequence := osc52.New(text).Mode(clipboard.mode)
+	if selection == Selection_Primary {
+		sequence = sequence.Primary()
+	}
+
+	if _, err := sequence.WriteTo(clipboard.output); err != nil {
+		return err
+	}
+	clipboard.lastWrittenText[selection] = text
+	return nil
+}
@@ -0,0 +1,99 @@
+package textarea
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestChanges(t *testing.T) {
+	// Every edit starts from "a\nb\nc\nd\ne" with nothing changed and the cursor at the start of row 1
+	for _, test := range []struct {
+		name       string
+		edit       func(m *Model)
+		wantChange *Change
+	}{
+		{"moving the cursor", func(m *Model) { m.SetCursorPosition(Position{Row: 3, Col: 0}) }, nil},
+		{"setting a row", func(m *Model) { m.SetLine(2, []rune("x")) }, &Change{StartRow: 2, OldRows: []string{"c"}, NumNewRows: 1}},
+		{"typing", func(m *Model) { m.InsertString("xy") }, &Change{StartRow: 1, OldRows: []string{"b"}, NumNewRows: 1}},
+		{"typing line breaks", func(m *Model) { m.InsertString("x\ny") }, &Change{StartRow: 1, OldRows: []string{"b"}, NumNewRows: 2}},
+		{"typing over text", func(m *Model) { m.OverwriteRunes([]rune("xy")) }, &Change{StartRow: 1, OldRows: []string{"b"}, NumNewRows: 1}},
+		{"inserting rows", func(m *Model) { m.InsertLines(3, []string{"x", "y"}) }, &Change{StartRow: 3, OldRows: nil, NumNewRows: 2}},
+		{"deleting rows", func(m *Model) { m.DeleteLines(2, 3) }, &Change{StartRow: 2, OldRows: []string{"c", "d"}, NumNewRows: 0}},
+		{"joining rows", func(m *Model) { m.JoinLines(1, 2, true) }, &Change{StartRow: 1, OldRows: []string{"b", "c"}, NumNewRows: 1}},
+		{"moving rows", func(m *Model) { m.MoveLines(3, 3, 1) }, &Change{StartRow: 1, OldRows: []string{"b", "c", "d"}, NumNewRows: 3}},
+		{"replacing a range", func(m *Model) {
+			m.ReplaceRange(Position{Row: 1, Col: 1}, Position{Row: 3, Col: 0}, "")
+		}, &Change{StartRow: 1, OldRows: []string{"b", "c", "d"}, NumNewRows: 1}},
+		{"pressing backspace at the start of a row", func(m *Model) {
+			m.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+		}, &Change{StartRow: 0, OldRows: []string{"a", "b"}, NumNewRows: 1}},
+
+		// Separate edits make one change covering the rows from the first changed row to the last, which includes
+		// the unchanged rows between them
+		{"setting two rows", func(m *Model) {
+			m.SetLine(3, []rune("x"))
+			m.SetLine(1, []rune("y"))
+		}, &Change{StartRow: 1, OldRows: []string{"b", "c", "d"}, NumNewRows: 3}},
+		{"inserting rows and then changing the row after them", func(m *Model) {
+			m.InsertLines(1, []string{"x", "y"})
+			m.SetLine(3, []rune("z"))
+		}, &Change{StartRow: 1, OldRows: []string{"b"}, NumNewRows: 3}},
+		{"changing a row and then deleting it", func(m *Model) {
+			m.SetLine(2, []rune("x"))
+			m.DeleteLines(2, 2)
+		}, &Change{StartRow: 2, OldRows: []string{"c"}, NumNewRows: 0}},
+	} {
+		m := newTestModel("a\nb\nc\nd\ne")
+		m.SetChange(nil)
+		m.SetCursorPosition(Position{Row: 1, Col: 0})
+		test.edit(&m)
+
+		change := m.GetChange()
+		if !reflect.DeepEqual(change, test.wantChange) {
+			t.Errorf("got change %+v after %s, want %+v", change, test.name, test.wantChange)
+			continue
+		}
+		if change == nil {
+			continue
+		}
+
+		// Putting the old rows back in place of the new ones gives the value from before the edit
+		rows := strings.Split(m.GetValue(), "\n")
+		var oldRows []string
+		oldRows = append(oldRows, rows[:change.StartRow]...)
+		oldRows = append(oldRows, change.OldRows...)
+		oldRows = append(oldRows, rows[change.StartRow+change.NumNewRows:]...)
+		if oldValue := strings.Join(oldRows, "\n"); oldValue != "a\nb\nc\nd\ne" {
+			t.Errorf("got %q from undoing change %+v after %s", oldValue, change, test.name)
+		}
+	}
+}
+
+func TestSettingChanges(t *testing.T) {
+	m := newTestModel("a\nb\nc")
+	m.SetChange(nil)
+	m.SetLine(0, []rune("x"))
+	saved := m.GetChange()
+
+	// The saved change doesn't follow edits made after it was gotten
+	m.SetLine(2, []rune("y"))
+	if saved.NumNewRows != 1 || len(saved.OldRows) != 1 {
+		t.Errorf("got saved change %+v after another edit, want it to cover only the first row", saved)
+	}
+
+	m.SetLine(2, []rune("c"))
+	m.SetChange(saved)
+	m.SetLine(1, []rune("z"))
+	wantChange := &Change{StartRow: 0, OldRows: []string{"a", "b"}, NumNewRows: 2}
+	if change := m.GetChange(); !reflect.DeepEqual(change, wantChange) {
+		t.Errorf("got change %+v after editing on from the saved change, want %+v", change, wantChange)
+	}
+
+	m.SetChange(nil)
+	if change := m.GetChange(); change != nil {
+		t.Errorf("got change %+v after clearing it", change)
+	}
+}
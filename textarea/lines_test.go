@@ -0,0 +1,173 @@
+package textarea
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Makes a focused model holding the value, big enough that none of its rows get wrapped or scrolled out of view
+func newTestModel(value string) Model {
+	m := New()
+	m.Focus()
+	m.SetWidth(80)
+	m.SetHeight(10)
+	m.SetValue(value)
+	return m
+}
+
+func TestReplaceRange(t *testing.T) {
+	for _, test := range []struct {
+		value      string
+		start      Position
+		end        Position
+		text       string
+		wantValue  string
+		wantCursor Position
+	}{
+		{"abc\ndef", Position{Row: 0, Col: 1}, Position{Row: 0, Col: 2}, "X", "aXc\ndef", Position{Row: 0, Col: 1}},
+		{"abc\ndef", Position{Row: 0, Col: 1}, Position{Row: 1, Col: 1}, "", "aef", Position{Row: 0, Col: 1}},
+		{"abc\ndef", Position{Row: 0, Col: 3}, Position{Row: 0, Col: 3}, "\nxy", "abc\nxy\ndef", Position{Row: 0, Col: 3}},
+		{"abc\ndef", Position{Row: 1, Col: 0}, Position{Row: 1, Col: 0}, "new\n", "abc\nnew\ndef", Position{Row: 1, Col: 0}},
+		{"a\nb\nc", Position{Row: 1, Col: 0}, Position{Row: 2, Col: 0}, "", "a\nc", Position{Row: 1, Col: 0}},
+		{"éa\nb", Position{Row: 0, Col: 1}, Position{Row: 0, Col: 2}, "z", "éz\nb", Position{Row: 0, Col: 1}},
+
+		// The positions can come in either order, and get clamped to the buffer
+		{"abc\ndef", Position{Row: 1, Col: 1}, Position{Row: 0, Col: 1}, "", "aef", Position{Row: 0, Col: 1}},
+		{"abc\ndef", Position{Row: 0, Col: 1}, Position{Row: 5, Col: 0}, "", "a", Position{Row: 0, Col: 1}},
+		{"abc", Position{Row: 0, Col: 9}, Position{Row: 0, Col: 9}, "d", "abcd", Position{Row: 0, Col: 3}},
+	} {
+		m := newTestModel(test.value)
+		m.ReplaceRange(test.start, test.end, test.text)
+		if value, cursor := m.GetValue(), m.GetCursorPosition(); value != test.wantValue || cursor != test.wantCursor {
+			t.Errorf("got %q with the cursor at %v from replacing %v-%v in %q with %q, want %q with the cursor at %v", value, cursor, test.start, test.end, test.value, test.text, test.wantValue, test.wantCursor)
+		}
+	}
+}
+
+func TestTrackedLines(t *testing.T) {
+	// The lines "b" and "c" get tracked, and -1 means a line got deleted
+	for _, test := range []struct {
+		name     string
+		edit     func(m *Model)
+		wantRows [2]int
+	}{
+		{"inserting rows above", func(m *Model) { m.InsertLines(0, []string{"x", "y"}) }, [2]int{3, 4}},
+		{"inserting rows between", func(m *Model) { m.InsertLines(2, []string{"x"}) }, [2]int{1, 3}},
+		{"inserting rows below", func(m *Model) { m.InsertLines(4, []string{"x"}) }, [2]int{1, 2}},
+		{"deleting a tracked row", func(m *Model) { m.DeleteLines(1, 1) }, [2]int{-1, 1}},
+		{"deleting rows above", func(m *Model) { m.DeleteLines(0, 0) }, [2]int{0, 1}},
+		{"replacing whole rows", func(m *Model) {
+			m.ReplaceRange(Position{Row: 0, Col: 0}, Position{Row: 1, Col: 0}, "x\ny\n")
+		}, [2]int{2, 3}},
+		{"splitting a row above", func(m *Model) {
+			m.ReplaceRange(Position{Row: 0, Col: 1}, Position{Row: 0, Col: 1}, "\n")
+		}, [2]int{2, 3}},
+		{"joining the tracked rows", func(m *Model) { m.JoinLines(1, 2, false) }, [2]int{1, -1}},
+		{"typing line breaks above", func(m *Model) {
+			m.SetCursorPosition(Position{Row: 0, Col: 1})
+			m.InsertString("x\ny\nz")
+		}, [2]int{3, 4}},
+		{"changing a tracked row", func(m *Model) { m.SetLine(1, []rune("xyz")) }, [2]int{1, 2}},
+		{"setting the value", func(m *Model) { m.SetValue("a\nb\nc\nd") }, [2]int{-1, -1}},
+	} {
+		m := newTestModel("a\nb\nc\nd")
+		lines := [2]*TrackedLine{m.TrackLine(1), m.TrackLine(2)}
+		test.edit(&m)
+
+		var gotRows [2]int
+		for idx, line := range lines {
+			gotRows[idx] = line.GetRow()
+			if line.IsDeleted() {
+				gotRows[idx] = -1
+			}
+		}
+		if gotRows != test.wantRows {
+			t.Errorf("got rows %v after %s, want %v", gotRows, test.name, test.wantRows)
+		}
+	}
+}
+
+func TestUntrackedLinesStayPut(t *testing.T) {
+	m := newTestModel("a\nb")
+	line := m.TrackLine(1)
+	m.UntrackLine(line)
+	m.InsertLines(0, []string{"x"})
+	if row := line.GetRow(); row != 1 {
+		t.Errorf("got row %d for an untracked line after inserting a row above it, want 1", row)
+	}
+}
+
+func TestMoveLines(t *testing.T) {
+	for _, test := range []struct {
+		startRow  int
+		endRow    int
+		beforeRow int
+		wantValue string
+	}{
+		{3, 3, 0, "d\na\nb\nc\ne"},
+		{0, 1, 4, "c\nd\na\nb\ne"},
+		{0, 0, 5, "b\nc\nd\ne\na"},
+		{2, 1, 0, "b\nc\na\nd\ne"},
+
+		// Moving rows to among themselves, or to just after themselves, leaves them where they are
+		{1, 2, 2, "a\nb\nc\nd\ne"},
+		{1, 2, 3, "a\nb\nc\nd\ne"},
+	} {
+		m := newTestModel("a\nb\nc\nd\ne")
+		var lines []*TrackedLine
+		for row := 0; row < m.GetNumRows(); row++ {
+			lines = append(lines, m.TrackLine(row))
+		}
+
+		m.MoveLines(test.startRow, test.endRow, test.beforeRow)
+		if value := m.GetValue(); value != test.wantValue {
+			t.Errorf("got %q from moving rows %d-%d to before row %d, want %q", value, test.startRow, test.endRow, test.beforeRow, test.wantValue)
+			continue
+		}
+
+		// Every line's row follows its text
+		for row, line := range lines {
+			wantRow := strings.Index(strings.ReplaceAll(test.wantValue, "\n", ""), string(rune('a'+row)))
+			if line.IsDeleted() || line.GetRow() != wantRow {
+				t.Errorf("got row %d (deleted: %v) for line %d after moving rows %d-%d to before row %d, want %d", line.GetRow(), line.IsDeleted(), row, test.startRow, test.endRow, test.beforeRow, wantRow)
+			}
+		}
+	}
+}
+
+func TestFindMatch(t *testing.T) {
+	for _, test := range []struct {
+		value      string
+		pattern    string
+		from       Position
+		direction  CursorMovementDirection
+		shouldWrap bool
+		wantPos    Position
+		wantFound  bool
+	}{
+		{"foo bar\nbaz foo\né foo", "foo", Position{Row: 0, Col: 0}, CursorMovementDirection_Right, false, Position{Row: 1, Col: 4}, true},
+		{"foo bar\nbaz foo\né foo", "foo", Position{Row: 1, Col: 4}, CursorMovementDirection_Right, false, Position{Row: 2, Col: 2}, true},
+		{"foo bar\nbaz foo\né foo", "foo", Position{Row: 1, Col: 5}, CursorMovementDirection_Left, false, Position{Row: 1, Col: 4}, true},
+		{"foo bar\nbaz foo\né foo", "o", Position{Row: 0, Col: 2}, CursorMovementDirection_Left, false, Position{Row: 0, Col: 1}, true},
+		{"a\nb", "^", Position{Row: 0, Col: 0}, CursorMovementDirection_Right, false, Position{Row: 1, Col: 0}, true},
+
+		// Without wrapping, nothing past the end of the buffer gets found
+		{"foo bar\nbaz foo\né foo", "foo", Position{Row: 2, Col: 2}, CursorMovementDirection_Right, false, Position{Row: 2, Col: 2}, false},
+		{"foo bar\nbaz foo\né foo", "foo", Position{Row: 0, Col: 0}, CursorMovementDirection_Left, false, Position{Row: 0, Col: 0}, false},
+
+		// With wrapping, the search carries on from the other end
+		{"foo bar\nbaz foo\né foo", "foo", Position{Row: 2, Col: 2}, CursorMovementDirection_Right, true, Position{Row: 0, Col: 0}, true},
+		{"foo bar\nbaz foo\né foo", "foo", Position{Row: 0, Col: 0}, CursorMovementDirection_Left, true, Position{Row: 2, Col: 2}, true},
+
+		// Wrapping all the way around finds the match that the search started on
+		{"a foo b", "foo", Position{Row: 0, Col: 2}, CursorMovementDirection_Right, true, Position{Row: 0, Col: 2}, true},
+		{"a foo b", "x", Position{Row: 0, Col: 2}, CursorMovementDirection_Right, true, Position{Row: 0, Col: 2}, false},
+	} {
+		m := newTestModel(test.value)
+		pos, found := m.FindMatch(regexp.MustCompile(test.pattern), test.from, test.direction, test.shouldWrap)
+		if pos != test.wantPos || found != test.wantFound {
+			t.Errorf("got %v (found: %v) searching %q for %q from %v in direction %d (wrapping: %v), want %v (found: %v)", pos, found, test.value, test.pattern, test.from, test.direction, test.shouldWrap, test.wantPos, test.wantFound)
+		}
+	}
+}
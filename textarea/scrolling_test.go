@@ -0,0 +1,115 @@
+package textarea
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Gets the given number of short rows, numbered from 0
+func getNumberedLines(numLines int) string {
+	lines := make([]string, 0, numLines)
+	for idx := 0; idx < numLines; idx++ {
+		lines = append(lines, fmt.Sprintf("line %d", idx))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestScrolling(t *testing.T) {
+	// The test model shows 10 rows, and the cursor starts on the first one
+	for _, test := range []struct {
+		name          string
+		scrollOff     int
+		scroll        func(m *Model)
+		wantTopRow    int
+		wantBottomRow int
+		wantCursorRow int
+	}{
+		{"not scrolling", 0, func(m *Model) {}, 0, 9, 0},
+		{"setting the top row", 0, func(m *Model) { m.SetTopRow(5) }, 5, 14, 5},
+		{"setting the top row past the end", 0, func(m *Model) { m.SetTopRow(100) }, 29, 29, 29},
+		{"setting the top row before the start", 0, func(m *Model) { m.SetTopRow(-3) }, 0, 9, 0},
+		{"setting the bottom row", 0, func(m *Model) { m.SetBottomRow(20) }, 11, 20, 11},
+		{"setting the bottom row near the top", 0, func(m *Model) { m.SetBottomRow(3) }, 0, 9, 0},
+		{"scrolling down and back up", 0, func(m *Model) { m.ScrollBy(3); m.ScrollBy(-1) }, 2, 11, 3},
+		{"scrolling up past the start", 0, func(m *Model) { m.ScrollBy(-5) }, 0, 9, 0},
+
+		// The cursor keeps its distance from the edges of the view where it can
+		{"setting the top row with scrolloff", 2, func(m *Model) { m.SetTopRow(5) }, 5, 14, 7},
+		{"setting the bottom row with scrolloff", 2, func(m *Model) {
+			m.SetCursorPosition(Position{Row: 29, Col: 0})
+			m.SetBottomRow(20)
+		}, 11, 20, 18},
+	} {
+		m := newTestModel(getNumberedLines(30))
+		m.ScrollOff = test.scrollOff
+		m.SetCursorPosition(Position{Row: 0, Col: 0})
+		test.scroll(&m)
+
+		topRow, bottomRow, cursorRow := m.GetTopRow(), m.GetBottomRow(), m.GetRow()
+		if topRow != test.wantTopRow || bottomRow != test.wantBottomRow || cursorRow != test.wantCursorRow {
+			t.Errorf("got rows %d-%d in view with the cursor on row %d after %s, want rows %d-%d with the cursor on row %d", topRow, bottomRow, cursorRow, test.name, test.wantTopRow, test.wantBottomRow, test.wantCursorRow)
+		}
+	}
+}
+
+func TestScrollingWithWrappedRows(t *testing.T) {
+	// The long row takes up three lines of the view, which leaves room for two fewer rows after it
+	rows := strings.Split(getNumberedLines(30), "\n")
+	rows[5] = strings.Repeat("x", 200)
+	m := newTestModel(strings.Join(rows, "\n"))
+	m.SetCursorPosition(Position{Row: 0, Col: 0})
+	if topRow, bottomRow := m.GetTopRow(), m.GetBottomRow(); topRow != 0 || bottomRow != 7 {
+		t.Errorf("got rows %d-%d in view, want rows 0-7", topRow, bottomRow)
+	}
+
+	m.SetBottomRow(5)
+	if topRow, bottomRow := m.GetTopRow(), m.GetBottomRow(); topRow != 0 || bottomRow != 7 {
+		t.Errorf("got rows %d-%d in view after putting the long row at the bottom, want rows 0-7", topRow, bottomRow)
+	}
+	m.SetTopRow(5)
+	if topRow, bottomRow := m.GetTopRow(), m.GetBottomRow(); topRow != 5 || bottomRow != 12 {
+		t.Errorf("got rows %d-%d in view after putting the long row at the top, want rows 5-12", topRow, bottomRow)
+	}
+}
+
+func TestLineNumberWidth(t *testing.T) {
+	// Line numbers take up at least two columns (plus a space after them), and more once there are enough rows to need
+	// them
+	for _, test := range []struct {
+		numRows       int
+		wantTextWidth int
+		wantFirstLine string
+	}{
+		{1, 75, " 1 line 0"},
+		{99, 75, " 1 line 0"},
+		{100, 74, "  1 line 0"},
+		{1000, 73, "   1 line 0"},
+	} {
+		m := newTestModel(getNumberedLines(test.numRows))
+		m.SetCursorPosition(Position{Row: 0, Col: 0})
+		if width := m.GetWidth(); width != test.wantTextWidth {
+			t.Errorf("got text width %d with %d rows, want %d", width, test.numRows, test.wantTextWidth)
+		}
+		firstLine := strings.Split(m.View(), "\n")[0]
+		if !strings.HasPrefix(firstLine, m.Prompt+test.wantFirstLine) {
+			t.Errorf("got first line %q with %d rows, want it to start with %q", firstLine, test.numRows, m.Prompt+test.wantFirstLine)
+		}
+	}
+
+	// The width follows the number of rows as they change
+	m := newTestModel(getNumberedLines(99))
+	m.InsertLines(0, []string{"x"})
+	if width := m.GetWidth(); width != 74 {
+		t.Errorf("got text width %d after adding the 100th row, want 74", width)
+	}
+	m.DeleteLines(0, 0)
+	if width := m.GetWidth(); width != 75 {
+		t.Errorf("got text width %d after deleting the 100th row, want 75", width)
+	}
+
+	m.ShowLineNumbers = false
+	if width := m.GetWidth(); width != 78 {
+		t.Errorf("got text width %d without line numbers, want 78", width)
+	}
+}
@@ -2,10 +2,12 @@ package textarea
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
-	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/cursor"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/runeutil"
@@ -13,6 +15,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	rw "github.com/mattn/go-runewidth"
+	"github.com/mieubrisse/vim-bubble/clipboard"
 )
 
 type CursorMovementDirection int
@@ -40,32 +43,50 @@ const (
 	WordwiseMovementStopPosition_Terminus WordwiseMovementStopPosition = 1
 )
 
+// Classifies characters for wordwise movement, where a word is a run of characters of the same class and class 0 means
+// whitespace (which is never part of a word)
+type CharClassifier func(char rune) int
+
+// The classifier for whitespace-separated words, where every non-whitespace character is part of a word
+func ClassifyWhitespaceSeparated(char rune) int {
+	if unicode.IsSpace(char) {
+		return 0
+	}
+	return 1
+}
+
 // When moving the cursor by a given character, the position where the cursor will stop relative to the character
 type CharacterwiseMovementStopPosition int
 
 const (
 	// Stop on the character (corresponds to 'f' in Vim)
-	CharacterwiseMovementStopPosition_On = 0
+	CharacterwiseMovementStopPosition_On CharacterwiseMovementStopPosition = 0
 
 	// Stop just before the character (corresponds to 't' in Vim)
-	CharacterwiseMovementStopPosition_Before = 1
+	CharacterwiseMovementStopPosition_Before CharacterwiseMovementStopPosition = 1
 )
 
 const (
-	minHeight        = 1
-	minWidth         = 2
-	defaultHeight    = 6
-	defaultWidth     = 40
-	defaultCharLimit = 400
-	maxHeight        = 99
-	maxWidth         = 500
+	minHeight     = 1
+	minWidth      = 2
+	defaultHeight = 6
+	defaultWidth  = 40
+	maxWidth      = 500
+
+	// Line numbers are padded to at least this many digits, and get wider once there are more lines than fit
+	minLineNumberDigits = 2
 
 	lineNumberColorHex = "#5d5d5d"
 )
 
-// Paste is a tea.Cmd for pasting from the clipboard into the text input.
+// Paste is a tea.Cmd for pasting from the system clipboard into the text input.
 func Paste() tea.Msg {
-	str, err := clipboard.ReadAll()
+	return pasteFrom(clipboard.NewAtotto())
+}
+
+// pasteFrom reads the given clipboard into a paste message.
+func pasteFrom(board clipboard.Clipboard) tea.Msg {
+	str, err := board.Read(clipboard.Selection_Clipboard)
 	if err != nil {
 		return pasteErrMsg{err}
 	}
@@ -101,6 +122,10 @@ type Model struct {
 	// EndOfBufferCharacter is displayed at the end of the input.
 	EndOfBufferCharacter rune
 
+	// ScrollOff is the minimum number of lines kept visible above and below
+	// the cursor (except at the start and end of the input).
+	ScrollOff int
+
 	// KeyMap encodes the keybindings recognized by the widget.
 	KeyMap KeyMap
 
@@ -117,10 +142,6 @@ type Model struct {
 	// Cursor is the text area cursor.
 	Cursor cursor.Model
 
-	// CharLimit is the maximum number of characters this input element will
-	// accept. If 0 or less, there's no limit.
-	CharLimit int
-
 	// If promptFunc is set, it replaces Prompt as a generator for
 	// prompt strings at the beginning of each line.
 	promptFunc func(line int) string
@@ -128,8 +149,9 @@ type Model struct {
 	// promptWidth is the width of the prompt.
 	promptWidth int
 
-	// width is the maximum number of characters that can be displayed at once.
-	// If 0 or less this setting is ignored.
+	// width is the maximum number of characters that can be displayed at once,
+	// including the line numbers (see getTextWidth). If 0 or less this setting
+	// is ignored.
 	width int
 
 	// height is the maximum number of lines that can be displayed at once. It
@@ -154,15 +176,33 @@ type Model struct {
 	// vertically such that we can maintain the same navigating position.
 	lastCharOffset int
 
-	// lineNumberFormat is the format string used to display line numbers.
-	lineNumberFormat string
-
 	// viewport is the vertically-scrollable viewport of the multi-line text
 	// input.
 	viewport *viewport.Model
 
 	// rune sanitizer for input.
 	rsan runeutil.Sanitizer
+
+	// How the runes between selectionAnchor and the cursor are selected (if at all)
+	selectionMode SelectionMode
+
+	// The end of the selection that stays put while the cursor moves
+	selectionAnchor Position
+
+	// Where the Paste key binding reads from
+	clipboard clipboard.Clipboard
+
+	// Matches of this pattern get highlighted, if it's set
+	searchHighlight *regexp.Regexp
+
+	// The positions highlighted with the MatchParen style (e.g. a bracket and the bracket that matches it)
+	matchParenHighlights []Position
+
+	// Lines whose rows get kept up to date as rows are inserted and deleted
+	trackedLines []*TrackedLine
+
+	// The rows changed since the change was last cleared, or nil if none have been
+	change *Change
 }
 
 // New creates a new model with default settings.
@@ -174,23 +214,23 @@ func New() Model {
 	focusedStyle, blurredStyle := DefaultStyles()
 
 	m := Model{
-		CharLimit:            defaultCharLimit,
 		Prompt:               lipgloss.ThickBorder().Left + " ",
 		style:                &blurredStyle,
 		FocusedStyle:         focusedStyle,
 		BlurredStyle:         blurredStyle,
 		EndOfBufferCharacter: '~',
 		ShowLineNumbers:      true,
+		ScrollOff:            0,
 		Cursor:               cur,
 		KeyMap:               DefaultKeyMap,
 
-		value:            make([][]rune, minHeight, maxHeight),
-		focus:            false,
-		col:              0,
-		row:              0,
-		lineNumberFormat: "%2v ",
+		value: make([][]rune, minHeight),
+		focus: false,
+		col:   0,
+		row:   0,
 
-		viewport: &vp,
+		viewport:  &vp,
+		clipboard: clipboard.NewAtotto(),
 	}
 
 	m.SetHeight(defaultHeight)
@@ -221,6 +261,34 @@ func (m *Model) SetValue(s string) {
 	m.MoveCursorLeftOneRune()
 }
 
+// UpdateValue sets the value like SetValue, except that only the rows that changed get replaced, so that tracked
+// lines outside of the change keep following their text
+// The cursor goes to the start of the change.
+func (m *Model) UpdateValue(s string) {
+	var newRows [][]rune
+	for _, line := range strings.Split(s, "\n") {
+		newRows = append(newRows, []rune(line))
+	}
+
+	numCommonPrefixRows, numCommonSuffixRows := getCommonRowCounts(m.value, newRows)
+	if numCommonPrefixRows == len(m.value) && numCommonPrefixRows == len(newRows) {
+		return
+	}
+
+	cursorCol := 0
+	if numCommonPrefixRows < len(m.value) && numCommonPrefixRows < len(newRows) {
+		oldRow, newRow := m.value[numCommonPrefixRows], newRows[numCommonPrefixRows]
+		for cursorCol < len(oldRow) && cursorCol < len(newRow) && oldRow[cursorCol] == newRow[cursorCol] {
+			cursorCol++
+		}
+	}
+
+	m.replaceRows(numCommonPrefixRows, len(m.value)-numCommonSuffixRows-1, newRows[numCommonPrefixRows:len(newRows)-numCommonSuffixRows])
+	m.row = min(numCommonPrefixRows, len(m.value)-1)
+	m.SetCursorColumn(cursorCol)
+	m.repositionView()
+}
+
 // InsertString inserts a string at the cursor position.
 func (m *Model) InsertString(s string) {
 	m.insertRunesFromUserInput([]rune(s))
@@ -231,6 +299,35 @@ func (m *Model) InsertRune(r rune) {
 	m.insertRunesFromUserInput([]rune{r})
 }
 
+// OverwriteRunes types the runes over the ones at the cursor position rather than inserting them, extending the line
+// once its end is reached, and returns the runes that got overwritten
+// A newline breaks the line at the cursor without overwriting anything.
+func (m *Model) OverwriteRunes(runes []rune) []rune {
+	runes = m.san().Sanitize(runes)
+
+	var overwritten []rune
+	for _, char := range runes {
+		m.col = clamp(m.col, 0, len(m.value[m.row]))
+		switch {
+		case char == '\n':
+			m.splitLine(m.row, m.col)
+			continue
+		case m.col < len(m.value[m.row]):
+			m.recordChange(m.row, 1, 1)
+			overwritten = append(overwritten, m.value[m.row][m.col])
+			m.value[m.row][m.col] = char
+		default:
+			m.recordChange(m.row, 1, 1)
+			m.value[m.row] = append(m.value[m.row], char)
+		}
+		m.col++
+	}
+
+	m.SetCursorColumn(m.col)
+	m.repositionView()
+	return overwritten
+}
+
 // GetLength returns the number of characters currently in the text input.
 func (m *Model) GetLength() int {
 	var l int
@@ -246,9 +343,46 @@ func (m *Model) GetNumRows() int {
 	return len(m.value)
 }
 
+// GetNumRunes returns the number of runes in the text input, counting the
+// newlines between rows. Unlike GetLength, it doesn't build the text or
+// measure how wide it is, so it's cheap even for long text.
+func (m *Model) GetNumRunes() int {
+	numRunes := len(m.value) - 1
+	for _, row := range m.value {
+		numRunes += len(row)
+	}
+	return numRunes
+}
+
 // MoveCursorDown moves the cursor down by one line.
 // Returns whether or not the cursor blink should be reset.
 func (m *Model) MoveCursorDown(bindToLine bool) {
+	m.MoveCursorDownN(1, bindToLine)
+}
+
+// MoveCursorDownN moves the cursor down by the given number of lines, only repositioning the view once at the end
+func (m *Model) MoveCursorDownN(numLines int, bindToLine bool) {
+	for i := 0; i < numLines; i++ {
+		m.moveCursorDown(bindToLine)
+	}
+	m.repositionView()
+}
+
+// MoveCursorUp moves the cursor up by one line.
+// If bindToLine is set, the cursor will not move past the last character of the line
+func (m *Model) MoveCursorUp(bindToLine bool) {
+	m.MoveCursorUpN(1, bindToLine)
+}
+
+// MoveCursorUpN moves the cursor up by the given number of lines, only repositioning the view once at the end
+func (m *Model) MoveCursorUpN(numLines int, bindToLine bool) {
+	for i := 0; i < numLines; i++ {
+		m.moveCursorUp(bindToLine)
+	}
+	m.repositionView()
+}
+
+func (m *Model) moveCursorDown(bindToLine bool) {
 	li := m.GetLineInfo()
 	charOffset := max(m.lastCharOffset, li.CharOffset)
 	m.lastCharOffset = charOffset
@@ -284,13 +418,9 @@ func (m *Model) MoveCursorDown(bindToLine bool) {
 		offset += rw.RuneWidth(m.value[m.row][m.col])
 		m.col++
 	}
-
-	m.repositionView()
 }
 
-// MoveCursorUp moves the cursor up by one line.
-// If bindToLine is set, the cursor will not move past the last character of the line
-func (m *Model) MoveCursorUp(bindToLine bool) {
+func (m *Model) moveCursorUp(bindToLine bool) {
 	li := m.GetLineInfo()
 	charOffset := max(m.lastCharOffset, li.CharOffset)
 	m.lastCharOffset = charOffset
@@ -326,8 +456,6 @@ func (m *Model) MoveCursorUp(bindToLine bool) {
 		offset += rw.RuneWidth(m.value[m.row][m.col])
 		m.col++
 	}
-
-	m.repositionView()
 }
 
 // GetCursorColumn gets the column within the rune grid where the cursor is currently at
@@ -367,16 +495,23 @@ func (m Model) GetRow() int {
 func (m *Model) SetCursorRow(targetRow int) {
 	targetRow = clamp(targetRow, 0, len(m.value)-1)
 
-	adjustmentNeeded := targetRow - m.row
-	if adjustmentNeeded > 0 {
-		for i := 0; i < adjustmentNeeded; i++ {
-			m.MoveCursorDown(true)
+	// Moving by one line might only move to the next soft-wrapped portion of the same row, so we keep going until we
+	// actually reach the row
+	for m.row < targetRow {
+		previousPosition := m.GetCursorPosition()
+		m.moveCursorDown(true)
+		if m.GetCursorPosition() == previousPosition {
+			m.row++
 		}
-	} else {
-		for i := 0; i > adjustmentNeeded; i-- {
-			m.MoveCursorUp(true)
+	}
+	for m.row > targetRow {
+		previousPosition := m.GetCursorPosition()
+		m.moveCursorUp(true)
+		if m.GetCursorPosition() == previousPosition {
+			m.row--
 		}
 	}
+	m.col = clamp(m.col, 0, len(m.value[m.row]))
 
 	m.repositionView()
 }
@@ -389,6 +524,36 @@ func (m *Model) MoveCursorToLastRow() {
 	m.SetCursorRow(len(m.value) - 1)
 }
 
+// GetCursorPosition returns the cursor's location in the rune grid
+func (m Model) GetCursorPosition() Position {
+	return Position{Row: m.row, Col: m.col}
+}
+
+// SetCursorPosition moves the cursor to the given location, clamping it to the rune grid
+func (m *Model) SetCursorPosition(pos Position) {
+	m.row = clamp(pos.Row, 0, len(m.value)-1)
+	m.SetCursorColumn(pos.Col)
+	m.repositionView()
+}
+
+// MoveCursorToFirstNonBlank moves the cursor to the first non-whitespace character of the line (or the end of the
+// line, if the line is entirely whitespace)
+func (m *Model) MoveCursorToFirstNonBlank() {
+	m.SetCursorColumn(m.GetFirstNonBlankColumn(m.row))
+}
+
+// GetFirstNonBlankColumn gets the column of the first non-whitespace character in the given row
+// If the row is entirely whitespace, the column of the last character is returned
+func (m Model) GetFirstNonBlankColumn(row int) int {
+	line := m.value[row]
+	for col, char := range line {
+		if !unicode.IsSpace(char) {
+			return col
+		}
+	}
+	return max(0, len(line)-1)
+}
+
 // IsFocused returns the focus state on the model.
 func (m Model) IsFocused() bool {
 	return m.focus
@@ -412,7 +577,9 @@ func (m *Model) Blur() {
 
 // Reset sets the input to its default state with no input.
 func (m *Model) Reset() {
-	m.value = make([][]rune, minHeight, maxHeight)
+	m.recordChange(0, len(m.value), minHeight)
+	m.adjustTrackedLines(0, len(m.value), 0)
+	m.value = make([][]rune, minHeight)
 	m.col = 0
 	m.row = 0
 	m.viewport.GotoTop()
@@ -422,6 +589,7 @@ func (m *Model) Reset() {
 // DeleteBeforeCursor deletes all text before the cursor. Returns whether or
 // not the cursor blink should be reset.
 func (m *Model) DeleteBeforeCursor() {
+	m.recordChange(m.row, 1, 1)
 	m.value[m.row] = m.value[m.row][m.col:]
 	m.SetCursorColumn(0)
 }
@@ -430,6 +598,7 @@ func (m *Model) DeleteBeforeCursor() {
 // the cursor blink should be reset. If input is masked delete everything after
 // the cursor so as not to reveal word breaks in the masked input.
 func (m *Model) DeleteAfterCursor() {
+	m.recordChange(m.row, 1, 1)
 	m.value[m.row] = m.value[m.row][:m.col]
 	m.SetCursorColumn(len(m.value[m.row]) - 1)
 }
@@ -442,6 +611,7 @@ func (m *Model) DeleteOnCursor() []rune {
 		return make([]rune, 0)
 	}
 
+	m.recordChange(m.row, 1, 1)
 	deletedChar := []rune{currentRow[m.col]}
 	newRow := currentRow[:m.col]
 	if m.col < len(currentRow)-1 {
@@ -477,17 +647,45 @@ func (m *Model) MoveCursorLeftOneRune() {
 	}
 }
 
-func (m *Model) MoveCursorByWord(direction CursorMovementDirection, stopPosition WordwiseMovementStopPosition) {
-	m.doWordwiseMovement(direction, stopPosition)
+// MoveCursorByWord moves the cursor to the next word boundary in the given direction
+// Returns false if the cursor ran out of buffer before finding the boundary
+func (m *Model) MoveCursorByWord(direction CursorMovementDirection, stopPosition WordwiseMovementStopPosition) bool {
+	return m.MoveCursorByWordN(1, direction, stopPosition)
+}
+
+// MoveCursorByWordN moves the cursor by the given number of word boundaries, only repositioning the view once at the end
+// Returns false if the cursor ran out of buffer before finding the last boundary
+func (m *Model) MoveCursorByWordN(numWords int, direction CursorMovementDirection, stopPosition WordwiseMovementStopPosition) bool {
+	return m.MoveCursorByClassifiedWordN(numWords, direction, stopPosition, ClassifyWhitespaceSeparated)
+}
+
+// MoveCursorByClassifiedWordN is like MoveCursorByWordN, except that words also end wherever the class of character
+// changes (e.g. Vim's "foo.bar" being three words for "w" but one for "W")
+func (m *Model) MoveCursorByClassifiedWordN(numWords int, direction CursorMovementDirection, stopPosition WordwiseMovementStopPosition, classify CharClassifier) bool {
+	defer m.repositionView()
+	for i := 0; i < numWords; i++ {
+		if !m.doWordwiseMovement(direction, stopPosition, classify) {
+			return false
+		}
+	}
+	return true
 }
 
-// Moves the cursor in the direction of travel to the specified character
-func (m *Model) MoveCursorByCharacter(direction CursorMovementDirection, char rune) {
+// Moves the cursor in the direction of travel to the specified character on the cursor's line
+// Returns false (leaving the cursor where it was) if the character wasn't found
+func (m *Model) MoveCursorByCharacter(direction CursorMovementDirection, stopPosition CharacterwiseMovementStopPosition, char rune) bool {
+	return m.MoveCursorByCharacterN(1, direction, stopPosition, char)
+}
 
+// Moves the cursor in the direction of travel to the numOccurrences'th occurrence of the specified character on the
+// cursor's line
+// Returns false (leaving the cursor where it was) if there weren't enough occurrences
+func (m *Model) MoveCursorByCharacterN(numOccurrences int, direction CursorMovementDirection, stopPosition CharacterwiseMovementStopPosition, char rune) bool {
+	return m.doCharacterwiseMovement(char, direction, stopPosition, numOccurrences)
 }
 
 func (m *Model) InsertLineAbove() {
-	newValue := make([][]rune, 0, maxHeight)
+	newValue := make([][]rune, 0, len(m.value)+1)
 
 	preCursorLines := m.value[0:m.row]
 	newValue = append(newValue, preCursorLines...)
@@ -497,12 +695,14 @@ func (m *Model) InsertLineAbove() {
 	cursorLineAndAfter := m.value[m.row:]
 	newValue = append(newValue, cursorLineAndAfter...)
 
+	m.recordChange(m.row, 0, 1)
+	m.adjustTrackedLines(m.row, 0, 1)
 	m.row++
 	m.value = newValue
 }
 
 func (m *Model) InsertLineBelow() {
-	newValue := make([][]rune, 0, maxHeight)
+	newValue := make([][]rune, 0, len(m.value)+1)
 
 	cursorLineAndPrevious := m.value[0 : m.row+1]
 	newValue = append(newValue, cursorLineAndPrevious...)
@@ -512,12 +712,16 @@ func (m *Model) InsertLineBelow() {
 	postCursorLines := m.value[m.row+1:]
 	newValue = append(newValue, postCursorLines...)
 
+	m.recordChange(m.row+1, 0, 1)
+	m.adjustTrackedLines(m.row+1, 0, 1)
 	m.value = newValue
 }
 
 func (m *Model) DeleteLine() {
+	m.adjustTrackedLines(m.row, 1, 0)
 	if len(m.value) <= 1 {
-		m.value = make([][]rune, minHeight, maxHeight)
+		m.recordChange(0, len(m.value), minHeight)
+		m.value = make([][]rune, minHeight)
 		m.SetCursorColumn(0)
 		return
 	}
@@ -528,24 +732,370 @@ func (m *Model) DeleteLine() {
 		postCursorLines = m.value[m.row+1:]
 	}
 
-	newValue := make([][]rune, 0, maxHeight)
+	newValue := make([][]rune, 0, len(m.value)-1)
 	newValue = append(newValue, preCursorLines...)
 	newValue = append(newValue, postCursorLines...)
 
+	m.recordChange(m.row, 1, 0)
 	m.value = newValue
 
 	m.row = clamp(m.row, 0, len(m.value)-1)
 }
 
 func (m *Model) ClearLine() {
-	m.value[m.row] = make([]rune, 0, maxWidth)
+	m.recordChange(m.row, 1, 1)
+	m.value[m.row] = make([]rune, 0)
 	m.SetCursorColumn(0)
 }
 
+// SetSelection selects the text between the given anchor and the cursor, which will be highlighted using the
+// Selection style
+// The selection follows the cursor as it moves, until ClearSelection is called
+func (m *Model) SetSelection(mode SelectionMode, anchor Position) {
+	m.selectionMode = mode
+	m.selectionAnchor = anchor
+}
+
+// ClearSelection removes the selection
+func (m *Model) ClearSelection() {
+	m.selectionMode = SelectionMode_None
+}
+
+// GetSelection returns the selection mode and the anchor of the selection
+func (m Model) GetSelection() (SelectionMode, Position) {
+	return m.selectionMode, m.selectionAnchor
+}
+
+// TrackLine starts keeping the returned line's row up to date as rows get inserted and deleted, until UntrackLine is
+// called
+func (m *Model) TrackLine(row int) *TrackedLine {
+	line := &TrackedLine{row: row, isDeleted: false}
+	m.trackedLines = append(m.trackedLines, line)
+	return line
+}
+
+// UntrackLine stops keeping the line's row up to date
+func (m *Model) UntrackLine(line *TrackedLine) {
+	for idx, trackedLine := range m.trackedLines {
+		if trackedLine == line {
+			m.trackedLines = append(m.trackedLines[:idx], m.trackedLines[idx+1:]...)
+			return
+		}
+	}
+}
+
+// GetChange returns the rows that have changed since the change was last cleared with SetChange, or nil if none have,
+// so that undo histories can work out what changed without comparing the whole buffer
+func (m Model) GetChange() *Change {
+	if m.change == nil {
+		return nil
+	}
+	// The copy can't add rows to the textarea's own change, or the other way around
+	change := *m.change
+	change.OldRows = change.OldRows[:len(change.OldRows):len(change.OldRows)]
+	return &change
+}
+
+// SetChange replaces the record of which rows have changed, where nil clears it (e.g. once the change has been saved
+// in an undo history)
+// Setting a change from GetChange is only right if the buffer has been put back the way it was when it was gotten.
+func (m *Model) SetChange(change *Change) {
+	if change == nil {
+		m.change = nil
+		return
+	}
+	changeCopy := *change
+	changeCopy.OldRows = changeCopy.OldRows[:len(changeCopy.OldRows):len(changeCopy.OldRows)]
+	m.change = &changeCopy
+}
+
+// SetSearchHighlight sets the pattern whose matches get highlighted with the SearchMatch style, with nil meaning no
+// highlighting
+func (m *Model) SetSearchHighlight(pattern *regexp.Regexp) {
+	m.searchHighlight = pattern
+}
+
+// SetMatchParenHighlight sets the positions that get highlighted with the MatchParen style, with nil meaning no
+// highlighting
+func (m *Model) SetMatchParenHighlight(positions []Position) {
+	m.matchParenHighlights = positions
+}
+
+// FindMatch finds the start of the first match of the pattern after the given position (or before it, when searching
+// to the left), wrapping around the end of the buffer if shouldWrap is set
+// Matches can't span rows.
+func (m Model) FindMatch(pattern *regexp.Regexp, from Position, direction CursorMovementDirection, shouldWrap bool) (Position, bool) {
+	from = m.clampPosition(from)
+	numRows := len(m.value)
+
+	// Wrapping all the way around brings us back to the starting row, where only the matches on the other side of the
+	// starting column haven't been checked yet
+	for step := 0; step <= numRows; step++ {
+		row := from.Row + step*int(direction)
+		if !shouldWrap && (row < 0 || row >= numRows) {
+			break
+		}
+		row = (row + numRows) % numRows
+
+		matchStartCols := make([]int, 0)
+		for _, matchRange := range m.getMatchRanges(pattern, row, true) {
+			matchStartCols = append(matchStartCols, matchRange[0])
+		}
+		if direction == CursorMovementDirection_Left {
+			for left, right := 0, len(matchStartCols)-1; left < right; left, right = left+1, right-1 {
+				matchStartCols[left], matchStartCols[right] = matchStartCols[right], matchStartCols[left]
+			}
+		}
+
+		for _, col := range matchStartCols {
+			isPastStart := (col-from.Col)*int(direction) > 0
+			if (step == 0 && !isPastStart) || (step == numRows && isPastStart) {
+				continue
+			}
+			return Position{Row: row, Col: col}, true
+		}
+	}
+	return from, false
+}
+
+// SetClipboard sets the clipboard that the Paste key binding reads from
+func (m *Model) SetClipboard(board clipboard.Clipboard) {
+	m.clipboard = board
+}
+
+// JoinLines joins the rows between startRow and endRow (inclusive) into a single row, and returns the column
+// where the last join happened
+// If shouldNormalizeWhitespace is set, leading whitespace on the joined rows is removed and replaced with a single
+// space, as Vim's "J" does (no space is added after trailing whitespace, before a ')', or for an empty row)
+func (m *Model) JoinLines(startRow int, endRow int, shouldNormalizeWhitespace bool) int {
+	startRow = clamp(startRow, 0, len(m.value)-1)
+	endRow = clamp(endRow, 0, len(m.value)-1)
+
+	joined := m.GetLine(startRow)
+	lastJoinCol := len(joined)
+	for row := startRow + 1; row <= endRow; row++ {
+		nextLine := m.value[row]
+		lastJoinCol = len(joined)
+		if shouldNormalizeWhitespace {
+			firstNonBlankIdx := 0
+			for firstNonBlankIdx < len(nextLine) && unicode.IsSpace(nextLine[firstNonBlankIdx]) {
+				firstNonBlankIdx++
+			}
+			nextLine = nextLine[firstNonBlankIdx:]
+
+			endsInWhitespace := len(joined) > 0 && unicode.IsSpace(joined[len(joined)-1])
+			if len(joined) > 0 && !endsInWhitespace && len(nextLine) > 0 && nextLine[0] != ')' {
+				joined = append(joined, ' ')
+			} else if endsInWhitespace {
+				// Vim leaves the cursor on the trailing whitespace in this case
+				lastJoinCol--
+			}
+		}
+		joined = append(joined, nextLine...)
+	}
+
+	m.replaceRows(startRow, endRow, [][]rune{joined})
+	m.row = startRow
+	m.SetCursorColumn(lastJoinCol)
+	m.repositionView()
+	return lastJoinCol
+}
+
+// GetLine returns a copy of the runes in the given row
+func (m Model) GetLine(row int) []rune {
+	result := make([]rune, len(m.value[row]))
+	copy(result, m.value[row])
+	return result
+}
+
+// GetLineLength returns the number of runes in the given row
+func (m Model) GetLineLength(row int) int {
+	return len(m.value[row])
+}
+
+// SetLine replaces the contents of the given row, keeping the cursor within the row if it's on it
+func (m *Model) SetLine(row int, contents []rune) {
+	newRow := make([]rune, len(contents))
+	copy(newRow, contents)
+	m.recordChange(row, 1, 1)
+	m.value[row] = newRow
+
+	if m.row == row && m.col > len(newRow) {
+		m.SetCursorColumn(len(newRow))
+	}
+}
+
+// GetLines returns the contents of the rows between startRow and endRow, inclusive
+func (m Model) GetLines(startRow int, endRow int) []string {
+	startRow = clamp(startRow, 0, len(m.value)-1)
+	endRow = clamp(endRow, 0, len(m.value)-1)
+	if endRow < startRow {
+		startRow, endRow = endRow, startRow
+	}
+
+	result := make([]string, 0, endRow-startRow+1)
+	for _, line := range m.value[startRow : endRow+1] {
+		result = append(result, string(line))
+	}
+	return result
+}
+
+// DeleteLines removes the rows between startRow and endRow, inclusive
+// The buffer always keeps at least one (possibly empty) row
+func (m *Model) DeleteLines(startRow int, endRow int) {
+	startRow = clamp(startRow, 0, len(m.value)-1)
+	endRow = clamp(endRow, 0, len(m.value)-1)
+	if endRow < startRow {
+		startRow, endRow = endRow, startRow
+	}
+
+	m.replaceRows(startRow, endRow, nil)
+	if len(m.value) == 0 {
+		m.recordChange(0, 0, 1)
+		m.value = [][]rune{make([]rune, 0)}
+	}
+
+	m.row = clamp(m.row, 0, len(m.value)-1)
+	m.SetCursorColumn(m.col)
+}
+
+// InsertLines inserts the given lines before the given row
+// A row equal to the number of rows appends the lines to the end of the buffer
+func (m *Model) InsertLines(row int, lines []string) {
+	row = clamp(row, 0, len(m.value))
+
+	newRows := make([][]rune, 0, len(lines))
+	for _, line := range lines {
+		newRows = append(newRows, []rune(line))
+	}
+
+	// Inserting is just replacing an empty span of rows
+	m.replaceRows(row, row-1, newRows)
+}
+
+// MoveLines moves the rows between startRow and endRow, inclusive, to just before the given row (or to the end of the
+// buffer, if it's equal to the number of rows), taking the tracked lines on them along
+// Moving the rows to before a row among them, or the one just after them, leaves them where they are.
+func (m *Model) MoveLines(startRow int, endRow int, beforeRow int) {
+	startRow = clamp(startRow, 0, len(m.value)-1)
+	endRow = clamp(endRow, 0, len(m.value)-1)
+	if endRow < startRow {
+		startRow, endRow = endRow, startRow
+	}
+	beforeRow = clamp(beforeRow, 0, len(m.value))
+	if beforeRow >= startRow && beforeRow <= endRow+1 {
+		return
+	}
+
+	// Every row between where the rows were and where they're going changes
+	firstChangedRow, endChangedRow := min(startRow, beforeRow), max(endRow+1, beforeRow)
+	m.recordChange(firstChangedRow, endChangedRow-firstChangedRow, endChangedRow-firstChangedRow)
+
+	numMovedRows := endRow - startRow + 1
+	newValue := make([][]rune, 0, len(m.value))
+	if beforeRow < startRow {
+		newValue = append(newValue, m.value[:beforeRow]...)
+		newValue = append(newValue, m.value[startRow:endRow+1]...)
+		newValue = append(newValue, m.value[beforeRow:startRow]...)
+		newValue = append(newValue, m.value[endRow+1:]...)
+	} else {
+		newValue = append(newValue, m.value[:startRow]...)
+		newValue = append(newValue, m.value[endRow+1:beforeRow]...)
+		newValue = append(newValue, m.value[startRow:endRow+1]...)
+		newValue = append(newValue, m.value[beforeRow:]...)
+	}
+	m.value = newValue
+
+	for _, line := range m.trackedLines {
+		switch {
+		case line.isDeleted:
+		case line.row >= startRow && line.row <= endRow:
+			// The moved rows end up starting at beforeRow, less the rows that moved out from above it
+			if beforeRow < startRow {
+				line.row += beforeRow - startRow
+			} else {
+				line.row += beforeRow - endRow - 1
+			}
+		case beforeRow < startRow && line.row >= beforeRow && line.row < startRow:
+			line.row += numMovedRows
+		case beforeRow > endRow && line.row > endRow && line.row < beforeRow:
+			line.row -= numMovedRows
+		}
+	}
+}
+
+// GetTextInRange returns the text between start (inclusive) and end (exclusive)
+// Rows are joined with newlines, and a position at the end of a row refers to that row's newline
+func (m Model) GetTextInRange(start Position, end Position) string {
+	start, end = m.orderPositions(start, end)
+
+	if start.Row == end.Row {
+		return string(m.value[start.Row][start.Col:end.Col])
+	}
+
+	result := strings.Builder{}
+	result.WriteString(string(m.value[start.Row][start.Col:]))
+	for row := start.Row + 1; row < end.Row; row++ {
+		result.WriteRune('\n')
+		result.WriteString(string(m.value[row]))
+	}
+	result.WriteRune('\n')
+	result.WriteString(string(m.value[end.Row][:end.Col]))
+	return result.String()
+}
+
+// ReplaceRange replaces the text between start (inclusive) and end (exclusive) with the given text, which may
+// contain newlines
+// Unlike the user input functions, the text is inserted verbatim (without sanitization or character limits)
+// The cursor is left at start
+func (m *Model) ReplaceRange(start Position, end Position, text string) {
+	start, end = m.orderPositions(start, end)
+
+	// Whole rows being replaced by whole rows get replaced as rows, so that tracked lines keep following their text
+	// (e.g. the row after inserted rows shouldn't become the first inserted row)
+	if start.Col == 0 && end.Col == 0 && (text == "" || strings.HasSuffix(text, "\n")) {
+		var newRows [][]rune
+		if text != "" {
+			for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+				newRows = append(newRows, []rune(line))
+			}
+		}
+		m.replaceRows(start.Row, end.Row-1, newRows)
+		m.row = start.Row
+		m.SetCursorColumn(0)
+		return
+	}
+
+	head := m.value[start.Row][:start.Col]
+	tail := m.value[end.Row][end.Col:]
+
+	textLines := strings.Split(text, "\n")
+	newRows := make([][]rune, 0, len(textLines))
+	for _, line := range textLines {
+		newRows = append(newRows, []rune(line))
+	}
+
+	firstRow := make([]rune, 0, len(head)+len(newRows[0]))
+	firstRow = append(firstRow, head...)
+	newRows[0] = append(firstRow, newRows[0]...)
+	lastRowIdx := len(newRows) - 1
+	newRows[lastRowIdx] = append(newRows[lastRowIdx], tail...)
+
+	m.replaceRows(start.Row, end.Row, newRows)
+
+	m.row = start.Row
+	m.SetCursorColumn(start.Col)
+}
+
+// DeleteRange deletes the text between start (inclusive) and end (exclusive), leaving the cursor at start
+func (m *Model) DeleteRange(start Position, end Position) {
+	m.ReplaceRange(start, end, "")
+}
+
 // LineInfo returns the number of characters from the start of the
 // (soft-wrapped) line and the (soft-wrapped) line width.
 func (m Model) GetLineInfo() LineInfo {
-	grid := wrap(m.value[m.row], m.width)
+	grid := wrap(m.value[m.row], m.getTextWidth())
 
 	// Find out which line we are currently on. This can be determined by the
 	// m.col and counting the number of runes that we need to skip.
@@ -594,11 +1144,10 @@ func (m *Model) SetWidth(w int) {
 	m.viewport.Width = clamp(w, minWidth, maxWidth)
 
 	// Since the width of the textarea input is dependant on the width of the
-	// prompt and line numbers, we need to calculate it by subtracting.
+	// prompt and line numbers, we need to calculate it by subtracting. The
+	// line numbers get wider as lines get added, so they're subtracted when
+	// the text gets wrapped (see getTextWidth).
 	inputWidth := w
-	if m.ShowLineNumbers {
-		inputWidth -= rw.StringWidth(fmt.Sprintf(m.lineNumberFormat, 0))
-	}
 
 	// Account for base style borders and padding.
 	inputWidth -= m.style.Base.GetHorizontalFrameSize()
@@ -608,12 +1157,12 @@ func (m *Model) SetWidth(w int) {
 	}
 
 	inputWidth -= m.promptWidth
-	m.width = clamp(inputWidth, minWidth, maxWidth)
+	m.width = inputWidth
 }
 
 // GetWidth returns the width of the textarea.
 func (m Model) GetWidth() int {
-	return m.width
+	return m.getTextWidth()
 }
 
 // SetPromptFunc supersedes the Prompt field and sets a dynamic prompt
@@ -635,10 +1184,66 @@ func (m Model) GetHeight() int {
 
 // SetHeight sets the height of the textarea.
 func (m *Model) SetHeight(h int) {
-	m.height = clamp(h, minHeight, maxHeight)
+	m.height = max(h, minHeight)
 
 	// Leave room for the extra mode display line
-	m.viewport.Height = clamp(h, minHeight, maxHeight)
+	m.viewport.Height = max(h, minHeight)
+}
+
+// GetTopRow returns the first row that's visible (at least partly, if it's soft-wrapped)
+func (m Model) GetTopRow() int {
+	displayLine := 0
+	for row := range m.value {
+		displayLine += m.getRowHeight(row)
+		if displayLine > m.viewport.YOffset {
+			return row
+		}
+	}
+	return len(m.value) - 1
+}
+
+// GetBottomRow returns the last row that's entirely visible, or the top row if none are
+func (m Model) GetBottomRow() int {
+	topRow := m.GetTopRow()
+	lastVisibleLine := m.viewport.YOffset + m.viewport.Height - 1
+	displayLine := m.getRowDisplayLine(topRow)
+	for row := topRow; row < len(m.value); row++ {
+		displayLine += m.getRowHeight(row)
+		if displayLine-1 > lastVisibleLine {
+			return max(topRow, row-1)
+		}
+	}
+	return len(m.value) - 1
+}
+
+// SetTopRow scrolls the view so that the row is at the top, moving the cursor if it would otherwise be out of view
+// The view can be scrolled as far down as having the last row at the top.
+func (m *Model) SetTopRow(row int) {
+	row = clamp(row, 0, len(m.value)-1)
+	m.viewport.YOffset = m.getRowDisplayLine(row)
+	m.keepCursorInView()
+}
+
+// SetBottomRow scrolls the view so that the row is at the bottom (or as close as it can get, if it's near the top of
+// the input), moving the cursor if it would otherwise be out of view
+func (m *Model) SetBottomRow(row int) {
+	row = clamp(row, 0, len(m.value)-1)
+	m.viewport.YOffset = max(0, m.getRowDisplayLine(row)+m.getRowHeight(row)-m.viewport.Height)
+	m.keepCursorInView()
+}
+
+// SetMiddleRow scrolls the view so that the row is in the middle (or as close as it can get, if it's near the top of
+// the input), moving the cursor if it would otherwise be out of view
+func (m *Model) SetMiddleRow(row int) {
+	row = clamp(row, 0, len(m.value)-1)
+	m.viewport.YOffset = max(0, m.getRowDisplayLine(row)+m.getRowHeight(row)/2-m.viewport.Height/2)
+	m.keepCursorInView()
+}
+
+// ScrollBy scrolls the view down by the number of rows (or up, if it's negative), moving the cursor if it would
+// otherwise be out of view
+func (m *Model) ScrollBy(numRows int) {
+	m.SetTopRow(m.GetTopRow() + numRows)
 }
 
 // Update is the Bubble Tea update loop.
@@ -681,6 +1286,7 @@ func (m *Model) Update(msg tea.Msg) tea.Cmd {
 				break
 			}
 			if len(m.value[m.row]) > 0 {
+				m.recordChange(m.row, 1, 1)
 				m.value[m.row] = append(m.value[m.row][:max(0, m.col-1)], m.value[m.row][m.col:]...)
 				if m.col > 0 {
 					m.SetCursorColumn(m.col - 1)
@@ -688,6 +1294,7 @@ func (m *Model) Update(msg tea.Msg) tea.Cmd {
 			}
 		case key.Matches(msg, m.KeyMap.DeleteCharacterForward):
 			if len(m.value[m.row]) > 0 && m.col < len(m.value[m.row]) {
+				m.recordChange(m.row, 1, 1)
 				m.value[m.row] = append(m.value[m.row][:m.col], m.value[m.row][m.col+1:]...)
 			}
 			if m.col >= len(m.value[m.row]) {
@@ -708,9 +1315,6 @@ func (m *Model) Update(msg tea.Msg) tea.Cmd {
 			}
 			m.deleteWordRight()
 		case key.Matches(msg, m.KeyMap.InsertNewline):
-			if len(m.value) >= maxHeight {
-				return nil
-			}
 			m.col = clamp(m.col, 0, len(m.value[m.row]))
 			m.splitLine(m.row, m.col)
 		case key.Matches(msg, m.KeyMap.LineEnd):
@@ -728,7 +1332,10 @@ func (m *Model) Update(msg tea.Msg) tea.Cmd {
 		case key.Matches(msg, m.KeyMap.WordForward):
 			m.MoveCursorByWord(CursorMovementDirection_Right, WordwiseMovementStopPosition_Incidence)
 		case key.Matches(msg, m.KeyMap.Paste):
-			return Paste
+			board := m.clipboard
+			return func() tea.Msg {
+				return pasteFrom(board)
+			}
 		case key.Matches(msg, m.KeyMap.CharacterBackward):
 			m.MoveCursorLeftOneRune()
 		case key.Matches(msg, m.KeyMap.LinePrevious):
@@ -783,10 +1390,12 @@ func (m Model) View() string {
 	lineInfo := m.GetLineInfo()
 
 	var newLines int
+	textWidth := m.getTextWidth()
 
 	displayLine := 0
 	for l, line := range m.value {
-		wrappedLines := wrap(line, m.width)
+		wrappedLines := wrap(line, textWidth)
+		matchRanges := m.getMatchRanges(m.searchHighlight, l, false)
 
 		if m.row == l {
 			style = m.style.CursorLine
@@ -794,7 +1403,11 @@ func (m Model) View() string {
 			style = m.style.Text
 		}
 
+		// The column in the rune grid where the current wrapped line starts
+		wrappedLineStartCol := 0
 		for wl, wrappedLine := range wrappedLines {
+			wrappedLineLength := len(wrappedLine)
+
 			prompt := m.getPromptString(displayLine)
 			prompt = m.style.Prompt.Render(prompt)
 			s.WriteString(style.Render(prompt))
@@ -803,41 +1416,43 @@ func (m Model) View() string {
 			if m.ShowLineNumbers {
 				if wl == 0 {
 					if m.row == l {
-						s.WriteString(style.Render(m.style.CursorLineNumber.Render(fmt.Sprintf(m.lineNumberFormat, l+1))))
+						s.WriteString(style.Render(m.style.CursorLineNumber.Render(m.formatLineNumber(l + 1))))
 					} else {
-						s.WriteString(style.Render(m.style.LineNumber.Render(fmt.Sprintf(m.lineNumberFormat, l+1))))
+						s.WriteString(style.Render(m.style.LineNumber.Render(m.formatLineNumber(l + 1))))
 					}
 				} else {
-					s.WriteString(m.style.LineNumber.Render(style.Render("   ")))
+					s.WriteString(m.style.LineNumber.Render(style.Render(strings.Repeat(" ", m.getLineNumberWidth()))))
 				}
 			}
 
 			strwidth := rw.StringWidth(string(wrappedLine))
-			padding := m.width - strwidth
+			padding := textWidth - strwidth
 			// If the trailing space causes the line to be wider than the
 			// width, we should not draw it to the screen since it will result
 			// in an extra space at the end of the line which can look off when
 			// the cursor line is showing.
-			if strwidth > m.width {
+			if strwidth > textWidth {
 				// The character causing the line to be wider than the width is
 				// guaranteed to be a space since any other character would
 				// have been wrapped.
 				wrappedLine = []rune(strings.TrimSuffix(string(wrappedLine), " "))
-				padding -= m.width - strwidth
+				padding -= textWidth - strwidth
 			}
 			if m.row == l && lineInfo.RowOffset == wl {
-				s.WriteString(style.Render(string(wrappedLine[:lineInfo.ColumnOffset])))
-				if m.col >= len(line) && lineInfo.CharOffset >= m.width {
+				s.WriteString(m.renderRunes(l, wrappedLineStartCol, wrappedLine[:lineInfo.ColumnOffset], style, matchRanges))
+				if m.col >= len(line) && lineInfo.CharOffset >= textWidth {
 					m.Cursor.SetChar(" ")
 					s.WriteString(m.Cursor.View())
 				} else {
 					m.Cursor.SetChar(string(wrappedLine[lineInfo.ColumnOffset]))
 					s.WriteString(style.Render(m.Cursor.View()))
-					s.WriteString(style.Render(string(wrappedLine[lineInfo.ColumnOffset+1:])))
+					cursorCol := wrappedLineStartCol + lineInfo.ColumnOffset
+					s.WriteString(m.renderRunes(l, cursorCol+1, wrappedLine[lineInfo.ColumnOffset+1:], style, matchRanges))
 				}
 			} else {
-				s.WriteString(style.Render(string(wrappedLine)))
+				s.WriteString(m.renderRunes(l, wrappedLineStartCol, wrappedLine, style, matchRanges))
 			}
+			wrappedLineStartCol += wrappedLineLength
 			s.WriteString(style.Render(strings.Repeat(" ", max(0, padding))))
 			s.WriteRune('\n')
 			newLines++
@@ -853,7 +1468,7 @@ func (m Model) View() string {
 		displayLine++
 
 		if m.ShowLineNumbers {
-			lineNumber := m.style.EndOfBuffer.Render((fmt.Sprintf(m.lineNumberFormat, string(m.EndOfBufferCharacter))))
+			lineNumber := m.style.EndOfBuffer.Render(m.formatLineNumber(string(m.EndOfBufferCharacter)))
 			s.WriteString(lineNumber)
 		}
 		s.WriteRune('\n')
@@ -868,14 +1483,15 @@ func (m Model) View() string {
 //	Private Helper Functions
 //
 // ====================================================================================================
-func (m *Model) doWordwiseMovement(direction CursorMovementDirection, stopPosition WordwiseMovementStopPosition) {
+func (m *Model) doWordwiseMovement(direction CursorMovementDirection, stopPosition WordwiseMovementStopPosition, classify CharClassifier) bool {
 	// This function utilizes the insight that the textarea string can be thought of as a "tape" of words, joined by whitespace
+	// (or by changes in the class of character)
 	// With this insight, we can handle both (left,right) and (word_start,word_end) by simply sliding along the tape in
 	// the appropriate direction looking for the sequence we want
 
 	// If no lines, abort immediately
 	if len(m.value) == 0 {
-		return
+		return false
 	}
 
 	// Factor applied to index calculations to account for the desired direction of cursor travel
@@ -916,7 +1532,7 @@ func (m *Model) doWordwiseMovement(direction CursorMovementDirection, stopPositi
 			remainingRowsBeforeLimit := directionMultiplier * (limitRowIndex - nextRowIdx)
 			if remainingRowsBeforeLimit < 0 {
 				// We're at the end of the "tape"; nothing to do
-				return
+				return false
 			}
 
 			// We still have at least one more line, so let's use it (which means we're crossing a newline char which
@@ -936,12 +1552,12 @@ func (m *Model) doWordwiseMovement(direction CursorMovementDirection, stopPositi
 		// We still might have moved the cursor to an empty line, making the cursor location invalid!
 		// Vim will stop on these empty lines, so we try to as well
 		if len(m.value[m.row]) == 0 {
-			return
+			return true
 		}
 
 		cursorChar := m.value[m.row][m.col]
 
-		// Grab a comparison column which must be whitespace to stop the algorithm
+		// Grab a comparison column which must be whitespace (or a different class of character) to stop the algorithm
 		// The stopPosition multiplier means that "incident" will require whitespace to be *behind* the cursor in the direction
 		// of algorithm travel, whereas "terminus" will require whitespace to be *ahead* of the cursor
 		// in the direction of algorithm travel
@@ -970,40 +1586,177 @@ func (m *Model) doWordwiseMovement(direction CursorMovementDirection, stopPositi
 		}
 
 		// Evaluate if we reached our target
-		if !unicode.IsSpace(cursorChar) && unicode.IsSpace(candidateWhitespaceChar) {
-			return
+		cursorCharClass := classify(cursorChar)
+		if cursorCharClass != 0 && (unicode.IsSpace(candidateWhitespaceChar) || classify(candidateWhitespaceChar) != cursorCharClass) {
+			return true
 		}
 
 		// We're not done, so prep for next iteration
 	}
 }
 
-func (m *Model) doCharacterwiseMovement(targetChar rune, direction CursorMovementDirection, stopPosition CharacterwiseMovementStopPosition) {
+func (m *Model) doCharacterwiseMovement(targetChar rune, direction CursorMovementDirection, stopPosition CharacterwiseMovementStopPosition, numOccurrences int) bool {
 	directionMultiplier := int(direction)
 
-	stopPositionOffset := int(stopPosition)
+	// The stop position is relative to the direction of travel (e.g. "before" means "to the left" when moving right)
+	stopPositionOffset := int(stopPosition) * directionMultiplier
 
-	// To start the algo off, shove the proposed column one character in the direction of travel
-	// This prevents this being a noop if you're already on the character you're looking for
-	newColIdx := m.col + directionMultiplier
+	line := m.value[m.row]
 
-	// Based on the stop position, we need to examine different cells (either on the cursor, or ahead of it)
-	examinationColIdx := newColIdx + stopPositionOffset
+	// Each search starts one character past the last occurrence found (in the direction of travel), which prevents this
+	// being a noop if you're already on the character you're looking for
+	foundColIdx := m.col
+	for i := 0; i < numOccurrences; i++ {
+		examinationColIdx := foundColIdx + directionMultiplier
+		for examinationColIdx >= 0 && examinationColIdx < len(line) && line[examinationColIdx] != targetChar {
+			examinationColIdx += directionMultiplier
+		}
 
-	for {
-		// If our examintion column is out-of-bounds, abort; we haven't found anything
-		if examinationColIdx < 0 || examinationColIdx >= len(m.value[m.row]) {
-			return
+		// If our examination column is out-of-bounds, abort; we haven't found anything
+		if examinationColIdx < 0 || examinationColIdx >= len(line) {
+			return false
+		}
+		foundColIdx = examinationColIdx
+	}
+
+	m.SetCursorColumn(foundColIdx - stopPositionOffset)
+	return true
+}
+
+// renderRunes renders runes that start at the given location in the rune grid, highlighting any that are selected
+func (m Model) renderRunes(row int, startCol int, runes []rune, style lipgloss.Style, matchRanges [][2]int) string {
+	var result strings.Builder
+
+	// We render runs of runes that share the same highlighting together, to keep the number of escape sequences down
+	runStartIdx := 0
+	for idx := 1; idx <= len(runes); idx++ {
+		runHighlight := m.getHighlight(row, startCol+runStartIdx, matchRanges)
+		if idx < len(runes) && m.getHighlight(row, startCol+idx, matchRanges) == runHighlight {
+			continue
 		}
 
-		if m.value[m.row][examinationColIdx] == targetChar {
-			m.SetCursorColumn(newColIdx)
-			return
+		runStyle := style
+		switch runHighlight {
+		case highlight_Selection:
+			runStyle = m.style.Selection
+		case highlight_SearchMatch:
+			runStyle = m.style.SearchMatch
+		case highlight_MatchParen:
+			runStyle = m.style.MatchParen
+		}
+		result.WriteString(runStyle.Render(string(runes[runStartIdx:idx])))
+		runStartIdx = idx
+	}
+
+	return result.String()
+}
+
+// getHighlight returns how the given location in the rune grid should be highlighted, given the search matches on its
+// row
+func (m Model) getHighlight(row int, col int, matchRanges [][2]int) highlight {
+	if m.isSelected(row, col) {
+		return highlight_Selection
+	}
+	for _, pos := range m.matchParenHighlights {
+		if pos.Row == row && pos.Col == col {
+			return highlight_MatchParen
+		}
+	}
+	for _, matchRange := range matchRanges {
+		if col >= matchRange[0] && col < matchRange[1] {
+			return highlight_SearchMatch
+		}
+	}
+	return highlight_None
+}
+
+// MatchGroupName names the group that, if a pattern has one, is the part of
+// each of the pattern's matches that counts as the match. Go's regexps can't
+// look around a match, so this lets a pattern check the text around what it
+// matches (e.g. to only match whole words) without matching that text too.
+const MatchGroupName = "match"
+
+// FindAllMatchIndexes is like regexp's FindAllStringSubmatchIndex, except
+// that if the pattern has a MatchGroupName group, each match's first pair of
+// indexes is narrowed down to the group's, and the next match is looked for
+// right after the group rather than after the whole match.
+func FindAllMatchIndexes(pattern *regexp.Regexp, text string, n int) [][]int {
+	groupIdx := pattern.SubexpIndex(MatchGroupName)
+	if groupIdx < 0 {
+		return pattern.FindAllStringSubmatchIndex(text, n)
+	}
+
+	var result [][]int
+	for offset := 0; offset <= len(text) && (n < 0 || len(result) < n); {
+		match := pattern.FindStringSubmatchIndex(text[offset:])
+		if match == nil || match[2*groupIdx] < 0 {
+			break
+		}
+		for idx := range match {
+			if match[idx] >= 0 {
+				match[idx] += offset
+			}
+		}
+		match[0], match[1] = match[2*groupIdx], match[2*groupIdx+1]
+		result = append(result, match)
+
+		if match[1] > offset {
+			offset = match[1]
+		} else {
+			// An empty match would otherwise be found again and again
+			_, size := utf8.DecodeRuneInString(text[offset:])
+			offset += max(1, size)
+		}
+	}
+	return result
+}
+
+// getMatchRanges returns the start (inclusive) and end (exclusive) columns of every match of the pattern on the row
+// Empty matches are only included if shouldIncludeEmpty is set, since there's nothing to highlight for them.
+func (m Model) getMatchRanges(pattern *regexp.Regexp, row int, shouldIncludeEmpty bool) [][2]int {
+	if pattern == nil {
+		return nil
+	}
+
+	line := string(m.value[row])
+	var result [][2]int
+	for _, byteRange := range FindAllMatchIndexes(pattern, line, -1) {
+		if byteRange[0] == byteRange[1] && !shouldIncludeEmpty {
+			continue
 		}
+		result = append(result, [2]int{
+			utf8.RuneCountInString(line[:byteRange[0]]),
+			utf8.RuneCountInString(line[:byteRange[1]]),
+		})
+	}
+	return result
+}
 
-		newColIdx += directionMultiplier
-		examinationColIdx += directionMultiplier
+// isSelected returns whether the given location in the rune grid is part of the selection
+// A column at the end of the row refers to the row's newline
+func (m Model) isSelected(row int, col int) bool {
+	start, end := m.selectionAnchor, m.GetCursorPosition()
+	if end.IsBefore(start) {
+		start, end = end, start
 	}
+	if row < start.Row || row > end.Row {
+		return false
+	}
+
+	switch m.selectionMode {
+	case SelectionMode_Characterwise:
+		if col > len(m.value[row]) {
+			return false
+		}
+		return (row > start.Row || col >= start.Col) && (row < end.Row || col <= end.Col)
+	case SelectionMode_Linewise:
+		return col <= len(m.value[row])
+	case SelectionMode_Blockwise:
+		leftCol := min(m.selectionAnchor.Col, m.col)
+		rightCol := max(m.selectionAnchor.Col, m.col)
+		return col >= leftCol && col <= rightCol && col < len(m.value[row])
+	}
+	return false
 }
 
 // rsan initializes or retrieves the rune sanitizer.
@@ -1023,26 +1776,13 @@ func (m *Model) insertRunesFromUserInput(runes []rune) {
 	// whatnot.
 	runes = m.san().Sanitize(runes)
 
-	var availSpace int
-	if m.CharLimit > 0 {
-		availSpace = m.CharLimit - m.GetLength()
-		// If the char limit's been reached, cancel.
-		if availSpace <= 0 {
-			return
-		}
-		// If there's not enough space to paste the whole thing cut the pasted
-		// runes down so they'll fit.
-		if availSpace < len(runes) {
-			runes = runes[:len(runes)-availSpace]
-		}
-	}
-
-	// Split the input into lines.
+	// Split the input into lines. The lines' capacities are capped so
+	// that growing one of them can't overwrite the one after it.
 	var lines [][]rune
 	lstart := 0
 	for i := 0; i < len(runes); i++ {
 		if runes[i] == '\n' {
-			lines = append(lines, runes[lstart:i])
+			lines = append(lines, runes[lstart:i:i])
 			lstart = i + 1
 		}
 	}
@@ -1052,14 +1792,8 @@ func (m *Model) insertRunesFromUserInput(runes []rune) {
 		lines = append(lines, runes[lstart:])
 	}
 
-	// Obey the maximum height limit.
-	if len(m.value)+len(lines)-1 > maxHeight {
-		allowedHeight := max(0, maxHeight-len(m.value)+1)
-		lines = lines[:allowedHeight]
-	}
-
 	if len(lines) == 0 {
-		// Nothing left to insert.
+		// Nothing to insert.
 		return
 	}
 
@@ -1069,10 +1803,12 @@ func (m *Model) insertRunesFromUserInput(runes []rune) {
 	copy(tail, m.value[m.row][m.col:])
 
 	// Paste the first line at the current cursor position.
+	m.recordChange(m.row, 1, len(lines))
 	m.value[m.row] = append(m.value[m.row][:m.col], lines[0]...)
 	m.col += len(lines[0])
 
 	if numExtraLines := len(lines) - 1; numExtraLines > 0 {
+		m.adjustTrackedLines(m.row, 1, 1+numExtraLines)
 		// Add the new lines.
 		// We try to reuse the slice if there's already space.
 		var newGrid [][]rune
@@ -1135,6 +1871,7 @@ func (m *Model) deleteWordLeft() {
 		}
 	}
 
+	m.recordChange(m.row, 1, 1)
 	if oldCol > len(m.value[m.row]) {
 		m.value[m.row] = m.value[m.row][:m.col]
 	} else {
@@ -1167,6 +1904,7 @@ func (m *Model) deleteWordRight() {
 		}
 	}
 
+	m.recordChange(m.row, 1, 1)
 	if m.col > len(m.value[m.row]) {
 		m.value[m.row] = m.value[m.row][:oldCol]
 	} else {
@@ -1233,18 +1971,90 @@ func (m *Model) doWordRight(fn func(charIdx int, pos int)) {
 }
 
 // repositionView repositions the view of the viewport based on the defined
-// scrolling behavior.
+// scrolling behavior, keeping ScrollOff lines around the cursor where it can.
 func (m *Model) repositionView() {
-	min := m.viewport.YOffset
-	max := min + m.viewport.Height - 1
+	cursorLine := m.cursorLineNumber()
+	scrollOff := clamp(m.ScrollOff, 0, (m.viewport.Height-1)/2)
 
-	if row := m.cursorLineNumber(); row < min {
-		m.viewport.LineUp(min - row)
-	} else if row > max {
-		m.viewport.LineDown(row - max)
+	if cursorLine-scrollOff < m.viewport.YOffset {
+		m.viewport.YOffset = max(0, cursorLine-scrollOff)
+		return
+	}
+
+	lastVisibleLine := m.viewport.YOffset + m.viewport.Height - 1
+	if cursorLine+scrollOff > lastVisibleLine {
+		// The lines kept below the cursor don't go past the end of the input, which would leave the cursor further
+		// up the view than it needs to be
+		numLines := m.getRowDisplayLine(len(m.value)-1) + m.getRowHeight(len(m.value)-1)
+		maxYOffset := max(m.viewport.YOffset, numLines-m.viewport.Height)
+		m.viewport.YOffset = max(cursorLine-m.viewport.Height+1, min(cursorLine+scrollOff-m.viewport.Height+1, maxYOffset))
 	}
 }
 
+// keepCursorInView moves the cursor to the nearest row that's in view after
+// scrolling, keeping ScrollOff rows around it where it can.
+func (m *Model) keepCursorInView() {
+	topRow, bottomRow := m.GetTopRow(), m.GetBottomRow()
+	scrollOff := clamp(m.ScrollOff, 0, (bottomRow-topRow)/2)
+
+	minRow, maxRow := topRow, bottomRow
+	if topRow > 0 {
+		minRow += scrollOff
+	}
+	if bottomRow < len(m.value)-1 {
+		maxRow -= scrollOff
+	}
+
+	if row := clamp(m.row, minRow, max(minRow, maxRow)); row != m.row {
+		m.row = row
+		m.col = min(m.col, len(m.value[row]))
+	}
+}
+
+// getRowHeight returns the number of lines that the row takes up once it's
+// soft-wrapped.
+func (m Model) getRowHeight(row int) int {
+	// Runes are at most two columns wide, so short enough rows fit on one line
+	// (along with the space that wrap adds at the end) without wrapping them,
+	// which saves a lot of time in long buffers
+	if 2*len(m.value[row]) < m.getTextWidth() {
+		return 1
+	}
+	return len(wrap(m.value[row], m.getTextWidth()))
+}
+
+// getTextWidth returns the number of columns that the text gets wrapped to,
+// which is what's left of the width once the line numbers are shown.
+func (m Model) getTextWidth() int {
+	width := m.width
+	if m.ShowLineNumbers {
+		width -= rw.StringWidth(m.formatLineNumber(0))
+	}
+	return clamp(width, minWidth, maxWidth)
+}
+
+// getLineNumberWidth returns the number of columns that line numbers are
+// padded to, which is enough for the last line's number.
+func (m Model) getLineNumberWidth() int {
+	return max(minLineNumberDigits, len(strconv.Itoa(len(m.value))))
+}
+
+// formatLineNumber pads the line number (or the character shown in place of
+// one) to the width of the line numbers, with a space after it.
+func (m Model) formatLineNumber(lineNumber any) string {
+	return fmt.Sprintf("%*v ", m.getLineNumberWidth(), lineNumber)
+}
+
+// getRowDisplayLine returns the line of the view (ignoring scrolling) that the
+// row starts on.
+func (m Model) getRowDisplayLine(row int) int {
+	line := 0
+	for i := 0; i < row; i++ {
+		line += m.getRowHeight(i)
+	}
+	return line
+}
+
 // moveToBegin moves the cursor to the beginning of the input.
 func (m *Model) moveToBegin() {
 	m.row = 0
@@ -1274,7 +2084,7 @@ func (m Model) getPromptString(displayLine int) (prompt string) {
 func (m Model) placeholderView() string {
 	var (
 		s     strings.Builder
-		p     = rw.Truncate(m.Placeholder, m.width, "...")
+		p     = rw.Truncate(m.Placeholder, m.getTextWidth(), "...")
 		style = m.style.Placeholder.Inline(true)
 	)
 
@@ -1283,7 +2093,7 @@ func (m Model) placeholderView() string {
 	s.WriteString(m.style.CursorLine.Render(prompt))
 
 	if m.ShowLineNumbers {
-		s.WriteString(m.style.CursorLine.Render(m.style.CursorLineNumber.Render((fmt.Sprintf(m.lineNumberFormat, 1)))))
+		s.WriteString(m.style.CursorLine.Render(m.style.CursorLineNumber.Render(m.formatLineNumber(1))))
 	}
 
 	m.Cursor.TextStyle = m.style.Placeholder
@@ -1291,7 +2101,7 @@ func (m Model) placeholderView() string {
 	s.WriteString(m.style.CursorLine.Render(m.Cursor.View()))
 
 	// The rest of the placeholder text
-	s.WriteString(m.style.CursorLine.Render(style.Render(p[1:] + strings.Repeat(" ", max(0, m.width-rw.StringWidth(p))))))
+	s.WriteString(m.style.CursorLine.Render(style.Render(p[1:] + strings.Repeat(" ", max(0, m.getTextWidth()-rw.StringWidth(p))))))
 
 	// The rest of the new lines
 	for i := 1; i < m.height; i++ {
@@ -1301,7 +2111,7 @@ func (m Model) placeholderView() string {
 		s.WriteString(prompt)
 
 		if m.ShowLineNumbers {
-			eob := m.style.EndOfBuffer.Render((fmt.Sprintf(m.lineNumberFormat, string(m.EndOfBufferCharacter))))
+			eob := m.style.EndOfBuffer.Render(m.formatLineNumber(string(m.EndOfBufferCharacter)))
 			s.WriteString(eob)
 		}
 	}
@@ -1322,7 +2132,7 @@ func (m Model) cursorLineNumber() int {
 	for i := 0; i < m.row; i++ {
 		// Calculate the number of lines that the current line will be split
 		// into.
-		line += len(wrap(m.value[i], m.width))
+		line += m.getRowHeight(i)
 	}
 	line += m.GetLineInfo().RowOffset
 	return line
@@ -1335,6 +2145,8 @@ func (m *Model) mergeLineBelow(row int) {
 	}
 
 	// To perform a merge, we will need to combine the two lines and then
+	m.recordChange(row, 2, 1)
+	m.adjustTrackedLines(row, 2, 1)
 	m.value[row] = append(m.value[row], m.value[row+1]...)
 
 	// Shift all lines up by one
@@ -1358,6 +2170,8 @@ func (m *Model) mergeLineAbove(row int) {
 	m.row = m.row - 1
 
 	// To perform a merge, we will need to combine the two lines and then
+	m.recordChange(row-1, 2, 1)
+	m.adjustTrackedLines(row-1, 2, 1)
 	m.value[row-1] = append(m.value[row-1], m.value[row]...)
 
 	// Shift all lines up by one
@@ -1371,6 +2185,101 @@ func (m *Model) mergeLineAbove(row int) {
 	}
 }
 
+// replaceRows replaces the rows between startRow and endRow (inclusive) with the given rows
+// An endRow of startRow-1 means "replace nothing" (i.e. insert before startRow)
+func (m *Model) replaceRows(startRow int, endRow int, newRows [][]rune) {
+	m.recordChange(startRow, endRow-startRow+1, len(newRows))
+	m.adjustTrackedLines(startRow, endRow-startRow+1, len(newRows))
+	newValue := make([][]rune, 0, len(m.value)-(endRow-startRow+1)+len(newRows))
+	newValue = append(newValue, m.value[:startRow]...)
+	newValue = append(newValue, newRows...)
+	newValue = append(newValue, m.value[endRow+1:]...)
+	m.value = newValue
+}
+
+// getCommonRowCounts returns how many rows at the start and at the end of
+// the two values are the same, without the two counts overlapping.
+func getCommonRowCounts(oldRows [][]rune, newRows [][]rune) (int, int) {
+	numPrefixRows := 0
+	for numPrefixRows < len(oldRows) && numPrefixRows < len(newRows) && string(oldRows[numPrefixRows]) == string(newRows[numPrefixRows]) {
+		numPrefixRows++
+	}
+
+	numSuffixRows := 0
+	for numPrefixRows+numSuffixRows < len(oldRows) && numPrefixRows+numSuffixRows < len(newRows) {
+		if string(oldRows[len(oldRows)-1-numSuffixRows]) != string(newRows[len(newRows)-1-numSuffixRows]) {
+			break
+		}
+		numSuffixRows++
+	}
+	return numPrefixRows, numSuffixRows
+}
+
+// adjustTrackedLines updates the tracked lines for numOldRows rows starting at startRow being replaced by numNewRows
+// rows
+// Lines among the replaced rows keep their rows if there are enough new rows, and are otherwise deleted (e.g. when
+// lines get joined, the first line is kept and the rest are deleted).
+func (m *Model) adjustTrackedLines(startRow int, numOldRows int, numNewRows int) {
+	for _, line := range m.trackedLines {
+		switch {
+		case line.isDeleted || line.row < startRow:
+		case line.row < startRow+numOldRows:
+			if line.row-startRow >= numNewRows {
+				line.isDeleted = true
+			}
+		default:
+			line.row += numNewRows - numOldRows
+		}
+	}
+}
+
+// recordChange adds numOldRows rows starting at startRow being replaced by numNewRows rows to the change, which has to
+// happen before the rows get replaced so that their old contents can be saved
+// Only the rows that weren't already part of the change get saved, so small edits only cost as much as the rows they
+// touch.
+func (m *Model) recordChange(startRow int, numOldRows int, numNewRows int) {
+	if m.change == nil {
+		m.change = &Change{StartRow: startRow, OldRows: nil, NumNewRows: 0}
+	}
+	change := m.change
+
+	// Any rows between the change so far and these rows haven't changed, so they're still what they used to be
+	if startRow < change.StartRow {
+		oldRows := make([]string, 0, change.StartRow-startRow+len(change.OldRows))
+		for _, row := range m.value[startRow:change.StartRow] {
+			oldRows = append(oldRows, string(row))
+		}
+		change.OldRows = append(oldRows, change.OldRows...)
+		change.NumNewRows += change.StartRow - startRow
+		change.StartRow = startRow
+	}
+	for changeEndRow := change.StartRow + change.NumNewRows; changeEndRow < startRow+numOldRows; changeEndRow++ {
+		change.OldRows = append(change.OldRows, string(m.value[changeEndRow]))
+		change.NumNewRows++
+	}
+
+	change.NumNewRows += numNewRows - numOldRows
+}
+
+// clampPosition coerces the given position into the rune grid
+func (m Model) clampPosition(pos Position) Position {
+	if pos.Row >= len(m.value) {
+		lastRow := len(m.value) - 1
+		return Position{Row: lastRow, Col: len(m.value[lastRow])}
+	}
+	row := max(0, pos.Row)
+	return Position{Row: row, Col: clamp(pos.Col, 0, len(m.value[row]))}
+}
+
+// orderPositions clamps both positions to the rune grid and returns them in buffer order
+func (m Model) orderPositions(first Position, second Position) (Position, Position) {
+	first, second = m.clampPosition(first), m.clampPosition(second)
+	if second.IsBefore(first) {
+		return second, first
+	}
+	return first, second
+}
+
 func (m *Model) splitLine(row, col int) {
 	// To perform a split, take the current line and keep the content before
 	// the cursor, take the content after the cursor and make it the content of
@@ -1379,6 +2288,8 @@ func (m *Model) splitLine(row, col int) {
 	tail := make([]rune, len(tailSrc))
 	copy(tail, tailSrc)
 
+	m.recordChange(row, 1, 2)
+	m.adjustTrackedLines(row, 1, 2)
 	m.value = append(m.value[:row+1], m.value[row:]...)
 
 	m.value[row] = head
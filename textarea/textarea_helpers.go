@@ -76,6 +76,78 @@ type LineInfo struct {
 	CharOffset int
 }
 
+// Position is a location in the textarea's rune grid
+// A column equal to the length of the row refers to the (virtual) newline at the end of that row
+type Position struct {
+	Row int
+	Col int
+}
+
+// IsBefore returns true if this position comes strictly before the other in the buffer
+func (p Position) IsBefore(other Position) bool {
+	if p.Row != other.Row {
+		return p.Row < other.Row
+	}
+	return p.Col < other.Col
+}
+
+// TrackedLine is a line of the textarea whose row follows it as rows are inserted and deleted around it
+type TrackedLine struct {
+	row int
+
+	// Set once the line has been deleted, after which its row no longer changes
+	isDeleted bool
+}
+
+// GetRow returns the line's current row
+func (l TrackedLine) GetRow() int {
+	return l.row
+}
+
+// IsDeleted returns true if the line has been deleted since it started being tracked
+func (l TrackedLine) IsDeleted() bool {
+	return l.isDeleted
+}
+
+// Change records which rows of the textarea have changed since it was last cleared (see GetChange), as the rows
+// starting at StartRow that used to be OldRows and are now NumNewRows rows
+// Rows outside of the change haven't changed, though rows inside it might have been changed back.
+type Change struct {
+	StartRow int
+
+	// The contents the changed rows had before they were changed
+	OldRows []string
+
+	NumNewRows int
+}
+
+// SelectionMode determines which runes between the selection anchor and the cursor are selected
+type SelectionMode int
+
+const (
+	// Nothing is selected
+	SelectionMode_None SelectionMode = iota
+
+	// Every rune from the anchor to the cursor (inclusive) is selected
+	SelectionMode_Characterwise
+
+	// Every row from the anchor's row to the cursor's row is selected in its entirety
+	SelectionMode_Linewise
+
+	// The rectangle with the anchor and the cursor at its corners is selected
+	SelectionMode_Blockwise
+)
+
+// highlight is the kind of highlighting applied to a rune when rendering
+type highlight int
+
+const (
+	highlight_None highlight = iota
+	highlight_SearchMatch
+	highlight_MatchParen
+	highlight_Selection
+)
+
 // Style that will be applied to the text area.
 //
 // Style can be applied to focused and unfocused states to change the styles
@@ -89,8 +161,11 @@ type Style struct {
 	CursorLineNumber lipgloss.Style
 	EndOfBuffer      lipgloss.Style
 	LineNumber       lipgloss.Style
+	MatchParen       lipgloss.Style
 	Placeholder      lipgloss.Style
 	Prompt           lipgloss.Style
+	SearchMatch      lipgloss.Style
+	Selection        lipgloss.Style
 	Text             lipgloss.Style
 }
 
@@ -103,8 +178,11 @@ func DefaultStyles() (Style, Style) {
 		CursorLineNumber: lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "240"}),
 		EndOfBuffer:      lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "254", Dark: "0"}),
 		LineNumber:       lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "249", Dark: "7"}),
+		MatchParen:       lipgloss.NewStyle().Background(lipgloss.Color("6")),
 		Placeholder:      lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
 		Prompt:           lipgloss.NewStyle().Foreground(lipgloss.Color("7")),
+		SearchMatch:      lipgloss.NewStyle().Background(lipgloss.Color("#defa51")).Foreground(lipgloss.Color("#000000")),
+		Selection:        lipgloss.NewStyle().Reverse(true),
 		Text:             lipgloss.NewStyle(),
 	}
 	blurred := Style{
@@ -113,8 +191,11 @@ func DefaultStyles() (Style, Style) {
 		CursorLineNumber: lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "249", Dark: "7"}),
 		EndOfBuffer:      lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "254", Dark: "0"}),
 		LineNumber:       lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "249", Dark: "7"}),
+		MatchParen:       lipgloss.NewStyle().Background(lipgloss.Color("6")),
 		Placeholder:      lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
 		Prompt:           lipgloss.NewStyle().Foreground(lipgloss.Color("7")),
+		SearchMatch:      lipgloss.NewStyle().Background(lipgloss.Color("#defa51")).Foreground(lipgloss.Color("#000000")),
+		Selection:        lipgloss.NewStyle().Reverse(true),
 		Text:             lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "245", Dark: "7"}),
 	}
 
@@ -0,0 +1,270 @@
+package vim
+
+import (
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// A line of input typed in the status bar area (e.g. a search pattern), which takes over the keyboard until it's
+// submitted or cancelled
+type commandLine struct {
+	// The character shown before the text (e.g. "/")
+	prompt rune
+
+	text []rune
+
+	// Where the cursor was when the command line opened, so that previews of what the command will do can be undone
+	originalCursor textarea.Position
+
+	// Called whenever the text changes
+	onChange func(model *Model, text string)
+
+	// Called when the user hits enter, after the command line closes
+	onSubmit func(model *Model, text string)
+
+	// Called when the user backs out of the command line, after it closes
+	onCancel func(model *Model)
+
+	// Gets the possible completions of the text when tab is pressed, if the command line supports completion
+	complete func(model *Model, text string) []string
+
+	// The completions being cycled through with tab, which get thrown away when anything else is typed
+	completions   []string
+	completionIdx int
+
+	// The entry of the history being shown, where the length of the history means the text the user typed
+	historyIdx int
+
+	// What the user typed before browsing the history, which only history entries starting with it get shown for
+	typedText []rune
+
+	// Set after ctrl+r, while waiting for the name of the register to insert
+	isAwaitingRegister bool
+}
+
+// How many lines each command line history remembers
+const maxCommandLineHistoryLength = 50
+
+func (model *Model) openCommandLine(line commandLine) {
+	line.originalCursor = model.area.GetCursorPosition()
+	line.historyIdx = len(model.commandLineHistories[getHistoryKind(line.prompt)])
+	model.commandLine = &line
+}
+
+func (model *Model) handleCommandLineKey(msg tea.KeyMsg) {
+	line := model.commandLine
+	if line.isAwaitingRegister {
+		line.isAwaitingRegister = false
+		model.insertRegisterIntoCommandLine(msg)
+		return
+	}
+
+	keyName := msg.String()
+	if keyName != "tab" && keyName != "shift+tab" {
+		line.completions = nil
+	}
+	if keyName != "up" && keyName != "down" {
+		line.historyIdx = len(model.commandLineHistories[getHistoryKind(line.prompt)])
+	}
+
+	switch keyName {
+	case "esc", "ctrl+c":
+		model.closeCommandLine(false)
+		return
+	case "enter":
+		model.closeCommandLine(true)
+		return
+	case "backspace":
+		// Like Vim, backspacing over an empty command line backs out of it
+		if len(line.text) == 0 {
+			model.closeCommandLine(false)
+			return
+		}
+		line.text = line.text[:len(line.text)-1]
+	case "ctrl+u":
+		line.text = nil
+	case "ctrl+w":
+		line.text = deleteWordBackward(line.text)
+	case "ctrl+r":
+		line.isAwaitingRegister = true
+		return
+	case "tab", "shift+tab":
+		if !model.cycleCompletions(keyName == "tab") {
+			return
+		}
+	case "up", "down":
+		if !model.browseHistory(keyName == "up") {
+			return
+		}
+	default:
+		if msg.Type != tea.KeyRunes && msg.Type != tea.KeySpace {
+			return
+		}
+		line.text = append(line.text, msg.Runes...)
+	}
+
+	if line.onChange != nil {
+		line.onChange(model, string(line.text))
+	}
+}
+
+// Closes the command line, submitting it if requested (and otherwise cancelling it)
+func (model *Model) closeCommandLine(shouldSubmit bool) {
+	line := model.commandLine
+	model.commandLine = nil
+	model.area.SetCursorPosition(line.originalCursor)
+
+	if shouldSubmit {
+		model.addToCommandLineHistory(line.prompt, string(line.text))
+		if line.onSubmit != nil {
+			line.onSubmit(model, string(line.text))
+		}
+		return
+	}
+	if line.onCancel != nil {
+		line.onCancel(model)
+	}
+}
+
+func (model Model) renderCommandLine() string {
+	line := model.commandLine
+	text := string(line.prompt) + string(line.text)
+
+	// Keep the end of the text (where the typing is happening) in view, leaving room for the cursor
+	runes := []rune(text)
+	if len(runes) > model.width-1 {
+		runes = runes[len(runes)-max(0, model.width-1):]
+	}
+
+	cursorStr := lipgloss.NewStyle().Reverse(true).Render(" ")
+	numPads := max(0, model.width-len(runes)-1)
+	return string(runes) + cursorStr + strings.Repeat(" ", numPads)
+}
+
+// Searches share one history, and ex commands have another
+func getHistoryKind(prompt rune) rune {
+	if prompt == '?' {
+		return '/'
+	}
+	return prompt
+}
+
+// Adds the line to the end of its history, removing any earlier copy of it
+func (model *Model) addToCommandLineHistory(prompt rune, text string) {
+	if text == "" {
+		return
+	}
+
+	historyKind := getHistoryKind(prompt)
+	var history []string
+	for _, entry := range model.commandLineHistories[historyKind] {
+		if entry != text {
+			history = append(history, entry)
+		}
+	}
+	history = append(history, text)
+	model.commandLineHistories[historyKind] = history[max(0, len(history)-maxCommandLineHistoryLength):]
+}
+
+// Replaces the text with the previous (or next) history entry that starts with what the user typed, returning false
+// if there isn't one
+func (model *Model) browseHistory(isBackward bool) bool {
+	line := model.commandLine
+	history := model.commandLineHistories[getHistoryKind(line.prompt)]
+	if line.historyIdx == len(history) {
+		line.typedText = line.text
+	}
+
+	idx := line.historyIdx
+	for {
+		if isBackward {
+			idx--
+		} else {
+			idx++
+		}
+		if idx < 0 || idx > len(history) {
+			return false
+		}
+		if idx == len(history) {
+			line.text = line.typedText
+			break
+		}
+		if strings.HasPrefix(history[idx], string(line.typedText)) {
+			line.text = []rune(history[idx])
+			break
+		}
+	}
+	line.historyIdx = idx
+	return true
+}
+
+// Replaces the text with the next (or previous) completion, returning false if there aren't any
+func (model *Model) cycleCompletions(isForward bool) bool {
+	line := model.commandLine
+	if line.complete == nil {
+		return false
+	}
+
+	if line.completions == nil {
+		line.completions = line.complete(model, string(line.text))
+		if len(line.completions) == 0 {
+			line.completions = nil
+			return false
+		}
+		line.completionIdx = 0
+		if !isForward {
+			line.completionIdx = len(line.completions) - 1
+		}
+	} else if isForward {
+		line.completionIdx = (line.completionIdx + 1) % len(line.completions)
+	} else {
+		line.completionIdx = (line.completionIdx + len(line.completions) - 1) % len(line.completions)
+	}
+
+	line.text = []rune(line.completions[line.completionIdx])
+	return true
+}
+
+// Inserts the contents of the register named by the key typed after ctrl+r, or the keyword under the cursor for
+// ctrl+w (like Vim)
+func (model *Model) insertRegisterIntoCommandLine(msg tea.KeyMsg) {
+	line := model.commandLine
+
+	var text string
+	if msg.String() == "ctrl+w" {
+		// The cursor's position when the command line opened is what the user sees, even if a search preview moved it
+		previewCursor := model.area.GetCursorPosition()
+		model.area.SetCursorPosition(line.originalCursor)
+		text, _ = model.getKeywordUnderCursor()
+		model.area.SetCursorPosition(previewCursor)
+	} else {
+		name, isRune := keyToRune(msg.String())
+		if !isRune || !isValidRegisterName(name) {
+			return
+		}
+
+		// Newlines can't be typed into the command line, so linewise text loses its trailing one
+		text = strings.TrimSuffix(model.getRegister(name).text, "\n")
+	}
+
+	line.text = append(line.text, []rune(text)...)
+	if line.onChange != nil {
+		line.onChange(model, string(line.text))
+	}
+}
+
+// Deletes the word before the end of the text, along with any whitespace after it
+func deleteWordBackward(text []rune) []rune {
+	end := len(text)
+	for end > 0 && unicode.IsSpace(text[end-1]) {
+		end--
+	}
+	for end > 0 && !unicode.IsSpace(text[end-1]) {
+		end--
+	}
+	return text[:end]
+}
@@ -0,0 +1,600 @@
+package vim
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// CommandInvocation describes a run of an ex command (e.g. ":1,5submit! now")
+type CommandInvocation struct {
+	// The full name of the command that was run
+	Name string
+
+	// Whether the command name was directly followed by "!"
+	Bang bool
+
+	// Everything after the command name (and the "!"), without leading whitespace
+	Args string
+
+	// The first and last rows of the range the command was given (0-indexed and inclusive), which are both the cursor's
+	// row if no range was given
+	StartRow int
+	EndRow   int
+
+	// Whether a range was given
+	HasRange bool
+}
+
+// CommandHandler runs an ex command that the host application registered with RegisterCommand
+// The returned tea.Cmd (which may be nil) gets returned from Update.
+type CommandHandler func(model *Model, invocation CommandInvocation) tea.Cmd
+
+type exCommand struct {
+	name string
+
+	// The shortest prefix of the name that runs the command (e.g. 1 for "delete", so that ":d" works)
+	minAbbreviationLength int
+
+	// Whether the command can be given a range (giving one to a command that can't take one is an error)
+	acceptsRange bool
+
+	run func(model *Model, invocation CommandInvocation) (tea.Cmd, error)
+}
+
+// The commands that come built in, in the order that abbreviations get matched against them
+// This is a function rather than a variable because the commands refer back to the rest of the model's machinery
+// (e.g. ":normal" handles keys), which would make a variable's initialization refer to itself.
+func getBuiltinExCommands() []exCommand {
+	return []exCommand{
+		{name: "substitute", minAbbreviationLength: 1, acceptsRange: true, run: runSubstitute},
+		{name: "&", minAbbreviationLength: 1, acceptsRange: true, run: runRepeatSubstitute},
+		{name: "delete", minAbbreviationLength: 1, acceptsRange: true, run: runDelete},
+		{name: "move", minAbbreviationLength: 1, acceptsRange: true, run: runMove},
+		{name: "t", minAbbreviationLength: 1, acceptsRange: true, run: runCopy},
+		{name: "copy", minAbbreviationLength: 2, acceptsRange: true, run: runCopy},
+		{name: "global", minAbbreviationLength: 1, acceptsRange: true, run: runGlobal},
+		{name: "vglobal", minAbbreviationLength: 1, acceptsRange: true, run: runGlobal},
+		{name: "normal", minAbbreviationLength: 4, acceptsRange: true, run: runNormal},
+		{name: "set", minAbbreviationLength: 2, acceptsRange: false, run: runSet},
+		{name: "nohlsearch", minAbbreviationLength: 3, acceptsRange: false, run: runNoHighlightSearch},
+		{name: "earlier", minAbbreviationLength: 2, acceptsRange: false, run: runEarlierOrLater},
+		{name: "later", minAbbreviationLength: 3, acceptsRange: false, run: runEarlierOrLater},
+		{name: "undolist", minAbbreviationLength: 5, acceptsRange: false, run: runUndoList},
+	}
+}
+
+// RegisterCommand adds an ex command that runs the given handler (e.g. registering "submit" makes ":submit" work)
+// Registered commands can't be abbreviated, and registering a command with the name of an existing one replaces it.
+func (model *Model) RegisterCommand(name string, handler CommandHandler) {
+	command := exCommand{
+		name:                  name,
+		minAbbreviationLength: len(name),
+		acceptsRange:          true,
+		run: func(model *Model, invocation CommandInvocation) (tea.Cmd, error) {
+			return handler(model, invocation), nil
+		},
+	}
+
+	for idx, existingCommand := range model.exCommands {
+		if existingCommand.name == name {
+			model.exCommands[idx] = command
+			return
+		}
+	}
+	model.exCommands = append(model.exCommands, command)
+}
+
+// Opens the command line for typing an ex command, starting with the given text (e.g. a range)
+func (model *Model) openExCommandLine(initialText string) {
+	model.openCommandLine(commandLine{
+		prompt:   ':',
+		text:     []rune(initialText),
+		complete: completeExCommandLine,
+		onSubmit: func(model *Model, text string) {
+			if strings.TrimSpace(text) == "" {
+				return
+			}
+			model.lastCommandLine = text
+			model.executeExCommandLine(text)
+		},
+	})
+}
+
+// Runs the ex command line, showing any error in the status bar
+// Everything the command does gets undone as one step.
+func (model *Model) executeExCommandLine(text string) {
+	model.exCommandDepth++
+	cmd, err := model.runExCommandLine(text)
+	model.exCommandDepth--
+
+	if cmd != nil {
+		model.queuedCmds = append(model.queuedCmds, cmd)
+	}
+	if err != nil {
+		model.statusMessage = err.Error()
+		model.abortReplay()
+	}
+
+	model.bindCursorToLine()
+	model.CheckpointHistory()
+}
+
+// Parses and runs an ex command line (e.g. "1,5d"), which is allowed to start with ":"
+func (model *Model) runExCommandLine(text string) (tea.Cmd, error) {
+	text = strings.TrimLeft(text, " \t:")
+
+	rng, rest, err := model.parseExRange(text)
+	if err != nil {
+		return nil, err
+	}
+	rest = strings.TrimLeft(rest, " \t")
+
+	// A range on its own goes to the last line of the range
+	if rest == "" {
+		if rng.hasRange {
+			model.recordJump(model.area.GetCursorPosition())
+			moveToFirstNonBlankOfRow(model, rng.endRow)
+		}
+		return nil, nil
+	}
+
+	name, isBang, args := splitExCommand(rest)
+	command, found := model.findExCommand(name)
+	if !found {
+		return nil, fmt.Errorf("E492: Not an editor command: %s", text)
+	}
+	if rng.hasRange && !command.acceptsRange {
+		return nil, fmt.Errorf("E481: No range allowed")
+	}
+
+	return command.run(model, CommandInvocation{
+		Name:     command.name,
+		Bang:     isBang,
+		Args:     args,
+		StartRow: rng.startRow,
+		EndRow:   rng.endRow,
+		HasRange: rng.hasRange,
+	})
+}
+
+// Finds the command with the given name, or failing that, the first command that the name is an abbreviation of
+func (model *Model) findExCommand(name string) (exCommand, bool) {
+	for _, command := range model.exCommands {
+		if command.name == name {
+			return command, true
+		}
+	}
+	for _, command := range model.exCommands {
+		if len(name) >= command.minAbbreviationLength && strings.HasPrefix(command.name, name) {
+			return command, true
+		}
+	}
+	return exCommand{}, false
+}
+
+// Splits the text after the range into the command name, whether it has a "!", and its arguments
+// Names are either a run of letters, or a single symbol (e.g. "&").
+func splitExCommand(text string) (string, bool, string) {
+	runes := []rune(text)
+	nameLength := 0
+	for nameLength < len(runes) && unicode.IsLetter(runes[nameLength]) {
+		nameLength++
+	}
+	if nameLength == 0 {
+		nameLength = 1
+	}
+
+	name := string(runes[:nameLength])
+	rest := runes[nameLength:]
+	isBang := len(rest) > 0 && rest[0] == '!'
+	if isBang {
+		rest = rest[1:]
+	}
+	return name, isBang, strings.TrimLeft(string(rest), " \t")
+}
+
+// ====================================================================================================
+//
+//	Ranges
+//
+// ====================================================================================================
+// The lines an ex command applies to
+type exRange struct {
+	startRow int
+	endRow   int
+
+	// If false, the range is the cursor's row
+	hasRange bool
+}
+
+// Parses the range at the start of the command line (e.g. "1,5", ".,$", "'<,'>", "%" or "/foo/+1"), returning the
+// text after it
+func (model *Model) parseExRange(text string) (exRange, string, error) {
+	cursorRow := model.area.GetRow()
+	lastRow := model.area.GetNumRows() - 1
+	runes := []rune(text)
+
+	if len(runes) > 0 && runes[0] == '%' {
+		return exRange{startRow: 0, endRow: lastRow, hasRange: true}, string(runes[1:]), nil
+	}
+
+	// A missing address next to a separator means the current line (e.g. ",5" is ".,5"), and ";" makes the address
+	// before it the current line for the addresses after it
+	var rows []int
+	idx := 0
+	baseRow := cursorRow
+	for {
+		row, nextIdx, found, err := model.parseExAddress(runes, idx, baseRow)
+		if err != nil {
+			return exRange{}, "", err
+		}
+		idx = nextIdx
+
+		isSeparator := idx < len(runes) && (runes[idx] == ',' || runes[idx] == ';')
+		if !found && !isSeparator && len(rows) == 0 {
+			break
+		}
+		rows = append(rows, row)
+		if !isSeparator {
+			break
+		}
+		if runes[idx] == ';' {
+			baseRow = row
+		}
+		idx++
+	}
+
+	if len(rows) == 0 {
+		return exRange{startRow: cursorRow, endRow: cursorRow, hasRange: false}, text, nil
+	}
+
+	// Line 0 is allowed (and means the first line), since some commands use it for "before the first line", but lines
+	// before it aren't
+	startRow, endRow := rows[max(0, len(rows)-2)], rows[len(rows)-1]
+	if startRow < -1 || endRow < -1 || startRow > lastRow || endRow > lastRow {
+		return exRange{}, "", fmt.Errorf("E16: Invalid range")
+	}
+	startRow, endRow = max(0, startRow), max(0, endRow)
+	if startRow > endRow {
+		startRow, endRow = endRow, startRow
+	}
+	return exRange{startRow: startRow, endRow: endRow, hasRange: true}, string(runes[idx:]), nil
+}
+
+// Parses a single line address starting at the given index, returning its row (which is -1 for line 0), the index
+// after it, and whether there was an address
+// Addresses are a line number, ".", "$", a mark, or a pattern to search for, followed by any number of offsets (e.g.
+// "+2" or "-").
+func (model *Model) parseExAddress(runes []rune, idx int, currentRow int) (int, int, bool, error) {
+	row := currentRow
+	found := false
+
+	if idx < len(runes) {
+		switch char := runes[idx]; {
+		case unicode.IsDigit(char):
+			number, numDigits := parseNumber(runes[idx:])
+			row = number - 1
+			idx += numDigits
+			found = true
+		case char == '.':
+			idx++
+			found = true
+		case char == '$':
+			row = model.area.GetNumRows() - 1
+			idx++
+			found = true
+		case char == '\'':
+			if idx+1 >= len(runes) {
+				return 0, 0, false, fmt.Errorf("E20: Mark not set")
+			}
+			markRow, isSet := model.getMarkRow(runes[idx+1])
+			if !isSet {
+				return 0, 0, false, fmt.Errorf("E20: Mark not set")
+			}
+			row = markRow
+			idx += 2
+			found = true
+		case char == '/' || char == '?':
+			pattern, patternLength := splitAtDelimiter(runes[idx+1:], char)
+			idx += 1 + patternLength
+			if idx < len(runes) && runes[idx] == char {
+				idx++
+			}
+
+			matchRow, err := model.findMatchingRow(pattern, currentRow, searchDirections[string(char)])
+			if err != nil {
+				return 0, 0, false, err
+			}
+			row = matchRow
+			found = true
+		}
+	}
+
+	for idx < len(runes) && (runes[idx] == '+' || runes[idx] == '-') {
+		sign := 1
+		if runes[idx] == '-' {
+			sign = -1
+		}
+		idx++
+
+		offset := 1
+		if number, numDigits := parseNumber(runes[idx:]); numDigits > 0 {
+			offset = number
+			idx += numDigits
+		}
+		row += sign * offset
+		found = true
+	}
+
+	return row, idx, found, nil
+}
+
+// Finds the next line (or previous line, when searching to the left) containing a match for the pattern, not counting
+// the given row unless the search wraps all the way around to it
+// An empty pattern means the last search pattern, and the pattern becomes the last search pattern, like in Vim.
+func (model *Model) findMatchingRow(pattern string, fromRow int, direction textarea.CursorMovementDirection) (int, error) {
+	if pattern == "" {
+		pattern = model.lastSearch.pattern
+	}
+	if pattern == "" {
+		return 0, fmt.Errorf("E35: No previous regular expression")
+	}
+	model.lastSearch.pattern = pattern
+
+	from := textarea.Position{Row: fromRow, Col: model.area.GetLineLength(fromRow)}
+	if direction == textarea.CursorMovementDirection_Left {
+		from.Col = 0
+	}
+	matchPos, found := model.area.FindMatch(model.compileSearchPattern(pattern), from, direction, model.Settings.WrapScan)
+	if !found {
+		return 0, fmt.Errorf("E486: Pattern not found: %s", pattern)
+	}
+	return matchPos.Row, nil
+}
+
+// Parses the digits at the start of the runes, returning the number and how many digits there were
+func parseNumber(runes []rune) (int, int) {
+	numDigits := 0
+	for numDigits < len(runes) && runes[numDigits] >= '0' && runes[numDigits] <= '9' {
+		numDigits++
+	}
+	number, _ := strconv.Atoi(string(runes[:numDigits]))
+	return number, numDigits
+}
+
+// Gets the text up to the first occurrence of the delimiter that isn't escaped with a backslash, returning the text
+// and its length
+// Escaped delimiters get unescaped (e.g. with a "/" delimiter, "a\/b" becomes "a/b").
+func splitAtDelimiter(runes []rune, delimiter rune) (string, int) {
+	resultBuilder := strings.Builder{}
+	idx := 0
+	for idx < len(runes) && runes[idx] != delimiter {
+		if runes[idx] == '\\' && idx+1 < len(runes) && runes[idx+1] == delimiter {
+			idx++
+		} else if runes[idx] == '\\' && idx+1 < len(runes) {
+			resultBuilder.WriteRune(runes[idx])
+			idx++
+		}
+		resultBuilder.WriteRune(runes[idx])
+		idx++
+	}
+	return resultBuilder.String(), idx
+}
+
+// Parses an address given as an argument to a command (e.g. the destination of ":m"), returning its row (-1 for line
+// 0, meaning before the first line)
+func (model *Model) parseExAddressArgument(argument string) (int, error) {
+	runes := []rune(strings.TrimSpace(argument))
+	row, idx, found, err := model.parseExAddress(runes, 0, model.area.GetRow())
+	if err != nil {
+		return 0, err
+	}
+	if !found || idx != len(runes) {
+		return 0, fmt.Errorf("E14: Invalid address")
+	}
+	if row < -1 || row >= model.area.GetNumRows() {
+		return 0, fmt.Errorf("E16: Invalid range")
+	}
+	return row, nil
+}
+
+// ====================================================================================================
+//
+//	Completion
+//
+// ====================================================================================================
+// Completes the name of the command being typed (or the name of the option, for ":set")
+func completeExCommandLine(model *Model, text string) []string {
+	runes := []rune(text)
+	rangeLength := getExRangeLength(runes)
+	prefix, rest := string(runes[:rangeLength]), string(runes[rangeLength:])
+
+	var candidateNames []string
+	if strings.IndexFunc(rest, func(char rune) bool { return !unicode.IsLetter(char) }) < 0 {
+		for _, command := range model.exCommands {
+			candidateNames = append(candidateNames, command.name)
+		}
+	} else if name, _, args := splitExCommand(rest); name != "" && strings.HasPrefix("set", name) && len(name) >= 2 {
+		// Only the last option being set gets completed
+		lastSpaceIdx := strings.LastIndexAny(rest, " \t")
+		prefix, rest = prefix+rest[:lastSpaceIdx+1], rest[lastSpaceIdx+1:]
+		if args == "" || strings.IndexFunc(rest, func(char rune) bool { return !unicode.IsLetter(char) }) >= 0 {
+			return nil
+		}
+		for _, opt := range options {
+			candidateNames = append(candidateNames, opt.name)
+		}
+	}
+
+	var result []string
+	for _, candidateName := range candidateNames {
+		if strings.HasPrefix(candidateName, rest) {
+			result = append(result, prefix+candidateName)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Gets how many runes at the start of the command line make up its range, without evaluating it
+func getExRangeLength(runes []rune) int {
+	idx := 0
+	for idx < len(runes) {
+		char := runes[idx]
+		switch {
+		case char == '\'':
+			idx += 2
+		case char == '/' || char == '?':
+			_, patternLength := splitAtDelimiter(runes[idx+1:], char)
+			idx += patternLength + 2
+		case strings.ContainsRune(" \t:0123456789.,;$%+-", char):
+			idx++
+		default:
+			return idx
+		}
+	}
+	return min(idx, len(runes))
+}
+
+// ====================================================================================================
+//
+//	Command Implementations
+//
+// ====================================================================================================
+// ":[range]d [x] [count]" deletes the lines into register x (or count lines starting at the end of the range)
+func runDelete(model *Model, invocation CommandInvocation) (tea.Cmd, error) {
+	startRow, endRow := invocation.StartRow, invocation.EndRow
+	args := []rune(invocation.Args)
+
+	var registerName rune
+	if len(args) > 0 && !unicode.IsDigit(args[0]) {
+		registerName = args[0]
+		if !isValidRegisterName(registerName) || isReadOnlyRegister(registerName) {
+			return nil, fmt.Errorf("E488: Trailing characters: %s", invocation.Args)
+		}
+		args = []rune(strings.TrimLeft(string(args[1:]), " \t"))
+	}
+
+	if len(args) > 0 {
+		count, numDigits := parseNumber(args)
+		if numDigits != len(args) || count == 0 {
+			return nil, fmt.Errorf("E488: Trailing characters: %s", invocation.Args)
+		}
+		startRow = endRow
+		endRow = min(startRow+count-1, model.area.GetNumRows()-1)
+	}
+
+	applyDelete(model, normalCommand{register: registerName}, textRange{
+		start: textarea.Position{Row: startRow, Col: 0},
+		end:   textarea.Position{Row: endRow, Col: 0},
+		kind:  rangeKind_Linewise,
+	})
+	return nil, nil
+}
+
+// ":[range]m {address}" moves the lines to below the address
+func runMove(model *Model, invocation CommandInvocation) (tea.Cmd, error) {
+	destinationRow, err := model.parseExAddressArgument(invocation.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	startRow, endRow := invocation.StartRow, invocation.EndRow
+	if destinationRow >= startRow && destinationRow < endRow {
+		return nil, fmt.Errorf("E134: Cannot move a range of lines into itself")
+	}
+
+	// The lines get moved rather than deleted and reinserted, so that their marks go with them
+	model.area.MoveLines(startRow, endRow, destinationRow+1)
+	lastMovedRow := destinationRow
+	switch {
+	case destinationRow == endRow || destinationRow == startRow-1:
+		// The lines are already where they'd be moved to
+		lastMovedRow = endRow
+	case destinationRow < startRow:
+		lastMovedRow = destinationRow + endRow - startRow + 1
+	}
+	moveToFirstNonBlankOfRow(model, lastMovedRow)
+	return nil, nil
+}
+
+// ":[range]t {address}" (or ":co") copies the lines to below the address
+func runCopy(model *Model, invocation CommandInvocation) (tea.Cmd, error) {
+	destinationRow, err := model.parseExAddressArgument(invocation.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := model.area.GetLines(invocation.StartRow, invocation.EndRow)
+	model.area.InsertLines(destinationRow+1, lines)
+	moveToFirstNonBlankOfRow(model, destinationRow+len(lines))
+	return nil, nil
+}
+
+// ":[range]normal {keys}" runs the keys in normal mode, once at the start of each line in the range (or just once, at
+// the cursor, if there's no range)
+// The keys are in Vim's key notation, since there's no way to type keys like Esc into the command line.
+func runNormal(model *Model, invocation CommandInvocation) (tea.Cmd, error) {
+	if invocation.Args == "" {
+		return nil, fmt.Errorf("E471: Argument required")
+	}
+	keys := parseKeyNotation(invocation.Args)
+
+	if !invocation.HasRange {
+		model.handleKeysNow(keys)
+		model.finishPendingInput()
+		return nil, nil
+	}
+
+	for row := invocation.StartRow; row <= invocation.EndRow && row < model.area.GetNumRows(); row++ {
+		model.area.SetCursorPosition(textarea.Position{Row: row, Col: 0})
+		model.handleKeysNow(keys)
+		model.finishPendingInput()
+	}
+	return nil, nil
+}
+
+func runSet(model *Model, invocation CommandInvocation) (tea.Cmd, error) {
+	message, err := model.applySetArguments(invocation.Args)
+	if err != nil {
+		return nil, err
+	}
+	model.statusMessage = message
+	return nil, nil
+}
+
+// ":noh" hides the search highlighting until the next search
+func runNoHighlightSearch(model *Model, invocation CommandInvocation) (tea.Cmd, error) {
+	model.isHighlightingSearch = false
+	model.updateSearchHighlight()
+	return nil, nil
+}
+
+// ====================================================================================================
+//
+//	Action Implementations
+//
+// ====================================================================================================
+// A count before ":" gives the command a range of that many lines, starting at the cursor (e.g. "3:" gives ".,.+2")
+func openExCommandLineAction(model *Model, cmd normalCommand) {
+	initialText := ""
+	switch {
+	case cmd.count == 1:
+		initialText = "."
+	case cmd.count > 1:
+		initialText = fmt.Sprintf(".,.+%d", cmd.count-1)
+	}
+	model.openExCommandLine(initialText)
+}
+
+// In visual mode, ":" gives the command the selected lines as its range
+func openExCommandLineForSelection(model *Model, cmd normalCommand) {
+	model.exitVisualMode()
+	model.openExCommandLine("'<,'>")
+}
@@ -0,0 +1,154 @@
+package vim
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestExCommands(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nb\nc\nd\ne", 0, 0, ":4<CR>", "a\nb\nc\nd\ne", 3, 0},
+		{"a\nb\nc\nd\ne", 0, 0, ":1,2d<CR>", "c\nd\ne", 0, 0},
+		{"a\nb\nc\nd\ne", 2, 0, ":m0<CR>", "c\na\nb\nd\ne", 0, 0},
+		{"a\nb\nc\nd\ne", 0, 0, ":m$<CR>", "b\nc\nd\ne\na", 4, 0},
+		{"a\nb\nc\nd\ne", 0, 0, ":1,2m4<CR>", "c\nd\na\nb\ne", 3, 0},
+		{"a\nb\nc", 0, 0, ":t.<CR>", "a\na\nb\nc", 1, 0},
+		{"a\nb\nc", 0, 0, ":%normal A;<CR>", "a;\nb;\nc;", -1, 0},
+		{"a\nb\nc", 0, 0, ":%norm Ax<lt>Esc>Iy<CR>", "yax\nybx\nycx", -1, 0},
+		{"a a\nb a\na", 0, 0, ":%s/a/b/g<CR>", "b b\nb b\nb", 2, 0},
+		{"foo bar", 0, 0, `:s/(\w+) (\w+)/$2 $1/<CR>`, "bar foo", 0, 0},
+		{"a\nb\nc", 0, 0, `:2d x<CR>k"xp`, "a\nb\nc", -1, 0},
+	})
+}
+
+func TestExCommandRanges(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nb\nc\nd\ne", 0, 0, ":2;+1d<CR>", "a\nd\ne", 1, 0},
+		{"a\nfoo\nc\nfoo", 0, 0, ":/foo/d<CR>", "a\nc\nfoo", 1, 0},
+		{"a\nb\nc\nd\ne", 0, 0, "3:d<CR>", "d\ne", 0, 0},
+		{"a\nb\nc\nd", 0, 0, "jVj:d<CR>", "a\nd", 1, 0},
+	})
+}
+
+func TestCommandLineEditing(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nb\nc", 0, 0, ":del<Tab><CR>", "b\nc", -1, 0},
+		{"a\nb\nc", 0, 0, ":2d<CR>:<Up><CR>", "a", -1, 0},
+		{"a\nb\nc", 0, 0, ":2d<CR>j@:", "a", -1, 0},
+		{"abc\nb\nc", 0, 0, "yw:s/<C-r>0/x<CR>", "x\nb\nc", -1, 0},
+	})
+
+	model := newTestModel("a")
+	sendKeys(model, ":no<Tab>")
+	if text := string(model.commandLine.text); text != "nohlsearch" {
+		t.Errorf("got %q after completing a command, want %q", text, "nohlsearch")
+	}
+	sendKeys(model, "<Esc>:set hl<Tab>")
+	if text := string(model.commandLine.text); text != "set hlsearch" {
+		t.Errorf("got %q after completing a setting, want %q", text, "set hlsearch")
+	}
+}
+
+func TestExCommandsAreUndoneTogether(t *testing.T) {
+	for _, keys := range []string{
+		":2d<CR>u",
+		":%norm Ax<CR>u",
+		":%norm Ax<lt>Esc>:d<lt>Esc><CR>u",
+		":%s/./z/<CR>u",
+	} {
+		model := newTestModel("a\nb\nc")
+		sendKeys(model, keys)
+		if value := model.GetValue(); value != "a\nb\nc" {
+			t.Errorf("got %q after %q", value, keys)
+		}
+	}
+}
+
+func TestUnknownExCommand(t *testing.T) {
+	model := newTestModel("a")
+	sendKeys(model, ":bogus<CR>")
+	if !strings.Contains(model.statusMessage, "E492") {
+		t.Errorf("got status message %q, want E492", model.statusMessage)
+	}
+}
+
+func TestSetCommand(t *testing.T) {
+	model := newTestModel("a")
+	sendKeys(model, ":set ic<CR>")
+	if !model.Settings.IgnoreCase {
+		t.Errorf("\"ignorecase\" didn't get turned on")
+	}
+
+	sendKeys(model, ":set ic?<CR>")
+	if model.statusMessage != "ignorecase" {
+		t.Errorf("got status message %q, want %q", model.statusMessage, "ignorecase")
+	}
+	if !strings.Contains(model.View(), "ignorecase") {
+		t.Errorf("view doesn't show the status message")
+	}
+
+	sendKeys(model, ":se noic<CR>")
+	if model.Settings.IgnoreCase {
+		t.Errorf("\"ignorecase\" didn't get turned off")
+	}
+}
+
+func TestHostCommands(t *testing.T) {
+	type submitMsg struct {
+		invocation CommandInvocation
+	}
+	model := newTestModel("a\nb\nc")
+	model.RegisterCommand("Submit", func(model *Model, invocation CommandInvocation) tea.Cmd {
+		return func() tea.Msg {
+			return submitMsg{invocation: invocation}
+		}
+	})
+
+	cmd := sendKeys(model, ":2,3Submit! now<CR>")
+	if cmd == nil {
+		t.Fatalf("got no command from running the host's command")
+	}
+	batch, _ := cmd().(tea.BatchMsg)
+	if len(batch) != 1 {
+		t.Fatalf("got %d commands, want the host's one", len(batch))
+	}
+	msg, isSubmitMsg := batch[0]().(submitMsg)
+	wantInvocation := CommandInvocation{Name: "Submit", Bang: true, Args: "now", HasRange: true, StartRow: 1, EndRow: 2}
+	if !isSubmitMsg || msg.invocation != wantInvocation {
+		t.Errorf("got invocation %+v, want %+v", msg.invocation, wantInvocation)
+	}
+}
+
+func TestInvalidExRanges(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nb\nc", 0, 0, ":-5d<CR>", "a\nb\nc", 0, 0},
+		{"a\nb\nc", 0, 0, ":-5,.d<CR>", "a\nb\nc", 0, 0},
+		{"a\nb\nc", 0, 0, ":4d<CR>", "a\nb\nc", 0, 0},
+
+		// Line 0 means the first line
+		{"a\nb\nc", 0, 0, ":0,2d<CR>", "c", 0, 0},
+		{"a\nb\nc", 1, 0, ":-d<CR>", "b\nc", 0, 0},
+	})
+
+	model := newTestModel("a\nb\nc")
+	sendKeys(model, ":-5d<CR>")
+	if !strings.Contains(model.statusMessage, "E16") {
+		t.Errorf("got status message %q for a range before the first line, want E16", model.statusMessage)
+	}
+}
+
+func TestCompletionAfterRange(t *testing.T) {
+	model := newTestModel("é")
+	for text, want := range map[string][]string{
+		"/e/del": {"/e/delete"},
+		"/é/del": {"/é/delete"},
+		"1,$del": {"1,$delete"},
+	} {
+		if got := completeExCommandLine(model, text); !reflect.DeepEqual(got, want) {
+			t.Errorf("got completions %q for %q, want %q", got, text, want)
+		}
+	}
+}
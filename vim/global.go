@@ -0,0 +1,76 @@
+package vim
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// ":[range]g/{pattern}/{command}" runs the ex command on every line in the range (the whole buffer by default) that
+// matches the pattern, with the cursor at the start of the line; ":g!" and ":v" run it on the lines that don't match
+// The matching lines are found before any commands run, and lines deleted along the way get skipped, so commands that
+// add, delete or move lines (e.g. ":g/^$/d" or ":g/^/m0") act on the lines that matched.
+func runGlobal(model *Model, invocation CommandInvocation) (tea.Cmd, error) {
+	if model.isRunningGlobal {
+		return nil, fmt.Errorf("E147: Cannot do :global recursive")
+	}
+
+	args := []rune(invocation.Args)
+	if len(args) == 0 || !isValidPatternDelimiter(args[0]) {
+		return nil, fmt.Errorf("E476: Invalid command")
+	}
+	pattern, patternLength := splitAtDelimiter(args[1:], args[0])
+	command := string(args[min(1+patternLength+1, len(args)):])
+
+	if pattern == "" {
+		pattern = model.lastSearch.pattern
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("E35: No previous regular expression")
+	}
+	model.lastSearch.pattern = pattern
+	compiledPattern := model.compileSearchPattern(pattern)
+
+	startRow, endRow := invocation.StartRow, invocation.EndRow
+	if !invocation.HasRange {
+		startRow, endRow = 0, model.area.GetNumRows()-1
+	}
+
+	isInverted := invocation.Bang || invocation.Name == "vglobal"
+	var lines []*textarea.TrackedLine
+	for row := startRow; row <= endRow; row++ {
+		isMatch := compiledPattern.MatchString(string(model.area.GetLine(row)))
+		if isMatch != isInverted {
+			lines = append(lines, model.area.TrackLine(row))
+		}
+	}
+	if len(lines) == 0 {
+		if isInverted {
+			return nil, fmt.Errorf("Pattern found in every line: %s", pattern)
+		}
+		return nil, fmt.Errorf("E486: Pattern not found: %s", pattern)
+	}
+
+	model.isRunningGlobal = true
+	defer func() {
+		model.isRunningGlobal = false
+		for _, line := range lines {
+			model.area.UntrackLine(line)
+		}
+	}()
+
+	var resultCmds []tea.Cmd
+	for _, line := range lines {
+		if line.IsDeleted() {
+			continue
+		}
+		model.area.SetCursorPosition(textarea.Position{Row: line.GetRow(), Col: 0})
+		cmd, err := model.runExCommandLine(command)
+		resultCmds = append(resultCmds, cmd)
+		if err != nil {
+			return tea.Batch(resultCmds...), err
+		}
+	}
+	return tea.Batch(resultCmds...), nil
+}
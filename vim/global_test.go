@@ -0,0 +1,51 @@
+package vim
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGlobal(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nx1\nb\nx2", 0, 0, ":g/x/d<CR>", "a\nb", -1, 0},
+		{"a\n\n\nb\n\nc", 0, 0, ":g/^$/d<CR>", "a\nb\nc", -1, 0},
+		{"a\nx1\nb\nx2", 0, 0, ":2,3g/x/d<CR>", "a\nb\nx2", -1, 0},
+		{"a\nb\nc\nd", 0, 0, ":g/^/m0<CR>", "d\nc\nb\na", -1, 0},
+		{"a\nx1\nb\nx2", 0, 0, ":g/x/t.<CR>", "a\nx1\nx1\nb\nx2\nx2", -1, 0},
+		{"a\nx1\nb\nx2", 0, 0, ":g/x/normal A;<CR>", "a\nx1;\nb\nx2;", -1, 0},
+		{"a\nx1\nb\nx2", 0, 0, ":g/x/normal ddp<CR>", "a\nb\nx1\nx2", -1, 0},
+
+		// An empty pattern in the command reuses the global's pattern
+		{"a\nx1\nb\nx2", 0, 0, ":g/x/s//y/<CR>", "a\ny1\nb\ny2", -1, 0},
+
+		// Lines that the command deletes or adds don't get the command run on them
+		{"a\nx1\nx2\nb", 0, 0, ":g/x/.,+1d<CR>", "a\nb", -1, 0},
+		{"a\nx1\nb\nx2", 0, 0, `:g/x/s/1/a\rb/<CR>`, "a\nxa\nb\nb\nx2", -1, 0},
+		{"x\nx\nx", 0, 0, ":g/x/j<CR>", "x\nx\nx", -1, 0},
+	})
+}
+
+func TestInvertedGlobal(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nx1\nb\nx2", 0, 0, ":v/x/d<CR>", "x1\nx2", -1, 0},
+		{"a\nx1\nb\nx2", 0, 0, ":g!/x/d<CR>", "x1\nx2", -1, 0},
+	})
+}
+
+func TestGlobalIsUndoneTogether(t *testing.T) {
+	for _, keys := range []string{":g/x/d<CR>u", ":g/x/normal A;<CR>u", ":g/^/m0<CR>u"} {
+		model := newTestModel("a\nx1\nb\nx2")
+		sendKeys(model, keys)
+		if value := model.GetValue(); value != "a\nx1\nb\nx2" {
+			t.Errorf("got %q after %q", value, keys)
+		}
+	}
+}
+
+func TestNestedGlobal(t *testing.T) {
+	model := newTestModel("a")
+	sendKeys(model, ":g/a/g/a/d<CR>")
+	if !strings.Contains(model.statusMessage, "E147") {
+		t.Errorf("got status message %q, want E147", model.statusMessage)
+	}
+}
@@ -0,0 +1,180 @@
+package vim
+
+import (
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The largest magnitude of any of Bubble Tea's key types (which are negative for the keys it defines itself, and the
+// ASCII control code for control keys)
+const maxKeyTypeMagnitude = 200
+
+// Maps the names Bubble Tea gives keys (e.g. "enter" or "ctrl+r") back to the key types
+var keyTypesByName = getKeyTypesByName()
+
+// Converts a key name, as given by tea.KeyMsg.String(), back into the keypress that produces it
+func getKeyMsg(keyName string) tea.KeyMsg {
+	if keyName == " " {
+		return tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}}
+	}
+	if keyType, found := keyTypesByName[keyName]; found {
+		return tea.KeyMsg{Type: keyType}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(keyName)}
+}
+
+func getKeyMsgs(keyNames []string) []tea.KeyMsg {
+	result := make([]tea.KeyMsg, 0, len(keyNames))
+	for _, keyName := range keyNames {
+		result = append(result, getKeyMsg(keyName))
+	}
+	return result
+}
+
+// Gets the name of the key that types the given character (the reverse of keyToRune)
+func getRuneKeyName(char rune) string {
+	switch char {
+	case '\t':
+		return "tab"
+	case '\n':
+		return "enter"
+	}
+	return string(char)
+}
+
+// Gets the keys that type the given count, which is nothing for a count of 0
+func getCountKeyNames(count int) []string {
+	if count == 0 {
+		return nil
+	}
+	return splitKeyName(strconv.Itoa(count))
+}
+
+func getKeyTypesByName() map[string]tea.KeyType {
+	result := map[string]tea.KeyType{}
+	for value := -maxKeyTypeMagnitude; value <= maxKeyTypeMagnitude; value++ {
+		keyType := tea.KeyType(value)
+		name := keyType.String()
+		if name == "" || keyType == tea.KeyRunes {
+			continue
+		}
+		// Some keys have several types (e.g. "tab" is also ctrl+i), in which case we keep the first
+		if _, found := result[name]; !found {
+			result[name] = keyType
+		}
+	}
+	return result
+}
+
+// The names that Vim's key notation uses for some of the keys, where they differ from Bubble Tea's
+var notationNamesByKeyName = map[string]string{
+	"enter":     "CR",
+	"esc":       "Esc",
+	"backspace": "BS",
+	"tab":       "Tab",
+	"delete":    "Del",
+	"up":        "Up",
+	"down":      "Down",
+	"left":      "Left",
+	"right":     "Right",
+	"home":      "Home",
+	"end":       "End",
+	"pgup":      "PageUp",
+	"pgdown":    "PageDown",
+	"insert":    "Insert",
+}
+
+// Converts keypresses into Vim's key notation (e.g. "ihi<Esc>"), which is how macros are stored in registers
+func getKeyNotation(keys []tea.KeyMsg) string {
+	resultBuilder := strings.Builder{}
+	for _, key := range keys {
+		keyName := key.String()
+		switch {
+		case key.Type == tea.KeyRunes && !key.Alt:
+			resultBuilder.WriteString(strings.ReplaceAll(keyName, "<", "<lt>"))
+		case key.Type == tea.KeySpace:
+			resultBuilder.WriteString(" ")
+		default:
+			resultBuilder.WriteString("<" + getNotationName(keyName) + ">")
+		}
+	}
+	return resultBuilder.String()
+}
+
+// Converts Vim's key notation back into keypresses
+// Anything in angle brackets that isn't a key name is taken literally, and (like in Vim) newlines are Enter
+func parseKeyNotation(notation string) []tea.KeyMsg {
+	var result []tea.KeyMsg
+	runes := []rune(notation)
+	for idx := 0; idx < len(runes); idx++ {
+		char := runes[idx]
+		if char == '<' {
+			if closeOffset := strings.IndexRune(string(runes[idx:]), '>'); closeOffset > 0 {
+				notationLength := len([]rune(string(runes[idx:])[:closeOffset]))
+				if key, isValid := parseNotationName(string(runes[idx+1 : idx+notationLength])); isValid {
+					result = append(result, key)
+					idx += notationLength
+					continue
+				}
+			}
+		}
+		result = append(result, getKeyMsg(getRuneKeyName(char)))
+	}
+	return result
+}
+
+func getNotationName(keyName string) string {
+	prefix := ""
+	if strings.HasPrefix(keyName, "alt+") {
+		prefix = "M-"
+		keyName = strings.TrimPrefix(keyName, "alt+")
+	}
+
+	if notationName, found := notationNamesByKeyName[keyName]; found {
+		return prefix + notationName
+	}
+	if strings.HasPrefix(keyName, "ctrl+") {
+		return prefix + "C-" + strings.TrimPrefix(keyName, "ctrl+")
+	}
+	return prefix + keyName
+}
+
+// Parses the name between the angle brackets of a key in Vim's notation (e.g. "C-r" or "Esc")
+func parseNotationName(notationName string) (tea.KeyMsg, bool) {
+	isAlt := false
+	if strings.HasPrefix(notationName, "M-") && len(notationName) > 2 {
+		isAlt = true
+		notationName = strings.TrimPrefix(notationName, "M-")
+	}
+
+	var key tea.KeyMsg
+	if strings.EqualFold(notationName, "lt") {
+		key = getKeyMsg("<")
+	} else if strings.HasPrefix(notationName, "C-") && len(notationName) > 2 {
+		keyType, found := keyTypesByName["ctrl+"+strings.ToLower(strings.TrimPrefix(notationName, "C-"))]
+		if !found {
+			return tea.KeyMsg{}, false
+		}
+		key = tea.KeyMsg{Type: keyType}
+	} else {
+		keyName := ""
+		for candidateKeyName, candidateNotationName := range notationNamesByKeyName {
+			if strings.EqualFold(notationName, candidateNotationName) {
+				keyName = candidateKeyName
+			}
+		}
+		if keyName == "" {
+			// Single characters are only valid along with a modifier (e.g. "<M-x>")
+			if !isAlt || len([]rune(notationName)) != 1 {
+				return tea.KeyMsg{}, false
+			}
+			keyName = notationName
+		}
+		key = getKeyMsg(keyName)
+	}
+
+	key.Alt = isAlt
+	return key, true
+}
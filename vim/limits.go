@@ -0,0 +1,197 @@
+package vim
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// Limits caps how big the buffer can get from the keys the user types, where a limit of 0 or less (the default) means
+// there's no limit
+// A key whose change would take the buffer over a limit has its change undone, and Update returns a command sending a
+// LimitExceededMsg so the host can tell the user. Programmatic edits (e.g. SetValue) aren't limited.
+type Limits struct {
+	// The most lines the buffer can have
+	MaxLines int
+
+	// The most characters the buffer can have, counting the newlines between lines
+	MaxChars int
+}
+
+// LimitExceededMsg is sent when a key's change got undone because it would have taken the buffer over the Limits
+type LimitExceededMsg struct {
+	// The size the buffer would have been
+	NumLines int
+	NumChars int
+
+	// The limits that were in place
+	Limits Limits
+}
+
+// What's needed to put things back the way they were before a key, if its change turns out to be over the limits
+// Only the rows that the key can change get remembered, so that checking the limits doesn't cost as much as the buffer
+// is long (see getLimitCheckpoint).
+type limitCheckpoint struct {
+	// The rows starting at firstRow that the key can change, joined with newlines
+	firstRow int
+	oldText  string
+
+	// Set if every change before the key had been checkpointed, in which case the key's change gets undone through the
+	// undo tree rather than from oldText
+	isCheckpointed bool
+
+	// The size of the buffer before the key
+	numLines int
+	numChars int
+
+	cursor              textarea.Position
+	mode                Mode
+	changeBeingRecorded *repeatableChange
+	pendingBlockInsert  *blockInsert
+
+	// The undo tree before the key, which only ever gets states added onto the end of it
+	numUndoStates      int
+	currentUndoSeq     int
+	redoChildSeq       int
+	cursorBeforeChange *textarea.Position
+
+	// The rows changed since the last checkpoint, as recorded by the textarea
+	change *textarea.Change
+
+	insertedText  []rune
+	replacedChars []replacedChar
+}
+
+func (limits Limits) isSet() bool {
+	return limits.MaxLines > 0 || limits.MaxChars > 0
+}
+
+// Remembers how things are before the key gets handled, or returns nil if there are no limits to enforce
+func (model *Model) getLimitCheckpoint(msg tea.KeyMsg) *limitCheckpoint {
+	if !model.Limits.isSet() {
+		return nil
+	}
+	checkpoint := &limitCheckpoint{
+		firstRow:            0,
+		oldText:             "",
+		isCheckpointed:      false,
+		numLines:            model.area.GetNumRows(),
+		numChars:            0,
+		cursor:              model.area.GetCursorPosition(),
+		mode:                model.mode,
+		changeBeingRecorded: model.changeBeingRecorded,
+		pendingBlockInsert:  model.pendingBlockInsert,
+		numUndoStates:       len(model.undoStates),
+		currentUndoSeq:      model.currentUndoSeq,
+		redoChildSeq:        model.undoStates[model.currentUndoSeq].redoChildSeq,
+		cursorBeforeChange:  model.cursorBeforeChange,
+		change:              model.area.GetChange(),
+		insertedText:        model.insertedText,
+		replacedChars:       model.replacedChars,
+	}
+	if model.Limits.MaxChars > 0 {
+		checkpoint.numChars = model.area.GetNumRunes()
+	}
+
+	isTypingText := model.mode.isInsertOrReplace() && model.pendingSubstitution == nil && model.commandLine == nil
+	switch {
+	case isTypingText && !(msg.String() == "esc" && model.pendingBlockInsert != nil):
+		// Typing can only change the cursor's row (along with adding rows after it), since the keys that join rows
+		// make the buffer smaller
+		checkpoint.firstRow = model.area.GetRow()
+		checkpoint.oldText = string(model.area.GetLine(checkpoint.firstRow))
+	case isTypingText || model.pendingSubstitution != nil || model.isInEdit || checkpoint.change != nil:
+		// The buffer has changed since it was checkpointed (e.g. with the text typed before a block insert gets copied
+		// to the block's other rows), and the key can change any of it
+		checkpoint.oldText = model.area.GetValue()
+	default:
+		checkpoint.isCheckpointed = true
+	}
+	return checkpoint
+}
+
+// Undoes the change made since the checkpoint if it took the buffer over the limits, queueing up a LimitExceededMsg
+// A buffer that's already over the limits (e.g. from SetValue) can still be changed, so long as it doesn't grow.
+func (model *Model) enforceLimits(checkpoint *limitCheckpoint) {
+	if checkpoint == nil {
+		return
+	}
+
+	numLines, numChars := model.area.GetNumRows(), 0
+	if model.Limits.MaxChars > 0 {
+		numChars = model.area.GetNumRunes()
+	}
+	isOverLineLimit := model.Limits.MaxLines > 0 && numLines > model.Limits.MaxLines && numLines > checkpoint.numLines
+	isOverCharLimit := model.Limits.MaxChars > 0 && numChars > model.Limits.MaxChars && numChars > checkpoint.numChars
+	if !isOverLineLimit && !isOverCharLimit {
+		return
+	}
+	if model.Limits.MaxChars <= 0 {
+		numChars = model.area.GetNumRunes()
+	}
+
+	if checkpoint.isCheckpointed {
+		// Whatever the key changed since it last checkpointed gets undone, and then whatever it checkpointed
+		if change := model.area.GetChange(); change != nil {
+			delta := model.getChangeDelta(change)
+			model.applyTextDelta(delta.start, delta.newText, delta.oldText)
+		}
+		model.goToUndoState(checkpoint.currentUndoSeq)
+	} else {
+		// The rows the key could change have become however many rows it added more than that
+		numOldRows := strings.Count(checkpoint.oldText, "\n") + 1
+		numNewRows := max(1, numOldRows+numLines-checkpoint.numLines)
+		newText := strings.Join(model.area.GetLines(checkpoint.firstRow, checkpoint.firstRow+numNewRows-1), "\n")
+		delta := getTextDelta(checkpoint.oldText, newText)
+		delta.start.Row += checkpoint.firstRow
+		model.applyTextDelta(delta.start, delta.newText, delta.oldText)
+	}
+	model.area.SetCursorPosition(checkpoint.cursor)
+
+	model.forgetUndoStatesSince(checkpoint)
+	model.area.SetChange(checkpoint.change)
+	model.cursorBeforeChange = checkpoint.cursorBeforeChange
+	model.insertedText = checkpoint.insertedText
+	model.replacedChars = checkpoint.replacedChars
+
+	// A change that started inserting (e.g. "o") gets abandoned along with what it inserted
+	if model.mode.isInsertOrReplace() && !checkpoint.mode.isInsertOrReplace() {
+		model.mode = NormalMode
+		model.changeBeingRecorded = checkpoint.changeBeingRecorded
+		model.pendingBlockInsert = checkpoint.pendingBlockInsert
+		model.isAwaitingInsertModeUndoKey = false
+		model.shouldKeepUndoStepOnNextMove = false
+	}
+	// Leaving insert mode still checkpoints what was typed, just not what the key added to it (e.g. by copying it to the
+	// other rows of a block)
+	if checkpoint.mode.isInsertOrReplace() && !model.mode.isInsertOrReplace() {
+		model.CheckpointHistory()
+	}
+
+	if isOverLineLimit {
+		model.statusMessage = fmt.Sprintf("Change rejected: the buffer can't have more than %d lines", model.Limits.MaxLines)
+	} else {
+		model.statusMessage = fmt.Sprintf("Change rejected: the buffer can't have more than %d characters", model.Limits.MaxChars)
+	}
+	msg := LimitExceededMsg{NumLines: numLines, NumChars: numChars, Limits: model.Limits}
+	model.queuedCmds = append(model.queuedCmds, func() tea.Msg {
+		return msg
+	})
+}
+
+// Removes the undo states made since the checkpoint, going back to the state that was current then
+func (model *Model) forgetUndoStatesSince(checkpoint *limitCheckpoint) {
+	// Children always come after their parents, and are the last child their parent got
+	for seq := len(model.undoStates) - 1; seq >= checkpoint.numUndoStates; seq-- {
+		parent := &model.undoStates[model.undoStates[seq].parentSeq]
+		parent.childSeqs = parent.childSeqs[:len(parent.childSeqs)-1]
+		if parent.redoChildSeq == seq {
+			parent.redoChildSeq = -1
+		}
+	}
+	model.undoStates = model.undoStates[:checkpoint.numUndoStates]
+	model.currentUndoSeq = checkpoint.currentUndoSeq
+	model.undoStates[model.currentUndoSeq].redoChildSeq = checkpoint.redoChildSeq
+}
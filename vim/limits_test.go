@@ -0,0 +1,171 @@
+package vim
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Gets the LimitExceededMsg that the command sends, if any
+func getLimitExceededMsg(cmd tea.Cmd) (LimitExceededMsg, bool) {
+	if cmd == nil {
+		return LimitExceededMsg{}, false
+	}
+	switch msg := cmd().(type) {
+	case LimitExceededMsg:
+		return msg, true
+	case tea.BatchMsg:
+		for _, batchedCmd := range msg {
+			if limitMsg, found := getLimitExceededMsg(batchedCmd); found {
+				return limitMsg, true
+			}
+		}
+	}
+	return LimitExceededMsg{}, false
+}
+
+func TestLargeBuffers(t *testing.T) {
+	lines := make([]string, 0, 3000)
+	for idx := 0; idx < 3000; idx++ {
+		lines = append(lines, fmt.Sprintf("line %d with some text", idx))
+	}
+	text := strings.Join(lines, "\n")
+
+	// Pasting sends all of the text in one key message
+	model := newTestModel("")
+	sendKeys(model, "i")
+	model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text)})
+	sendKeys(model, "<Esc>")
+	if value := model.GetValue(); value != text {
+		t.Errorf("got %d characters after pasting %d", len(value), len(text))
+	}
+
+	sendKeys(model, "yyp")
+	if numRows := model.area.GetNumRows(); numRows != 3001 {
+		t.Errorf("got %d lines after putting a line, want 3001", numRows)
+	}
+}
+
+func TestLineLimit(t *testing.T) {
+	model := newTestModel("a\nb")
+	model.Limits = Limits{MaxLines: 3}
+	sendKeys(model, "yyp")
+	if value := model.GetValue(); value != "a\na\nb" {
+		t.Errorf("got %q after putting a line up to the limit", value)
+	}
+
+	cmd := sendKeys(model, "p")
+	if value := model.GetValue(); value != "a\na\nb" {
+		t.Errorf("got %q after putting a line past the limit", value)
+	}
+	msg, found := getLimitExceededMsg(cmd)
+	wantMsg := LimitExceededMsg{NumLines: 4, NumChars: 7, Limits: Limits{MaxLines: 3}}
+	if !found || msg != wantMsg {
+		t.Errorf("got message %+v (found: %v), want %+v", msg, found, wantMsg)
+	}
+	if !strings.Contains(model.statusMessage, "3 lines") {
+		t.Errorf("got status message %q, want it to give the limit", model.statusMessage)
+	}
+
+	// The rejected change doesn't leave anything behind in the undo history
+	sendKeys(model, "u")
+	if value := model.GetValue(); value != "a\nb" {
+		t.Errorf("got %q after undoing", value)
+	}
+
+	// A rejected change that would have started insert mode stays in normal mode
+	sendKeys(model, "<C-r>o")
+	if value := model.GetValue(); value != "a\na\nb" || model.GetMode() != NormalMode {
+		t.Errorf("got %q in mode %v after opening a line past the limit", value, model.GetMode())
+	}
+	sendKeys(model, "x")
+	if value := model.GetValue(); value != "a\n\nb" {
+		t.Errorf("got %q after x following the rejected change", value)
+	}
+}
+
+func TestLineLimitWhileTyping(t *testing.T) {
+	model := newTestModel("ab\ncd\nef")
+	model.Limits = Limits{MaxLines: 4}
+	sendKeys(model, "jAx<CR>y<CR>z<Esc>")
+	if value := model.GetValue(); value != "ab\ncdx\nyz\nef" {
+		t.Errorf("got %q after typing line breaks past the limit", value)
+	}
+
+	sendKeys(model, "u")
+	if value := model.GetValue(); value != "ab\ncd\nef" {
+		t.Errorf("got %q after undoing what was typed", value)
+	}
+}
+
+func TestCharLimit(t *testing.T) {
+	model := newTestModel("ab")
+	model.Limits = Limits{MaxChars: 4}
+	sendKeys(model, "Acdef<Esc>")
+	if value := model.GetValue(); value != "abcd" {
+		t.Errorf("got %q after typing past the limit", value)
+	}
+	sendKeys(model, "u")
+	if value := model.GetValue(); value != "ab" {
+		t.Errorf("got %q after undoing what was typed", value)
+	}
+
+	// Only what made it into the buffer counts as inserted
+	sendKeys(model, `".p`)
+	if value := model.GetValue(); value != "abcd" {
+		t.Errorf("got %q after putting the inserted text", value)
+	}
+
+	// A buffer that's already over the limit can still shrink
+	model.SetValue("abcdefgh")
+	sendKeys(model, "x")
+	if value := model.GetValue(); value != "abcdefg" {
+		t.Errorf("got %q after deleting from a buffer over the limit", value)
+	}
+}
+
+func TestCharLimitInReplaceMode(t *testing.T) {
+	model := newTestModel("abc")
+	model.Limits = Limits{MaxChars: 4}
+	sendKeys(model, "Rxyz<Esc>")
+	if value := model.GetValue(); value != "xyz" {
+		t.Errorf("got %q after replacing characters", value)
+	}
+	sendKeys(model, "$Rqw<Esc>")
+	if value := model.GetValue(); value != "xyqw" {
+		t.Errorf("got %q after replacing up to the limit", value)
+	}
+	sendKeys(model, "ae<Esc>")
+	if value := model.GetValue(); value != "xyqw" {
+		t.Errorf("got %q after appending past the limit", value)
+	}
+}
+
+func TestCharLimitForBlockInsert(t *testing.T) {
+	// Copying the typed text to the block's other rows would go over the limit, so only the first row keeps it
+	model := newTestModel("abc\ndef\nghi")
+	model.Limits = Limits{MaxChars: 13}
+	sendKeys(model, "<C-v>jjcXY<Esc>")
+	if value := model.GetValue(); value != "XYbc\nef\nhi" || model.GetMode() != NormalMode {
+		t.Errorf("got %q in mode %v after changing the block", value, model.GetMode())
+	}
+	if numStates := len(model.GetUndoStates()); numStates != 2 {
+		t.Errorf("got %d undo states, want the original one and the change", numStates)
+	}
+
+	sendKeys(model, "u")
+	if value := model.GetValue(); value != "abc\ndef\nghi" {
+		t.Errorf("got %q after undoing the change", value)
+	}
+}
+
+func TestCharLimitForConfirmedSubstitute(t *testing.T) {
+	model := newTestModel("a\na\na")
+	model.Limits = Limits{MaxChars: 7}
+	sendKeys(model, ":%s/a/bb/c<CR>yyy")
+	if value := model.GetValue(); value != "bb\nbb\na" {
+		t.Errorf("got %q after confirming substitutions past the limit", value)
+	}
+}
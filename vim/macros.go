@@ -0,0 +1,81 @@
+package vim
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Stands in for the register of the last macro played, as in "@@"
+const lastMacroRegisterAlias = '@'
+
+// Checks whether the keys typed so far are the "q" that stops a macro recording
+func (model *Model) isStopRecordingKey() bool {
+	return model.macroRegister != 0 && areKeysEqual(model.nGraphBuffer, []string{"q"})
+}
+
+// Adds a key that was typed to the macro being recorded, if any
+func (model *Model) recordMacroKey(msg tea.KeyMsg) {
+	if model.macroRegister == 0 {
+		return
+	}
+	model.macroKeys = append(model.macroKeys, msg)
+}
+
+// Stores the keys typed since the recording started in its register, in Vim's key notation
+func (model *Model) stopRecordingMacro() {
+	model.nGraphBuffer = nil
+	model.setRegister(model.macroRegister, register{text: getKeyNotation(model.macroKeys), kind: rangeKind_Characterwise})
+	model.macroRegister = 0
+	model.macroKeys = nil
+}
+
+// Throws away any keys queued up for replaying, which (like in Vim) is what happens to the rest of a macro when one
+// of its commands fails
+// This is also what stops a recursive macro.
+func (model *Model) abortReplay() {
+	model.keysToReplay = nil
+}
+
+func isValidMacroRecordingRegister(name rune) bool {
+	return name == unnamedRegister || (name >= 'a' && name <= 'z') || (name >= 'A' && name <= 'Z') || (name >= '0' && name <= '9')
+}
+
+// ====================================================================================================
+//
+//	Action Implementations
+//
+// ====================================================================================================
+func startRecordingMacro(model *Model, cmd normalCommand) {
+	if !isValidMacroRecordingRegister(cmd.argument) {
+		return
+	}
+	model.macroRegister = cmd.argument
+	model.macroKeys = nil
+}
+
+// Queues up the keys in the register count times; they get handled before the next render, so even a long macro only
+// costs one
+func playMacro(model *Model, cmd normalCommand) {
+	registerName := cmd.argument
+	if registerName == lastMacroRegisterAlias {
+		registerName = model.lastPlayedMacroRegister
+	}
+	if registerName == 0 || !isValidRegisterName(registerName) {
+		return
+	}
+	model.lastPlayedMacroRegister = registerName
+
+	// "@:" runs the last command line again, rather than typing it as keys
+	if registerName == lastCommandLineRegister {
+		for i := 0; i < cmd.getCount() && model.lastCommandLine != ""; i++ {
+			model.executeExCommandLine(model.lastCommandLine)
+		}
+		return
+	}
+
+	macroKeys := parseKeyNotation(model.getRegister(registerName).text)
+	var keys []tea.KeyMsg
+	for i := 0; i < cmd.getCount(); i++ {
+		keys = append(keys, macroKeys...)
+	}
+	model.replayKeys(keys)
+}
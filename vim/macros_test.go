@@ -0,0 +1,44 @@
+package vim
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMacros(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nb\nc", 0, 0, "qaA;<Esc>jq@a", "a;\nb;\nc", 2, 0},
+		{"a\nb\nc\nd", 0, 0, "qaA;<Esc>jq2@a", "a;\nb;\nc;\nd", 3, 0},
+		{"a\nb\nc\nd", 0, 0, "qaA;<Esc>jq@a@@", "a;\nb;\nc;\nd", 3, 0},
+
+		// A macro can play itself while it's being recorded
+		{"a\nb\nc\nd\ne", 0, 0, "qaA;<Esc>j@aq@a", "a;\nb;\nc;\nd;\ne;", 4, 1},
+
+		// Any register's text can be played as a macro
+		{"dw", 0, 0, `"ay$0@a`, "", 0, 0},
+	})
+}
+
+func TestMacroRecording(t *testing.T) {
+	model := newTestModel("abc")
+	sendKeys(model, "qa")
+	if !strings.Contains(model.View(), "recording @a") {
+		t.Errorf("view doesn't show that a macro is being recorded")
+	}
+
+	sendKeys(model, "xq")
+	if strings.Contains(model.View(), "recording") {
+		t.Errorf("view still shows a macro being recorded after it stopped")
+	}
+	if text := model.getRegister('a').text; text != "x" {
+		t.Errorf("got %q recorded, want %q", text, "x")
+	}
+}
+
+func TestKeyNotation(t *testing.T) {
+	for _, notation := range []string{"i<C-r>a<Up><BS><lt>x<Esc>", "dw", "A; <CR><Tab><M-x>"} {
+		if got := getKeyNotation(parseKeyNotation(notation)); got != notation {
+			t.Errorf("got %q after parsing and writing %q", got, notation)
+		}
+	}
+}
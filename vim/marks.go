@@ -0,0 +1,233 @@
+package vim
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// A position in the buffer that follows its line as rows are inserted and deleted above it
+// The mark goes away if its line gets deleted.
+type mark struct {
+	line *textarea.TrackedLine
+	col  int
+}
+
+// The special marks that "m" can set, besides the lowercase letters
+// "'" and "`" are both the context mark (the position before the latest jump), which gets stored under "'".
+const settableSpecialMarks = "'`[]<>"
+
+// The special marks that can be jumped to but that only get set by the editor itself
+const readOnlySpecialMarks = "."
+
+// How many positions the jumplist remembers
+const maxJumpListLength = 100
+
+// GetMark gets the position of the mark with the given name (e.g. 'a', '.' or '<'), returning false if it isn't set
+// (or if its line has been deleted)
+func (model Model) GetMark(name rune) (textarea.Position, bool) {
+	if name == '`' {
+		name = '\''
+	}
+	existing, found := model.marks[name]
+	if !found || existing.line.IsDeleted() {
+		return textarea.Position{}, false
+	}
+	row := existing.line.GetRow()
+	return textarea.Position{Row: row, Col: min(existing.col, model.area.GetLineLength(row))}, true
+}
+
+// SetMark sets the mark with the given name to the position, where the name must be a lowercase letter or one of the
+// special marks that "m" can set
+func (model *Model) SetMark(name rune, pos textarea.Position) error {
+	if !isSettableMarkName(name) {
+		return fmt.Errorf("E191: Argument must be a letter or forward/backward quote")
+	}
+	model.setMark(name, pos)
+	return nil
+}
+
+func (model *Model) setMark(name rune, pos textarea.Position) {
+	if name == '`' {
+		name = '\''
+	}
+	if existing, found := model.marks[name]; found {
+		model.area.UntrackLine(existing.line)
+	}
+	model.marks[name] = model.newMark(pos)
+}
+
+func (model *Model) newMark(pos textarea.Position) mark {
+	row := clamp(pos.Row, 0, model.area.GetNumRows()-1)
+	return mark{line: model.area.TrackLine(row), col: max(0, pos.Col)}
+}
+
+func isSettableMarkName(name rune) bool {
+	return (name >= 'a' && name <= 'z') || strings.ContainsRune(settableSpecialMarks, name)
+}
+
+func isValidMarkName(name rune) bool {
+	return isSettableMarkName(name) || strings.ContainsRune(readOnlySpecialMarks, name)
+}
+
+// Gets the row of the mark with the given name
+func (model *Model) getMarkRow(name rune) (int, bool) {
+	pos, isSet := model.GetMark(name)
+	return pos.Row, isSet
+}
+
+// Sets the "[" and "]" marks to the start and end of the text that was just changed or yanked, and for changes, the
+// "." mark to where the change was made
+func (model *Model) markChangedText(start textarea.Position, end textarea.Position, isChange bool) {
+	model.setMark('[', start)
+	model.setMark(']', end)
+	if isChange {
+		model.setMark('.', end)
+	}
+}
+
+// Gets the first and last positions of the text that the change put in the buffer, where the last position is the same
+// as the first if text was only deleted
+func (model *Model) getChangedRegion(delta textDelta) (textarea.Position, textarea.Position) {
+	start, newText := delta.start, delta.newText
+
+	// Whole rows inserted or deleted at the end of the buffer start from the end of the row before them (see
+	// getTextDelta), but the change starts on the row after it
+	lastRow := model.area.GetNumRows() - 1
+	isAtEnd := getTextEnd(start, newText) == textarea.Position{Row: lastRow, Col: model.area.GetLineLength(lastRow)}
+	if isAtEnd && hasLeadingNewline(delta.oldText) && hasLeadingNewline(newText) {
+		start = textarea.Position{Row: min(start.Row+1, lastRow), Col: 0}
+		newText = strings.TrimPrefix(newText, "\n")
+	}
+	if newText == "" {
+		return start, start
+	}
+
+	// The last position is on the last rune put in the buffer, which for whole rows is the one before their newline
+	if start.Col == 0 && hasTrailingNewline(delta.oldText) && strings.HasSuffix(newText, "\n") {
+		newText = strings.TrimSuffix(newText, "\n")
+	}
+	end := getTextEnd(start, newText)
+	end.Col = max(0, end.Col-1)
+	if end.IsBefore(start) {
+		end = start
+	}
+	return start, end
+}
+
+// Whether the text is empty or starts with a newline, like rows inserted or deleted at the end of the buffer are
+func hasLeadingNewline(text string) bool {
+	return text == "" || strings.HasPrefix(text, "\n")
+}
+
+// Whether the text is empty or ends with a newline, like rows inserted or deleted before another row are
+func hasTrailingNewline(text string) bool {
+	return text == "" || strings.HasSuffix(text, "\n")
+}
+
+// ====================================================================================================
+//
+//	Jumplist
+//
+// ====================================================================================================
+// Remembers the position before a jump (e.g. "G" or a search) in the jumplist and the context mark
+// Like Vim, each row is only in the jumplist once, and adding a position puts us back at the end of the list.
+func (model *Model) recordJump(pos textarea.Position) {
+	model.setMark('\'', pos)
+
+	var kept []mark
+	for _, entry := range model.jumpList {
+		if entry.line.IsDeleted() || entry.line.GetRow() == pos.Row {
+			model.area.UntrackLine(entry.line)
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	kept = append(kept, model.newMark(pos))
+	for len(kept) > maxJumpListLength {
+		model.area.UntrackLine(kept[0].line)
+		kept = kept[1:]
+	}
+
+	model.jumpList = kept
+	model.jumpListIdx = len(kept)
+}
+
+// Moves through the jumplist by the offset (e.g. -1 for the previous position), returning false if there's no entry
+// that far away
+func (model *Model) moveThroughJumpList(offset int) bool {
+	var kept []mark
+	for idx, entry := range model.jumpList {
+		if entry.line.IsDeleted() {
+			model.area.UntrackLine(entry.line)
+			if idx < model.jumpListIdx {
+				model.jumpListIdx--
+			}
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	model.jumpList = kept
+
+	// Going back from the end of the list adds the current position, so that "ctrl+i" can come back to it
+	if offset < 0 && model.jumpListIdx >= len(model.jumpList) {
+		model.recordJump(model.area.GetCursorPosition())
+		model.jumpListIdx = len(model.jumpList) - 1
+	}
+
+	targetIdx := model.jumpListIdx + offset
+	if targetIdx < 0 || targetIdx >= len(model.jumpList) {
+		return false
+	}
+	model.jumpListIdx = targetIdx
+
+	target := model.jumpList[targetIdx]
+	model.area.SetCursorPosition(textarea.Position{Row: target.line.GetRow(), Col: target.col})
+	return true
+}
+
+// ====================================================================================================
+//
+//	Action & Motion Implementations
+//
+// ====================================================================================================
+// "m{a-z}" sets a mark at the cursor
+func setMarkAction(model *Model, cmd normalCommand) {
+	if err := model.SetMark(cmd.argument, model.area.GetCursorPosition()); err != nil {
+		model.abortReplay()
+	}
+}
+
+// "`x" goes to the position of mark x, and "'x" goes to the first non-blank character of its row
+func moveToMark(model *Model, cmd normalCommand) bool {
+	if !isValidMarkName(cmd.argument) {
+		return false
+	}
+	pos, isSet := model.GetMark(cmd.argument)
+	if !isSet {
+		model.statusMessage = "E20: Mark not set"
+		return false
+	}
+
+	if cmd.motion == "'" {
+		moveToFirstNonBlankOfRow(model, pos.Row)
+		return true
+	}
+	model.area.SetCursorPosition(pos)
+	return true
+}
+
+// "ctrl+o" goes to the count'th previous position in the jumplist, and "tab" (which is the same key as "ctrl+i") goes
+// to the count'th next one
+func moveThroughJumpListAction(model *Model, cmd normalCommand) {
+	offset := cmd.getCount()
+	if cmd.action == "ctrl+o" {
+		offset = -offset
+	}
+	if !model.moveThroughJumpList(offset) {
+		model.abortReplay()
+		return
+	}
+	model.bindCursorToLine()
+}
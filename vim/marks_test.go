@@ -0,0 +1,104 @@
+package vim
+
+import (
+	"testing"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+func TestMarks(t *testing.T) {
+	text := "one\n  two\nthree\nfour\nfive"
+	runKeysTests(t, []keysTest{
+		{text, 1, 4, "majj`a", text, 1, 4},
+		{text, 1, 4, "majj'a", text, 1, 2},
+		{text, 1, 4, "majjd'a", "one\nfive", 1, 0},
+		{text, 1, 4, "majjd`a", "one\n  twr\nfive", 1, 4},
+		{text, 0, 0, "jjmbgg:'b<CR>", text, 2, 0},
+
+		// Jumping to a mark that isn't set fails, along with whatever it was the motion for
+		{text, 0, 0, "`z", text, 0, 0},
+		{text, 0, 0, "jjmbggd`z", text, 0, 0},
+	})
+}
+
+func TestMarksFollowTheirLines(t *testing.T) {
+	text := "one\n  two\nthree\nfour\nfive"
+	runKeysTests(t, []keysTest{
+		{text, 1, 4, "maggOnew<Esc>G'a", "new\n" + text, 2, 2},
+		{text, 1, 4, "jmaggdd'a", "  two\nthree\nfour\nfive", 1, 0},
+		{text, 1, 4, "jmakdd'a", "one\nthree\nfour\nfive", 1, 0},
+
+		// A mark on a deleted line goes to the line that took its place
+		{text, 1, 4, "madd'a", "one\nthree\nfour\nfive", 1, 0},
+	})
+}
+
+func TestMarksFollowMovedLines(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nb\nc\nd", 0, 0, "majmb:1m$<CR>'a", "b\nc\nd\na", 3, 0},
+		{"a\nb\nc\nd", 0, 0, "majmb:1m$<CR>'b", "b\nc\nd\na", 0, 0},
+		{"a\nb\nc\nd", 3, 0, "ma:4m0<CR>jj'a", "d\na\nb\nc", 0, 0},
+		{"a\nb\nc\nd", 2, 0, "ma:1,2m3<CR>'a", "c\na\nb\nd", 0, 0},
+		{"a\nb\nc\nd", 0, 0, "ma:1,2m3<CR>'a", "c\na\nb\nd", 1, 0},
+		{"a\nb\nc\nd", 3, 0, "ma:g/[bc]/m$<CR>'a", "a\nd\nb\nc", 1, 0},
+	})
+}
+
+func TestSpecialMarks(t *testing.T) {
+	text := "one\n  two\nthree\nfour\nfive"
+	runKeysTests(t, []keysTest{
+		{text, 0, 0, "jjxgg`.", "one\n  two\nhree\nfour\nfive", 2, 0},
+		{text, 0, 0, "jjAxy<Esc>gg`.", "one\n  two\nthreexy\nfour\nfive", 2, 6},
+		{text, 0, 0, "jyjgg'[", text, 1, 2},
+		{text, 0, 0, "jyjgg']", text, 2, 0},
+		{text, 0, 0, "jyjgg`]", text, 2, 4},
+		{text, 0, 0, "jvjlo<Esc>gg`>", text, 2, 1},
+		{text, 0, 0, "jvjlo<Esc>G`<", text, 1, 0},
+		{text, 0, 0, "jVj<Esc>:'<,'>d<CR>", "one\nfour\nfive", 1, 0},
+	})
+}
+
+func TestJumpList(t *testing.T) {
+	text := "one\n  two\nthree\nfour\nfive"
+	runKeysTests(t, []keysTest{
+		{text, 0, 0, "G``", text, 0, 0},
+		{text, 0, 0, "G````", text, 4, 0},
+		{text, 0, 0, "G''", text, 0, 0},
+		{text, 0, 0, "/fo<CR><C-o>", text, 0, 0},
+		{text, 0, 0, "3Ggg<C-o>", text, 2, 0},
+		{text, 0, 0, "3Ggg<C-o><C-o>", text, 2, 0},
+		{text, 0, 0, "3Ggg<C-o><Tab>", text, 0, 0},
+		{text, 0, 0, "2G4Ggg<C-o>", text, 3, 0},
+		{text, 0, 0, "2G4Ggg<C-o><C-o>", text, 1, 0},
+		{text, 0, 0, "2G4Ggg<C-o><C-o><C-o>", text, 1, 0},
+		{text, 0, 0, "2G4Ggg<C-o><C-o><Tab>", text, 3, 0},
+		{text, 0, 0, "2G4Ggg<C-o><C-o><Tab><Tab>", text, 0, 0},
+		{text, 0, 0, "2G4Ggg2<C-o><Tab>", text, 3, 0},
+		{text, 0, 0, "3GG2<C-o>", text, 0, 0},
+	})
+}
+
+func TestHostMarks(t *testing.T) {
+	model := newTestModel("one\n  two\nthree\nfour\nfive")
+	sendKeys(model, "jjlmq")
+	if pos, isSet := model.GetMark('q'); !isSet || pos != (textarea.Position{Row: 2, Col: 1}) {
+		t.Errorf("got mark q at %v (set: %v), want it at 2,1", pos, isSet)
+	}
+
+	if err := model.SetMark('A', textarea.Position{Row: 0, Col: 0}); err == nil {
+		t.Errorf("setting mark A succeeded, want an error")
+	}
+	if err := model.SetMark('r', textarea.Position{Row: 4, Col: 2}); err != nil {
+		t.Fatalf("setting mark r failed: %v", err)
+	}
+	sendKeys(model, "gg`r")
+	if cursor := model.area.GetCursorPosition(); cursor != (textarea.Position{Row: 4, Col: 2}) {
+		t.Errorf("got the cursor at %v after jumping to the host's mark", cursor)
+	}
+
+	// Undoing a change puts the marks back on their lines
+	sendKeys(model, "ggddu")
+	if pos, isSet := model.GetMark('q'); !isSet || pos != (textarea.Position{Row: 2, Col: 1}) {
+		t.Errorf("got mark q at %v (set: %v) after undoing, want it at 2,1", pos, isSet)
+	}
+}
@@ -0,0 +1,184 @@
+package vim
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// Parses a value of the "matchpairs" option, which is a comma-separated list of pairs of different characters like
+// "(:)", giving the pairs' opening and closing characters
+func parseMatchPairs(spec string) ([][2]rune, error) {
+	var result [][2]rune
+	for _, part := range strings.Split(spec, ",") {
+		if part == "" {
+			continue
+		}
+
+		runes := []rune(part)
+		if len(runes) != 3 || runes[1] != ':' || runes[0] == runes[2] || runes[0] == utf8.RuneError || runes[2] == utf8.RuneError {
+			return nil, fmt.Errorf("E474: Invalid argument: %s", part)
+		}
+		result = append(result, [2]rune{runes[0], runes[2]})
+	}
+	return result, nil
+}
+
+func validateMatchPairs(spec string) error {
+	_, err := parseMatchPairs(spec)
+	return err
+}
+
+// Gets the pair that the character is one end of (from the "matchpairs" setting), and the direction to search for
+// the other end in
+func (model *Model) getMatchPair(char rune) ([2]rune, int, bool) {
+	for _, pair := range model.getMatchPairs() {
+		switch char {
+		case pair[0]:
+			return pair, 1, true
+		case pair[1]:
+			return pair, -1, true
+		}
+	}
+	return [2]rune{}, 0, false
+}
+
+// Gets the pairs from the "matchpairs" setting, which only gets parsed again when it changes (since the host can
+// change the settings directly)
+func (model *Model) getMatchPairs() [][2]rune {
+	if model.matchPairsSpec != model.Settings.MatchPairs {
+		if pairs, err := parseMatchPairs(model.Settings.MatchPairs); err == nil {
+			model.matchPairs = pairs
+		}
+		model.matchPairsSpec = model.Settings.MatchPairs
+	}
+	return model.matchPairs
+}
+
+// Finds the character that matches the one at the position (which must be one end of the pair), going in the
+// direction (1 for forward, -1 for backward) and skipping over nested pairs, without going outside of the rows from
+// minRow to maxRow
+// Like Vim, characters in double-quoted strings are skipped unless the starting character is in one too. Strings
+// can't span rows, and rows with unbalanced quotes are treated as having no strings.
+func (model *Model) findMatchingPairEnd(pos textarea.Position, pair [2]rune, direction int, minRow int, maxRow int) (textarea.Position, bool) {
+	target, nested := pair[1], pair[0]
+	if direction < 0 {
+		target, nested = pair[0], pair[1]
+	}
+
+	stringCols := getStringColumns(model.area.GetLine(pos.Row))
+	isStartInString := stringCols[pos.Col]
+
+	depth := 0
+	row, col := pos.Row, pos.Col+direction
+	for {
+		line := model.area.GetLine(row)
+		for ; col >= 0 && col < len(line); col += direction {
+			if stringCols[col] != isStartInString {
+				continue
+			}
+			switch line[col] {
+			case nested:
+				depth++
+			case target:
+				if depth == 0 {
+					return textarea.Position{Row: row, Col: col}, true
+				}
+				depth--
+			}
+		}
+
+		row += direction
+		if row < minRow || row > maxRow {
+			return pos, false
+		}
+		line = model.area.GetLine(row)
+		stringCols = getStringColumns(line)
+		col = 0
+		if direction < 0 {
+			col = len(line) - 1
+		}
+	}
+}
+
+// Gets which columns of the line are inside double-quoted strings (including the quotes themselves), where quotes
+// escaped with a backslash don't count
+// If the quotes aren't balanced, there's no telling what's in a string, so none of the columns are.
+func getStringColumns(line []rune) []bool {
+	result := make([]bool, len(line))
+	isInString := false
+	for col := 0; col < len(line); col++ {
+		switch {
+		case line[col] == '\\' && isInString:
+			result[col] = true
+			if col+1 < len(line) {
+				col++
+				result[col] = true
+			}
+			continue
+		case line[col] == '"':
+			isInString = !isInString
+			result[col] = true
+			continue
+		}
+		result[col] = isInString
+	}
+
+	if isInString {
+		return make([]bool, len(line))
+	}
+	return result
+}
+
+// "%" jumps from the first "matchpairs" character at or after the cursor on its row (e.g. a bracket) to the character
+// that matches it
+func moveToMatchingPairEnd(model *Model, cmd normalCommand) bool {
+	pos := model.area.GetCursorPosition()
+	line := model.area.GetLine(pos.Row)
+	for col := pos.Col; col < len(line); col++ {
+		pair, direction, found := model.getMatchPair(line[col])
+		if !found {
+			continue
+		}
+		matchPos, found := model.findMatchingPairEnd(textarea.Position{Row: pos.Row, Col: col}, pair, direction, 0, model.area.GetNumRows()-1)
+		if !found {
+			return false
+		}
+		model.area.SetCursorPosition(matchPos)
+		return true
+	}
+	return false
+}
+
+// Gets the positions of the "matchpairs" character under the cursor and the character that matches it, for
+// highlighting with the textarea's MatchParen style
+// In insert and replace modes, the character before the cursor counts too (as that's usually the one that was just typed).
+// Like Vim's matchparen, the match is only looked for on the screen, so that rendering doesn't cost as much as the
+// buffer is long.
+func (model Model) getMatchParenHighlights() []textarea.Position {
+	pos := model.area.GetCursorPosition()
+	line := model.area.GetLine(pos.Row)
+
+	candidateCols := []int{pos.Col}
+	if model.mode.isInsertOrReplace() {
+		candidateCols = append(candidateCols, pos.Col-1)
+	}
+	for _, col := range candidateCols {
+		if col < 0 || col >= len(line) {
+			continue
+		}
+		pair, direction, found := model.getMatchPair(line[col])
+		if !found {
+			continue
+		}
+		bracketPos := textarea.Position{Row: pos.Row, Col: col}
+		minRow, maxRow := min(model.area.GetTopRow(), pos.Row), max(model.area.GetBottomRow(), pos.Row)
+		if matchPos, found := model.findMatchingPairEnd(bracketPos, pair, direction, minRow, maxRow); found {
+			return []textarea.Position{bracketPos, matchPos}
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package vim
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+func TestMatchPairMotion(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a (b) c", 0, 0, "%", "a (b) c", 0, 4},
+		{"a (b) c", 0, 4, "%", "a (b) c", 0, 2},
+		{"{\n  [1, (2)]\n}", 0, 0, "%", "{\n  [1, (2)]\n}", 2, 0},
+		{"{\n  [1, (2)]\n}", 2, 0, "%", "{\n  [1, (2)]\n}", 0, 0},
+		{"{\n  [1, (2)]\n}", 1, 0, "%", "{\n  [1, (2)]\n}", 1, 9},
+		{"a b", 0, 0, "%", "a b", 0, 0},
+
+		// Brackets in quotes only match brackets in the same quotes
+		{`f("(", x)`, 0, 1, "%", `f("(", x)`, 0, 8},
+		{`f("(", x)`, 0, 8, "%", `f("(", x)`, 0, 1},
+		{`"(a)"`, 0, 1, "%", `"(a)"`, 0, 3},
+
+		{"a (b) c", 0, 0, "d%", " c", 0, 0},
+		{"x (b) c", 0, 0, "c%y<Esc>", "y c", 0, 0},
+		{"(a", 0, 0, "d%", "(a", 0, 0},
+		{"(a) b", 0, 0, "v%d", " b", 0, 0},
+	})
+}
+
+func TestMatchPairsSetting(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"<a>", 0, 0, "%", "<a>", 0, 0},
+		{"<a>", 0, 0, ":set mps+=<:><CR>%", "<a>", 0, 2},
+	})
+
+	model := newTestModel("x")
+	sendKeys(model, ":set mps+=ab<CR>")
+	if !strings.Contains(model.statusMessage, "E474") {
+		t.Errorf("got status message %q for an invalid value, want E474", model.statusMessage)
+	}
+}
+
+func TestMatchParenHighlights(t *testing.T) {
+	model := newTestModel("f(a, b)")
+	model.area.SetCursorPosition(textarea.Position{Row: 0, Col: 1})
+	want := []textarea.Position{{Row: 0, Col: 1}, {Row: 0, Col: 6}}
+	if got := model.getMatchParenHighlights(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got highlights %v with the cursor on the bracket, want %v", got, want)
+	}
+
+	// In insert mode, the bracket before the cursor gets highlighted too
+	sendKeys(model, "A")
+	want = []textarea.Position{{Row: 0, Col: 6}, {Row: 0, Col: 1}}
+	if got := model.getMatchParenHighlights(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got highlights %v with the cursor after the bracket, want %v", got, want)
+	}
+}
+
+func TestMatchParenHighlightsOnlyLookOnScreen(t *testing.T) {
+	model := newTestModel("{\n" + getNumberedLines(50) + "\n}")
+	if highlights := model.getMatchParenHighlights(); highlights != nil {
+		t.Errorf("got highlights %v for a bracket whose match is off the screen, want none", highlights)
+	}
+
+	// "%" still finds it
+	sendKeys(model, "%")
+	if cursor := model.area.GetCursorPosition(); cursor != (textarea.Position{Row: 51, Col: 0}) {
+		t.Errorf("got the cursor at %v after %%, want it on the closing bracket", cursor)
+	}
+}
+
+func TestChangedMatchPairsAreNoticed(t *testing.T) {
+	model := newTestModel("<a>")
+	sendKeys(model, "l")
+	model.Settings.MatchPairs += ",<:>"
+	sendKeys(model, "h%")
+	if cursor := model.area.GetCursorPosition(); cursor != (textarea.Position{Row: 0, Col: 2}) {
+		t.Errorf("got the cursor at %v after %% with the host's pair, want it on the closing bracket", cursor)
+	}
+}
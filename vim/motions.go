@@ -0,0 +1,441 @@
+package vim
+
+import (
+	"sort"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// Determines how the text between the start and end of a motion gets interpreted when an operator is applied to it
+type motionKind int
+
+const (
+	// The character under the end position is NOT included in the range
+	motionKind_Exclusive motionKind = iota
+
+	// The character under the end position IS included in the range
+	motionKind_Inclusive
+
+	// Every line touched by the motion is included in its entirety
+	motionKind_Linewise
+)
+
+type motion struct {
+	kind motionKind
+
+	// Whether the motion needs another key after it (e.g. the character to find for "f")
+	takesArgument bool
+
+	// Whether the motion is a jump (e.g. "G" or a search), which remembers where the cursor was in the jumplist
+	isJump bool
+
+	// Moves the textarea cursor to the motion's target, returning false if the motion couldn't be completed (in
+	// which case any pending operator gets cancelled)
+	move func(model *Model, cmd normalCommand) bool
+}
+
+var motions = map[string]motion{
+	"h":         {kind: motionKind_Exclusive, move: moveLeft},
+	"left":      {kind: motionKind_Exclusive, move: moveLeft},
+	"backspace": {kind: motionKind_Exclusive, move: moveLeft},
+	"l":         {kind: motionKind_Exclusive, move: moveRight},
+	"right":     {kind: motionKind_Exclusive, move: moveRight},
+	" ":         {kind: motionKind_Exclusive, move: moveRight},
+	"j":         {kind: motionKind_Linewise, move: moveDown},
+	"down":      {kind: motionKind_Linewise, move: moveDown},
+	"k":         {kind: motionKind_Linewise, move: moveUp},
+	"up":        {kind: motionKind_Linewise, move: moveUp},
+	"+":         {kind: motionKind_Linewise, move: moveDownToFirstNonBlank},
+	"enter":     {kind: motionKind_Linewise, move: moveDownToFirstNonBlank},
+	"-":         {kind: motionKind_Linewise, move: moveUpToFirstNonBlank},
+	"_":         {kind: motionKind_Linewise, move: moveToFirstNonBlankOfLine},
+	"0":         {kind: motionKind_Exclusive, move: moveToLineStart},
+	"^":         {kind: motionKind_Exclusive, move: moveToFirstNonBlank},
+	"$":         {kind: motionKind_Inclusive, move: moveToLineEnd},
+	"w":         {kind: motionKind_Exclusive, move: moveToWordStartForward},
+	"W":         {kind: motionKind_Exclusive, move: moveToWordStartForward},
+	"e":         {kind: motionKind_Inclusive, move: moveToWordEndForward},
+	"E":         {kind: motionKind_Inclusive, move: moveToWordEndForward},
+	"b":         {kind: motionKind_Exclusive, move: moveToWordStartBackward},
+	"B":         {kind: motionKind_Exclusive, move: moveToWordStartBackward},
+	"ge":        {kind: motionKind_Inclusive, move: moveToWordEndBackward},
+	"gE":        {kind: motionKind_Inclusive, move: moveToWordEndBackward},
+	")":         {kind: motionKind_Exclusive, isJump: true, move: moveToSentenceStart},
+	"(":         {kind: motionKind_Exclusive, isJump: true, move: moveToSentenceStart},
+	"}":         {kind: motionKind_Exclusive, isJump: true, move: moveToParagraphBoundary},
+	"{":         {kind: motionKind_Exclusive, isJump: true, move: moveToParagraphBoundary},
+	"gg":        {kind: motionKind_Linewise, isJump: true, move: moveToFirstRow},
+	"G":         {kind: motionKind_Linewise, isJump: true, move: moveToLastRow},
+	"f":         {kind: motionKind_Inclusive, takesArgument: true, move: moveToCharacter},
+	"F":         {kind: motionKind_Exclusive, takesArgument: true, move: moveToCharacter},
+	"t":         {kind: motionKind_Inclusive, takesArgument: true, move: moveToCharacter},
+	"T":         {kind: motionKind_Exclusive, takesArgument: true, move: moveToCharacter},
+	"/":         {kind: motionKind_Exclusive, isJump: true, move: moveToSearchMatch},
+	"?":         {kind: motionKind_Exclusive, isJump: true, move: moveToSearchMatch},
+	"n":         {kind: motionKind_Exclusive, isJump: true, move: moveToSearchMatch},
+	"N":         {kind: motionKind_Exclusive, isJump: true, move: moveToSearchMatch},
+	"*":         {kind: motionKind_Exclusive, isJump: true, move: moveToKeywordMatch},
+	"#":         {kind: motionKind_Exclusive, isJump: true, move: moveToKeywordMatch},
+	"%":         {kind: motionKind_Inclusive, isJump: true, move: moveToMatchingPairEnd},
+	"H":         {kind: motionKind_Linewise, isJump: true, move: moveToViewEdge},
+	"M":         {kind: motionKind_Linewise, isJump: true, move: moveToViewMiddle},
+	"L":         {kind: motionKind_Linewise, isJump: true, move: moveToViewEdge},
+	"`":         {kind: motionKind_Exclusive, takesArgument: true, isJump: true, move: moveToMark},
+	"'":         {kind: motionKind_Linewise, takesArgument: true, isJump: true, move: moveToMark},
+
+	// These get swapped for the character find they're repeating before they run (see resolveCharacterFindRepeat), so
+	// their kind here is never used
+	";": {kind: motionKind_Inclusive, move: moveToCharacter},
+	",": {kind: motionKind_Inclusive, move: moveToCharacter},
+}
+
+// Moves the cursor by the command's motion on its own (i.e. without an operator), returning false if the motion
+// couldn't be completed
+func (model *Model) moveByMotion(cmd normalCommand) bool {
+	motionDef := motions[cmd.motion]
+	start := model.area.GetCursorPosition()
+	if !motionDef.move(model, cmd) {
+		return false
+	}
+	if motionDef.isJump {
+		model.recordJump(start)
+	}
+	return true
+}
+
+// The settings for each of the character find motions
+type characterFindParameters struct {
+	direction    textarea.CursorMovementDirection
+	stopPosition textarea.CharacterwiseMovementStopPosition
+
+	// The find motion that goes in the opposite direction (used by ",")
+	reverseMotion string
+}
+
+var characterFindMotions = map[string]characterFindParameters{
+	"f": {direction: textarea.CursorMovementDirection_Right, stopPosition: textarea.CharacterwiseMovementStopPosition_On, reverseMotion: "F"},
+	"F": {direction: textarea.CursorMovementDirection_Left, stopPosition: textarea.CharacterwiseMovementStopPosition_On, reverseMotion: "f"},
+	"t": {direction: textarea.CursorMovementDirection_Right, stopPosition: textarea.CharacterwiseMovementStopPosition_Before, reverseMotion: "T"},
+	"T": {direction: textarea.CursorMovementDirection_Left, stopPosition: textarea.CharacterwiseMovementStopPosition_Before, reverseMotion: "t"},
+}
+
+// The most recent "f", "F", "t", or "T", for repeating with ";" and ","
+type characterFind struct {
+	// Empty if there hasn't been a find yet
+	motion string
+
+	char rune
+}
+
+// ====================================================================================================
+//
+//	Motion Implementations
+//
+// ====================================================================================================
+func moveLeft(model *Model, cmd normalCommand) bool {
+	if model.area.GetCursorColumn() == 0 {
+		return false
+	}
+	model.area.SetCursorColumn(max(0, model.area.GetCursorColumn()-cmd.getCount()))
+	return true
+}
+
+func moveRight(model *Model, cmd normalCommand) bool {
+	// When an operator is pending the cursor is allowed to go one past the end of the line, so that "dl" on the last
+	// character of the line still deletes it
+	bindToLine := shouldBindToLineWhenMovingRight && !cmd.hasOperator()
+
+	oldCol := model.area.GetCursorColumn()
+	for i := 0; i < cmd.getCount(); i++ {
+		model.area.MoveCursorRightOneRune(bindToLine)
+	}
+	return model.area.GetCursorColumn() != oldCol
+}
+
+func moveDown(model *Model, cmd normalCommand) bool {
+	row := model.area.GetRow()
+	if row >= model.area.GetNumRows()-1 {
+		return false
+	}
+
+	// Operators work on logical lines, while plain cursor movement follows the soft-wrapped lines on the screen
+	if cmd.hasOperator() {
+		model.area.SetCursorPosition(textarea.Position{Row: row + cmd.getCount(), Col: model.area.GetCursorColumn()})
+		return true
+	}
+
+	// We want line-binding because we're in normal mode, so we shouldn't have the cursor beyond the end of the line
+	model.area.MoveCursorDownN(cmd.getCount(), true)
+	return true
+}
+
+func moveUp(model *Model, cmd normalCommand) bool {
+	row := model.area.GetRow()
+	if row == 0 && model.area.GetLineInfo().RowOffset == 0 {
+		return false
+	}
+
+	if cmd.hasOperator() {
+		if row == 0 {
+			return false
+		}
+		model.area.SetCursorPosition(textarea.Position{Row: row - cmd.getCount(), Col: model.area.GetCursorColumn()})
+		return true
+	}
+
+	// We want line-binding because we're in normal mode, so we shouldn't have the cursor beyond the end of the line
+	model.area.MoveCursorUpN(cmd.getCount(), true)
+	return true
+}
+
+func moveDownToFirstNonBlank(model *Model, cmd normalCommand) bool {
+	row := model.area.GetRow()
+	if row >= model.area.GetNumRows()-1 {
+		return false
+	}
+	moveToFirstNonBlankOfRow(model, row+cmd.getCount())
+	return true
+}
+
+func moveUpToFirstNonBlank(model *Model, cmd normalCommand) bool {
+	row := model.area.GetRow()
+	if row == 0 {
+		return false
+	}
+	moveToFirstNonBlankOfRow(model, row-cmd.getCount())
+	return true
+}
+
+func moveToFirstNonBlankOfLine(model *Model, cmd normalCommand) bool {
+	// A count moves that many lines down, counting the current line as the first
+	moveToFirstNonBlankOfRow(model, model.area.GetRow()+cmd.getCount()-1)
+	return true
+}
+
+func moveToLineStart(model *Model, cmd normalCommand) bool {
+	model.area.MoveCursorToLineStart()
+	return true
+}
+
+func moveToFirstNonBlank(model *Model, cmd normalCommand) bool {
+	model.area.MoveCursorToFirstNonBlank()
+	return true
+}
+
+func moveToLineEnd(model *Model, cmd normalCommand) bool {
+	// A count moves to the end of the line (count - 1) lines down
+	if cmd.getCount() > 1 {
+		targetRow := model.area.GetRow() + cmd.getCount() - 1
+		if targetRow >= model.area.GetNumRows() {
+			return false
+		}
+		model.area.SetCursorPosition(textarea.Position{Row: targetRow, Col: 0})
+	}
+	model.area.MoveCursorToLineEnd(true)
+	return true
+}
+
+func moveToWordStartForward(model *Model, cmd normalCommand) bool {
+	if model.moveByWords(cmd, textarea.CursorMovementDirection_Right, textarea.WordwiseMovementStopPosition_Incidence) {
+		return true
+	}
+
+	// We ran off the end of the buffer without finding another word; an operator should still get to act on the
+	// text up to the very end
+	if cmd.hasOperator() {
+		lastRow := model.area.GetNumRows() - 1
+		model.area.SetCursorPosition(textarea.Position{Row: lastRow, Col: model.area.GetLineLength(lastRow)})
+	}
+	return true
+}
+
+func moveToWordEndForward(model *Model, cmd normalCommand) bool {
+	model.moveByWords(cmd, textarea.CursorMovementDirection_Right, textarea.WordwiseMovementStopPosition_Terminus)
+	return true
+}
+
+func moveToWordStartBackward(model *Model, cmd normalCommand) bool {
+	model.moveByWords(cmd, textarea.CursorMovementDirection_Left, textarea.WordwiseMovementStopPosition_Terminus)
+	return true
+}
+
+func moveToWordEndBackward(model *Model, cmd normalCommand) bool {
+	model.moveByWords(cmd, textarea.CursorMovementDirection_Left, textarea.WordwiseMovementStopPosition_Incidence)
+	return true
+}
+
+// Moves by count words, or WORDs for the uppercase motions (e.g. "W" or "gE")
+func (model *Model) moveByWords(cmd normalCommand, direction textarea.CursorMovementDirection, stopPosition textarea.WordwiseMovementStopPosition) bool {
+	classify := model.getWordClassifier(isBigWordMotion(cmd.motion))
+	return model.area.MoveCursorByClassifiedWordN(cmd.getCount(), direction, stopPosition, classify)
+}
+
+func isBigWordMotion(motionName string) bool {
+	return motionName == "W" || motionName == "E" || motionName == "B" || motionName == "gE"
+}
+
+// ")" goes to the start of the count'th next sentence, and "(" to the start of the count'th previous one (which is
+// the start of the current sentence, if the cursor is past it)
+// Empty rows count as sentences too, like in Vim. Running out of sentences goes to the start or end of the buffer.
+func moveToSentenceStart(model *Model, cmd normalCommand) bool {
+	buffer := model.getFlatBuffer()
+	var stops []int
+	for _, span := range getSentenceSpans(buffer.text) {
+		stops = append(stops, span[0])
+	}
+	for row, rowStart := range buffer.rowStarts {
+		if model.area.GetLineLength(row) == 0 {
+			stops = append(stops, rowStart)
+		}
+	}
+	sort.Ints(stops)
+
+	idx := buffer.getIndex(model.area.GetCursorPosition())
+	for i := 0; i < cmd.getCount(); i++ {
+		if cmd.motion == "(" {
+			stopIdx := sort.SearchInts(stops, idx) - 1
+			if stopIdx < 0 {
+				idx = 0
+				break
+			}
+			idx = stops[stopIdx]
+			continue
+		}
+
+		stopIdx := sort.SearchInts(stops, idx+1)
+		if stopIdx >= len(stops) {
+			model.moveToBufferEnd(cmd)
+			return true
+		}
+		idx = stops[stopIdx]
+	}
+	model.area.SetCursorPosition(buffer.getPosition(idx))
+	return true
+}
+
+// "}" goes to the count'th next empty row after a paragraph, and "{" to the count'th previous one
+// Unlike the paragraph text objects, rows with only whitespace on them don't count as empty. Running out of
+// paragraphs goes to the start or end of the buffer.
+func moveToParagraphBoundary(model *Model, cmd normalCommand) bool {
+	direction := 1
+	if cmd.motion == "{" {
+		direction = -1
+	}
+	isEmptyRow := func(row int) bool {
+		return model.area.GetLineLength(row) == 0
+	}
+
+	row := model.area.GetRow()
+	lastRow := model.area.GetNumRows() - 1
+	for i := 0; i < cmd.getCount(); i++ {
+		// The boundary is the first empty row reached after passing over some text
+		hasPassedText := !isEmptyRow(row)
+		for row += direction; row >= 0 && row <= lastRow; row += direction {
+			if !isEmptyRow(row) {
+				hasPassedText = true
+			} else if hasPassedText {
+				break
+			}
+		}
+
+		if row > lastRow {
+			model.moveToBufferEnd(cmd)
+			return true
+		}
+		if row < 0 {
+			model.area.SetCursorPosition(textarea.Position{Row: 0, Col: 0})
+			return true
+		}
+	}
+	model.area.SetCursorPosition(textarea.Position{Row: row, Col: 0})
+	return true
+}
+
+// Goes to the last character of the buffer, or past it if an operator is pending so that the operator acts on the
+// text up to the very end
+func (model *Model) moveToBufferEnd(cmd normalCommand) {
+	lastRow := model.area.GetNumRows() - 1
+	endCol := model.area.GetLineLength(lastRow)
+	if !cmd.hasOperator() {
+		endCol = max(0, endCol-1)
+	}
+	model.area.SetCursorPosition(textarea.Position{Row: lastRow, Col: endCol})
+}
+
+// With a count, "gg" goes to that line number
+func moveToFirstRow(model *Model, cmd normalCommand) bool {
+	if cmd.count > 0 {
+		model.area.SetCursorRow(cmd.count - 1)
+		return true
+	}
+	model.area.MoveCursorToFirstRow()
+	return true
+}
+
+// With a count, "G" goes to that line number
+func moveToLastRow(model *Model, cmd normalCommand) bool {
+	if cmd.count > 0 {
+		model.area.SetCursorRow(cmd.count - 1)
+		return true
+	}
+	model.area.MoveCursorToLastRow()
+	return true
+}
+
+func moveToCharacter(model *Model, cmd normalCommand) bool {
+	findParams, found := characterFindMotions[cmd.motion]
+	if !found {
+		return false
+	}
+
+	if !cmd.isFindRepeat {
+		model.lastCharacterFind = characterFind{motion: cmd.motion, char: cmd.argument}
+	}
+
+	numOccurrences := cmd.getCount()
+
+	// Special case from Vim: repeating a "t" or "T" when the target character is right next to the cursor would just
+	// leave the cursor where it is, so we skip over that occurrence
+	if cmd.isFindRepeat && findParams.stopPosition == textarea.CharacterwiseMovementStopPosition_Before {
+		pos := model.area.GetCursorPosition()
+		line := model.area.GetLine(pos.Row)
+		adjacentCol := pos.Col + int(findParams.direction)
+		if adjacentCol >= 0 && adjacentCol < len(line) && line[adjacentCol] == cmd.argument {
+			numOccurrences++
+		}
+	}
+
+	return model.area.MoveCursorByCharacterN(numOccurrences, findParams.direction, findParams.stopPosition, cmd.argument)
+}
+
+// ====================================================================================================
+//
+//	Private Helper Functions
+//
+// ====================================================================================================
+// Converts ";" and "," into the character find motion that they're repeating
+// Returns false if there's no previous find to repeat
+func (model *Model) resolveCharacterFindRepeat(cmd normalCommand) (normalCommand, bool) {
+	if cmd.motion != ";" && cmd.motion != "," {
+		return cmd, true
+	}
+
+	lastFind := model.lastCharacterFind
+	if lastFind.motion == "" {
+		return cmd, false
+	}
+
+	if cmd.motion == "," {
+		cmd.motion = characterFindMotions[lastFind.motion].reverseMotion
+	} else {
+		cmd.motion = lastFind.motion
+	}
+	cmd.argument = lastFind.char
+	cmd.isFindRepeat = true
+	return cmd, true
+}
+
+func moveToFirstNonBlankOfRow(model *Model, row int) {
+	row = clamp(row, 0, model.area.GetNumRows()-1)
+	model.area.SetCursorPosition(textarea.Position{Row: row, Col: model.area.GetFirstNonBlankColumn(row)})
+}
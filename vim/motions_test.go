@@ -0,0 +1,68 @@
+package vim
+
+import "testing"
+
+func TestCharacterFindMotions(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a,b,c,d", 0, 0, "2f,", "a,b,c,d", 0, 3},
+		{"a,b,c,d", 0, 6, "F,", "a,b,c,d", 0, 5},
+		{"a,b,c,d", 0, 6, "T,", "a,b,c,d", 0, 6},
+		{"a b", 0, 0, "f ", "a b", 0, 1},
+		{"a,b,c,d", 0, 0, "fz", "a,b,c,d", 0, 0},
+
+		// ";" repeats the last find, and "," repeats it in the other direction
+		{"a,b,c,d", 0, 0, "f,;", "a,b,c,d", 0, 3},
+		{"a,b,c,d", 0, 0, "f,;;,", "a,b,c,d", 0, 3},
+		{"a,b,c,d", 0, 0, "t,;", "a,b,c,d", 0, 2},
+		{"a,b,c,d", 0, 6, "T,;", "a,b,c,d", 0, 4},
+
+		{"a(b, c)d", 0, 0, "dt)", ")d", 0, 0},
+		{"a)", 0, 0, "dt)", ")", 0, 0},
+		{"a(b, c)d", 0, 0, "cf,X<Esc>", "X c)d", 0, 0},
+		{"a,b,c,d", 0, 6, "dF,", "a,b,cd", 0, 5},
+		{"a,b,c,d", 0, 0, "f,d;", "ac,d", 0, 1},
+		{"a,b,c,d", 0, 0, "dfz", "a,b,c,d", 0, 0},
+	})
+}
+
+func TestParagraphMotions(t *testing.T) {
+	text := "a b\nc\n\nd e\nf\n\n\ng"
+	runKeysTests(t, []keysTest{
+		{text, 0, 0, "}", text, 2, 0},
+		{text, 0, 0, "}}", text, 5, 0},
+		{text, 0, 0, "3}", text, 7, 0},
+		{text, 0, 0, "9}", text, 7, 0},
+		{text, 7, 0, "{", text, 6, 0},
+		{text, 7, 0, "{{", text, 2, 0},
+		{text, 4, 0, "{", text, 2, 0},
+		{text, 4, 0, "2{", text, 0, 0},
+
+		// Deleting to a blank line is linewise only when it starts at the start of a line
+		{text, 0, 0, "d}", "\nd e\nf\n\n\ng", 0, 0},
+		{text, 0, 2, "d}", "a \n\nd e\nf\n\n\ng", 0, 1},
+		{text, 1, 0, "d{", "c\n\nd e\nf\n\n\ng", 0, 0},
+		{text, 3, 0, "y}P", "a b\nc\n\nd e\nf\nd e\nf\n\n\ng", 3, 0},
+		{"one\ntwo\n", 0, 0, "d}", "", 0, 0},
+		{"a\nb\n\nc", 0, 0, "v}d", "c", 0, 0},
+	})
+}
+
+func TestSentenceMotions(t *testing.T) {
+	text := "One. Two three. Four"
+	runKeysTests(t, []keysTest{
+		{text, 0, 0, ")", text, 0, 5},
+		{text, 0, 0, "))", text, 0, 16},
+		{text, 0, 0, ")))", text, 0, 19},
+		{text, 0, 18, "(", text, 0, 16},
+		{text, 0, 16, "(", text, 0, 5},
+		{text, 0, 16, "2(", text, 0, 0},
+		{text, 0, 0, "d)", "Two three. Four", 0, 0},
+		{text, 0, 5, "c)X <Esc>", "One. X Four", 0, 6},
+
+		// Blank lines and line ends end sentences too
+		{"One.\n\nTwo.", 0, 0, ")", "One.\n\nTwo.", 1, 0},
+		{"One.\n\nTwo.", 0, 0, "))", "One.\n\nTwo.", 2, 0},
+		{"One.\n\nTwo.", 2, 0, "(", "One.\n\nTwo.", 1, 0},
+		{"Hi there.\nNext line.", 0, 0, ")", "Hi there.\nNext line.", 1, 0},
+	})
+}
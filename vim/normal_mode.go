@@ -0,0 +1,702 @@
+package vim
+
+import (
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// The result of trying to parse the keys typed so far as a normal mode command
+type parseResult int
+
+const (
+	// The keys are the start of a valid command, so we should wait for more
+	parseResult_Incomplete parseResult = iota
+
+	// The keys can't be the start of any command, so they should be thrown away
+	parseResult_Invalid
+
+	// The keys form a complete command that's ready to execute
+	parseResult_Complete
+)
+
+// A fully-parsed normal mode command, following Vim's grammar of:
+//
+//	["register] [count] (operator [count] motion | operator operator | motion | action)
+type normalCommand struct {
+	// The number of times to repeat the command (0 if no count was given)
+	// When counts are given to both the operator and the motion, they are multiplied together (e.g. "2d3w" = "d6w")
+	count int
+
+	// The operator to apply (e.g. "d" or "gU"), if any
+	operator string
+
+	// Set when the operator was doubled (e.g. "dd" or "gUU"), meaning it should act on whole lines
+	isOperatorDoubled bool
+
+	// The motion to move by (or for the operator to act over), if any
+	motion string
+
+	// The text object for the operator to act on (e.g. "iw"), or to select in visual mode, if any
+	textObject string
+
+	// The non-operator, non-motion command to run (e.g. "p"), if any
+	action string
+
+	// The extra key given to commands that need one (e.g. the character to find for "f")
+	argument rune
+
+	// Set when a character find is being repeated by ";" or ","
+	isFindRepeat bool
+
+	// The register given with '"' (e.g. "a" for '"ayy'), or 0 if none was given
+	register rune
+
+	// The pattern typed for a "/" or "?" search, which is empty until the search's command line is submitted
+	searchPattern string
+}
+
+func (cmd normalCommand) hasOperator() bool {
+	return cmd.operator != ""
+}
+
+// Gets the count to use for the command, which defaults to 1 if none was given
+func (cmd normalCommand) getCount() int {
+	if cmd.count == 0 {
+		return 1
+	}
+	return cmd.count
+}
+
+type action struct {
+	// Whether the action modifies the buffer (and therefore needs a history checkpoint after it runs)
+	isChange bool
+
+	// Whether the action needs another key after it (e.g. the register to record into for "q")
+	takesArgument bool
+
+	execute func(model *Model, cmd normalCommand)
+}
+
+var actions = map[string]action{
+	"a":      {isChange: false, execute: appendAfterCursor},
+	"A":      {isChange: false, execute: appendAtLineEnd},
+	"i":      {isChange: false, execute: insertBeforeCursor},
+	"I":      {isChange: false, execute: insertAtFirstNonBlank},
+	"o":      {isChange: false, execute: openLineBelow},
+	"O":      {isChange: false, execute: openLineAbove},
+	"p":      {isChange: true, execute: putAfterCursor},
+	"P":      {isChange: true, execute: putBeforeCursor},
+	"u":      {isChange: false, execute: undo},
+	"ctrl+r": {isChange: false, execute: redo},
+	"g-":     {isChange: false, execute: moveThroughUndoStatesAction},
+	"g+":     {isChange: false, execute: moveThroughUndoStatesAction},
+	"J":      {isChange: true, execute: joinLines},
+	"gJ":     {isChange: true, execute: joinLines},
+	"~":      {isChange: true, execute: toggleCaseUnderCursor},
+	"v":      {isChange: false, execute: enterVisualModeAction},
+	"V":      {isChange: false, execute: enterVisualModeAction},
+	"ctrl+v": {isChange: false, execute: enterVisualModeAction},
+	"gv":     {isChange: false, execute: reselectLastSelection},
+	".":      {isChange: false, execute: repeatLastChange},
+	"q":      {isChange: false, takesArgument: true, execute: startRecordingMacro},
+	"@":      {isChange: false, takesArgument: true, execute: playMacro},
+	":":      {isChange: false, execute: openExCommandLineAction},
+	"&":      {isChange: true, execute: repeatSubstitutionOnLine},
+	"g&":     {isChange: true, execute: repeatSubstitutionEverywhere},
+	"zt":     {isChange: false, execute: scrollCursorRow},
+	"zz":     {isChange: false, execute: scrollCursorRow},
+	"zb":     {isChange: false, execute: scrollCursorRow},
+	"ctrl+e": {isChange: false, execute: scrollByRows},
+	"ctrl+y": {isChange: false, execute: scrollByRows},
+	"ctrl+d": {isChange: false, execute: scrollHalfPage},
+	"ctrl+u": {isChange: false, execute: scrollHalfPage},
+	"ctrl+f": {isChange: false, execute: scrollPage},
+	"ctrl+b": {isChange: false, execute: scrollPage},
+	"pgdown": {isChange: false, execute: scrollPage},
+	"pgup":   {isChange: false, execute: scrollPage},
+	"m":      {isChange: false, takesArgument: true, execute: setMarkAction},
+	"ctrl+o": {isChange: false, execute: moveThroughJumpListAction},
+	"tab":    {isChange: false, execute: moveThroughJumpListAction},
+	"R":      {isChange: false, execute: enterReplaceMode},
+	"r":      {isChange: true, takesArgument: true, execute: replaceCharacters},
+	"gr":     {isChange: true, takesArgument: true, execute: replaceVirtualCharacters},
+}
+
+// Commands that are shorthand for an operator + motion combination
+var commandAliases = map[string][]string{
+	"x": {"d", "l"},
+	"X": {"d", "h"},
+	"D": {"d", "$"},
+	"C": {"c", "$"},
+	"s": {"c", "l"},
+	"S": {"c", "c"},
+	"Y": {"y", "y"},
+}
+
+// Key names that are a single keypress, despite being multiple characters long
+var namedKeys = map[string]bool{
+	"left":      true,
+	"right":     true,
+	"up":        true,
+	"down":      true,
+	"enter":     true,
+	"backspace": true,
+	"delete":    true,
+	"esc":       true,
+	"tab":       true,
+	"home":      true,
+	"end":       true,
+	"pgup":      true,
+	"pgdown":    true,
+}
+
+// Handles a keypress in normal mode by adding it to the N-graph buffer, and running the command if the buffer
+// now holds a complete one
+func (model *Model) handleNormalModeKey(msg tea.KeyMsg) {
+	if len(model.nGraphBuffer) == 0 {
+		model.rememberCursorBeforeChange()
+	}
+	model.nGraphBuffer = append(model.nGraphBuffer, msg.String())
+
+	if model.isStopRecordingKey() {
+		model.stopRecordingMacro()
+		return
+	}
+
+	cmd, result := parseNormalCommand(model.nGraphBuffer)
+	switch result {
+	case parseResult_Incomplete:
+		return
+	case parseResult_Invalid:
+		model.nGraphBuffer = nil
+		model.abortReplay()
+		return
+	}
+	model.nGraphBuffer = nil
+
+	model.runNormalCommand(cmd)
+}
+
+// Runs the given command, along with everything that has to happen after a command (like checkpointing history)
+func (model *Model) runNormalCommand(cmd normalCommand) {
+	// Searches can't run until their pattern has been typed in
+	if cmd.isAwaitingSearchPattern() {
+		model.openSearchCommandLine(cmd, (*Model).runNormalCommand)
+		return
+	}
+
+	isChange := model.executeNormalCommand(cmd)
+
+	// Entering insert mode always counts as a change, since whatever gets typed will be part of it
+	if isChange || model.mode.isInsertOrReplace() {
+		model.recordChange(repeatableChange{
+			count:    cmd.count,
+			register: cmd.register,
+			keys:     getKeyMsgs(cmd.getKeyNames()),
+		})
+	}
+
+	if model.mode != NormalMode {
+		// We'll checkpoint when the user leaves insert (or visual) mode
+		return
+	}
+	model.bindCursorToLine()
+	if isChange {
+		model.CheckpointHistory()
+	}
+}
+
+// Runs the given command, returning whether it modified the buffer
+func (model *Model) executeNormalCommand(cmd normalCommand) bool {
+	cmd, canExecute := model.resolveCharacterFindRepeat(cmd)
+	if !canExecute {
+		return false
+	}
+
+	if cmd.hasOperator() {
+		model.executeOperator(cmd)
+		return operators[cmd.operator].isChange
+	}
+
+	if cmd.motion != "" {
+		if !model.moveByMotion(cmd) {
+			model.abortReplay()
+		}
+		return false
+	}
+
+	actionDef := actions[cmd.action]
+	actionDef.execute(model, cmd)
+	return actionDef.isChange
+}
+
+// Figures out the range of text that the operator's motion covers, and then applies the operator to it
+func (model *Model) executeOperator(cmd normalCommand) {
+	operatorDef := operators[cmd.operator]
+
+	// Like Vim, refuse to run rather than losing the text that would've gone in the register
+	if isReadOnlyRegister(cmd.register) {
+		return
+	}
+
+	if cmd.isOperatorDoubled {
+		operatorDef.apply(model, cmd, getCurrentLinesRange(model, cmd.getCount()))
+		return
+	}
+
+	// Special case from Vim: when the cursor is in a word, "cw" only changes up to the end of the word (like "ce")
+	if cmd.operator == "c" && (cmd.motion == "w" || cmd.motion == "W") && !model.isCursorOnWhitespace() {
+		isBigWord := isBigWordMotion(cmd.motion)
+		if isBigWord {
+			cmd.motion = "E"
+		} else {
+			cmd.motion = "e"
+		}
+
+		// If we're already on the end of a word then that word end counts as the first one the motion reaches
+		if model.isCursorOnWordEnd(isBigWord) {
+			cmd.count = cmd.getCount() - 1
+			if cmd.count == 0 {
+				cursorPos := model.area.GetCursorPosition()
+				operatorDef.apply(model, cmd, textRange{start: cursorPos, end: textarea.Position{Row: cursorPos.Row, Col: cursorPos.Col + 1}})
+				return
+			}
+		}
+	}
+
+	if cmd.textObject != "" {
+		rng, found := model.selectTextObject(cmd)
+		if !found {
+			model.abortReplay()
+			return
+		}
+		model.area.SetCursorPosition(rng.start)
+		operatorDef.apply(model, cmd, rng)
+		return
+	}
+
+	motionDef := motions[cmd.motion]
+	start := model.area.GetCursorPosition()
+	if !motionDef.move(model, cmd) {
+		model.area.SetCursorPosition(start)
+		model.abortReplay()
+		return
+	}
+	end := model.area.GetCursorPosition()
+
+	// The operator decides where the cursor ends up
+	model.area.SetCursorPosition(start)
+	operatorDef.apply(model, cmd, getMotionRange(model, motionDef, cmd.motion, start, end))
+}
+
+// Keeps the cursor on top of a character, since (unlike insert mode) normal mode doesn't allow the cursor to be
+// past the end of the line
+func (model *Model) bindCursorToLine() {
+	lineLength := model.area.GetLineLength(model.area.GetRow())
+	if model.area.GetCursorColumn() >= lineLength && lineLength > 0 {
+		model.area.SetCursorColumn(lineLength - 1)
+	}
+}
+
+func (model *Model) isCursorOnWhitespace() bool {
+	pos := model.area.GetCursorPosition()
+	line := model.area.GetLine(pos.Row)
+	return pos.Col >= len(line) || unicode.IsSpace(line[pos.Col])
+}
+
+func (model *Model) isCursorOnWordEnd(isBigWord bool) bool {
+	pos := model.area.GetCursorPosition()
+	line := model.area.GetLine(pos.Row)
+	return pos.Col+1 >= len(line) || model.getCharClass(line[pos.Col+1], isBigWord) != model.getCharClass(line[pos.Col], isBigWord)
+}
+
+// ====================================================================================================
+//
+//	Parsing
+//
+// ====================================================================================================
+// Parses the keys typed so far in normal mode
+func parseNormalCommand(keys []string) (normalCommand, parseResult) {
+	cmd, numPrefixKeys, result := parseCommandPrefix(keys)
+	if result != parseResult_Complete {
+		return cmd, result
+	}
+	prefixKeys := keys[:numPrefixKeys]
+	keys = keys[numPrefixKeys:]
+
+	var candidateNames []string
+	for name := range operators {
+		candidateNames = append(candidateNames, name)
+	}
+	for name := range motions {
+		candidateNames = append(candidateNames, name)
+	}
+	for name := range actions {
+		candidateNames = append(candidateNames, name)
+	}
+	for name := range commandAliases {
+		candidateNames = append(candidateNames, name)
+	}
+
+	name, numKeysConsumed, result := matchCommandName(keys, candidateNames)
+	if result != parseResult_Complete {
+		return cmd, result
+	}
+	remainingKeys := keys[numKeysConsumed:]
+
+	if expansion, found := commandAliases[name]; found {
+		expandedKeys := append(append(append([]string{}, prefixKeys...), expansion...), remainingKeys...)
+		return parseNormalCommand(expandedKeys)
+	}
+
+	if _, found := operators[name]; found {
+		cmd.operator = name
+		return parseOperatorTarget(cmd, remainingKeys)
+	}
+
+	if motionDef, found := motions[name]; found {
+		cmd.motion = name
+		if motionDef.takesArgument {
+			return parseArgument(cmd, remainingKeys)
+		}
+		return cmd, parseResult_Complete
+	}
+
+	cmd.action = name
+	if actions[name].takesArgument {
+		return parseArgument(cmd, remainingKeys)
+	}
+	return cmd, parseResult_Complete
+}
+
+// Parses the count and register that can come before a command, in either order (e.g. '2"ayy' or '"a2yy')
+// Returns how many keys were consumed
+func parseCommandPrefix(keys []string) (normalCommand, int, parseResult) {
+	cmd := normalCommand{}
+
+	count, numKeysConsumed := parseCount(keys)
+	cmd.count = count
+	if numKeysConsumed >= len(keys) || keys[numKeysConsumed] != `"` {
+		return cmd, numKeysConsumed, parseResult_Complete
+	}
+
+	if numKeysConsumed+1 >= len(keys) {
+		return cmd, 0, parseResult_Incomplete
+	}
+	registerName, isValid := keyToRune(keys[numKeysConsumed+1])
+	if !isValid || !isValidRegisterName(registerName) {
+		return cmd, 0, parseResult_Invalid
+	}
+	// Naming the unnamed register is the same as not naming one
+	if registerName != unnamedRegister {
+		cmd.register = registerName
+	}
+	numKeysConsumed += 2
+
+	secondCount, numSecondCountKeys := parseCount(keys[numKeysConsumed:])
+	if secondCount > 0 {
+		cmd.count = max(1, cmd.count) * secondCount
+	}
+	return cmd, numKeysConsumed + numSecondCountKeys, parseResult_Complete
+}
+
+// Parses the keys after an operator, which must be a motion, a text object, or the operator again
+func parseOperatorTarget(cmd normalCommand, keys []string) (normalCommand, parseResult) {
+	motionCount, numCountKeys := parseCount(keys)
+	keys = keys[numCountKeys:]
+	if motionCount > 0 {
+		cmd.count = max(1, cmd.count) * motionCount
+	}
+
+	// Doubling the operator acts on the current line, and operators beginning with "g" also allow omitting the
+	// second "g" (e.g. "gUU")
+	doubledOperatorNames := []string{cmd.operator}
+	if len(cmd.operator) == 2 && cmd.operator[0] == 'g' {
+		doubledOperatorNames = append(doubledOperatorNames, cmd.operator[1:])
+	}
+
+	candidateNames := append([]string{}, doubledOperatorNames...)
+	for name := range motions {
+		candidateNames = append(candidateNames, name)
+	}
+	for name := range textObjects {
+		candidateNames = append(candidateNames, name)
+	}
+
+	name, numKeysConsumed, result := matchCommandName(keys, candidateNames)
+	if result != parseResult_Complete {
+		return cmd, result
+	}
+
+	if _, found := textObjects[name]; found {
+		cmd.textObject = name
+		return cmd, parseResult_Complete
+	}
+
+	for _, doubledOperatorName := range doubledOperatorNames {
+		if name == doubledOperatorName {
+			cmd.isOperatorDoubled = true
+			return cmd, parseResult_Complete
+		}
+	}
+
+	cmd.motion = name
+	if motions[name].takesArgument {
+		return parseArgument(cmd, keys[numKeysConsumed:])
+	}
+	return cmd, parseResult_Complete
+}
+
+// Parses the single key that a command takes as its argument
+func parseArgument(cmd normalCommand, keys []string) (normalCommand, parseResult) {
+	if len(keys) == 0 {
+		return cmd, parseResult_Incomplete
+	}
+
+	argument, isValid := keyToRune(keys[0])
+	if !isValid {
+		return cmd, parseResult_Invalid
+	}
+	cmd.argument = argument
+	return cmd, parseResult_Complete
+}
+
+// Gets the character that a keypress types, if any
+func keyToRune(key string) (rune, bool) {
+	switch key {
+	case "tab":
+		return '\t', true
+	case "enter":
+		return '\n', true
+	}
+
+	runes := []rune(key)
+	if len(runes) != 1 {
+		return 0, false
+	}
+	return runes[0], true
+}
+
+// Parses the count at the start of the keys (if any), returning the count and how many keys it consumed
+// A count can't start with "0", because that's the "go to start of line" motion
+func parseCount(keys []string) (int, int) {
+	count := 0
+	numKeysConsumed := 0
+	for _, key := range keys {
+		if len(key) != 1 || key[0] < '0' || key[0] > '9' || (key == "0" && numKeysConsumed == 0) {
+			break
+		}
+		count = count*10 + int(key[0]-'0')
+		numKeysConsumed++
+	}
+	return count, numKeysConsumed
+}
+
+// Checks whether the keys begin with one of the candidate command names
+// Returns the name that matched, and how many keys it consumed
+func matchCommandName(keys []string, candidateNames []string) (string, int, parseResult) {
+	result := parseResult_Invalid
+	for _, candidateName := range candidateNames {
+		candidateKeys := splitKeyName(candidateName)
+		if len(keys) >= len(candidateKeys) {
+			if areKeysEqual(keys[:len(candidateKeys)], candidateKeys) {
+				return candidateName, len(candidateKeys), parseResult_Complete
+			}
+		} else if areKeysEqual(keys, candidateKeys[:len(keys)]) {
+			result = parseResult_Incomplete
+		}
+	}
+	return "", 0, result
+}
+
+// Splits a command name into the keypresses needed to type it (e.g. "gU" -> ["g", "U"], but "ctrl+r" -> ["ctrl+r"])
+func splitKeyName(name string) []string {
+	if namedKeys[name] || strings.HasPrefix(name, "ctrl+") || strings.HasPrefix(name, "alt+") || strings.HasPrefix(name, "shift+") {
+		return []string{name}
+	}
+
+	result := make([]string, 0, len(name))
+	for _, char := range name {
+		result = append(result, string(char))
+	}
+	return result
+}
+
+func areKeysEqual(first []string, second []string) bool {
+	if len(first) != len(second) {
+		return false
+	}
+	for idx := range first {
+		if first[idx] != second[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// ====================================================================================================
+//
+//	Action Implementations
+//
+// ====================================================================================================
+func appendAfterCursor(model *Model, cmd normalCommand) {
+	// This is a deviation from Vim, but I'm fine with it
+	model.area.MoveCursorRightOneRune(false)
+	model.rememberCursorBeforeChange()
+	model.mode = InsertMode
+}
+
+func appendAtLineEnd(model *Model, cmd normalCommand) {
+	model.area.MoveCursorToLineEnd(false)
+	model.rememberCursorBeforeChange()
+	model.mode = InsertMode
+}
+
+func insertBeforeCursor(model *Model, cmd normalCommand) {
+	model.mode = InsertMode
+}
+
+func insertAtFirstNonBlank(model *Model, cmd normalCommand) {
+	model.area.MoveCursorToFirstNonBlank()
+	model.rememberCursorBeforeChange()
+	model.mode = InsertMode
+}
+
+func openLineBelow(model *Model, cmd normalCommand) {
+	model.area.InsertLineBelow()
+	model.area.SetCursorPosition(textarea.Position{Row: model.area.GetRow() + 1, Col: 0})
+	model.mode = InsertMode
+}
+
+func openLineAbove(model *Model, cmd normalCommand) {
+	// Inserting the line above pushes the cursor's row down by one
+	model.area.InsertLineAbove()
+	model.area.SetCursorPosition(textarea.Position{Row: model.area.GetRow() - 1, Col: 0})
+	model.mode = InsertMode
+}
+
+func putAfterCursor(model *Model, cmd normalCommand) {
+	putRegister(model, cmd, true)
+}
+
+func putBeforeCursor(model *Model, cmd normalCommand) {
+	putRegister(model, cmd, false)
+}
+
+// Joins the count lines starting at the cursor's line (with a minimum of two), where "gJ" leaves the whitespace
+// between them alone
+func joinLines(model *Model, cmd normalCommand) {
+	row := model.area.GetRow()
+	// Like in Vim, a count going past the last line joins up to the last line
+	endRow := min(row+max(cmd.getCount(), 2)-1, model.area.GetNumRows()-1)
+	if endRow == row {
+		return
+	}
+	model.area.JoinLines(row, endRow, cmd.action == "J")
+}
+
+// "~" toggles the case of the count characters starting at the cursor, and moves the cursor past them
+func toggleCaseUnderCursor(model *Model, cmd normalCommand) {
+	pos := model.area.GetCursorPosition()
+	lineLength := model.area.GetLineLength(pos.Row)
+	if lineLength == 0 {
+		return
+	}
+	end := textarea.Position{Row: pos.Row, Col: min(pos.Col+cmd.getCount(), lineLength)}
+	mapRangeRunes(model, textRange{start: pos, end: end}, toggleRuneCase)
+	model.area.SetCursorPosition(textarea.Position{Row: pos.Row, Col: min(end.Col, lineLength-1)})
+}
+
+// Puts the contents of the command's register into the buffer (count times), with linewise text going on its own
+// lines and blockwise text going in a block starting at the cursor
+func putRegister(model *Model, cmd normalCommand, isAfterCursor bool) {
+	reg := model.getRegister(cmd.register)
+	if reg.text == "" {
+		return
+	}
+
+	switch reg.kind {
+	case rangeKind_Linewise:
+		putLines(model, reg, cmd.getCount(), isAfterCursor)
+	case rangeKind_Blockwise:
+		putBlock(model, reg, cmd.getCount(), isAfterCursor)
+	default:
+		putCharacters(model, reg, cmd.getCount(), isAfterCursor)
+	}
+}
+
+// Puts the text inline, leaving the cursor on the last character put (or on the first one, if the text spans lines)
+func putCharacters(model *Model, reg register, count int, isAfterCursor bool) {
+	pos := model.area.GetCursorPosition()
+	if isAfterCursor && model.area.GetLineLength(pos.Row) > 0 {
+		pos.Col++
+	}
+
+	text := strings.Repeat(reg.text, count)
+	model.area.ReplaceRange(pos, pos, text)
+	if !strings.Contains(text, "\n") {
+		pos.Col += len([]rune(text)) - 1
+	}
+	model.area.SetCursorPosition(pos)
+}
+
+// Puts the text on new lines below (or above) the cursor's line, leaving the cursor on the first non-blank of the first
+// new line
+func putLines(model *Model, reg register, count int, isAfterCursor bool) {
+	lines := strings.Split(strings.TrimSuffix(reg.text, "\n"), "\n")
+	var allLines []string
+	for i := 0; i < count; i++ {
+		allLines = append(allLines, lines...)
+	}
+
+	row := model.area.GetRow()
+	if isAfterCursor {
+		row++
+	}
+	model.area.InsertLines(row, allLines)
+	moveToFirstNonBlankOfRow(model, row)
+}
+
+// Puts each line of the text into the rows starting at the cursor's, all at the same column (adding rows to the end of
+// the buffer if needed), leaving the cursor at the block's top-left corner
+func putBlock(model *Model, reg register, count int, isAfterCursor bool) {
+	pos := model.area.GetCursorPosition()
+	if isAfterCursor && model.area.GetLineLength(pos.Row) > 0 {
+		pos.Col++
+	}
+
+	blockLines := strings.Split(reg.text, "\n")
+	blockWidth := 0
+	for _, blockLine := range blockLines {
+		blockWidth = max(blockWidth, len([]rune(blockLine)))
+	}
+
+	for idx, blockLine := range blockLines {
+		row := pos.Row + idx
+		if row >= model.area.GetNumRows() {
+			model.area.InsertLines(row, []string{""})
+		}
+
+		line := model.area.GetLine(row)
+		if len(line) < pos.Col {
+			line = append(line, []rune(strings.Repeat(" ", pos.Col-len(line)))...)
+		}
+
+		// Keeps the text after the block lined up, as long as there is some
+		blockRunes := []rune(blockLine)
+		if pos.Col < len(line) {
+			blockRunes = append(blockRunes, []rune(strings.Repeat(" ", blockWidth-len(blockRunes)))...)
+		}
+
+		newLine := append([]rune{}, line[:pos.Col]...)
+		for i := 0; i < count; i++ {
+			newLine = append(newLine, blockRunes...)
+		}
+		newLine = append(newLine, line[pos.Col:]...)
+		model.area.SetLine(row, newLine)
+	}
+	model.area.SetCursorPosition(pos)
+}
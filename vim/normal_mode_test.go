@@ -0,0 +1,33 @@
+package vim
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCounts(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nb\nc\nd\ne\nf\ng", 0, 0, "5j", "a\nb\nc\nd\ne\nf\ng", 5, 0},
+		{"a b c d e", 0, 0, "3w", "a b c d e", 0, 6},
+		{"abc", 0, 0, "5l", "abc", 0, 2},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11", 0, 0, "10G", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11", 9, 0},
+		{"a\nb\nc\nd", 0, 0, "2dd", "c\nd", 0, 0},
+		{"a\nb\nc", 0, 0, "5dd", "", 0, 0},
+		{"a b c d e", 0, 0, "d3w", "d e", 0, 0},
+		{"a\nb\nc\nd", 0, 0, "d2j", "d", 0, 0},
+		{"abcdef", 0, 1, "3x", "aef", 0, 1},
+		{"ab", 0, 0, "yl4p", "aaaaab", 0, 4},
+		{"abc def ghi", 0, 2, "c2wX<Esc>", "abX ghi", 0, 2},
+
+		// The counts before the operator and the motion multiply
+		{"a b c d e f g h", 0, 0, "2d3w", "g h", 0, 0},
+	})
+}
+
+func TestPendingCommandIsShown(t *testing.T) {
+	model := newTestModel("abc")
+	sendKeys(model, "2d3")
+	if statusBar := model.renderStatusBar(); !strings.Contains(statusBar, "2d3") {
+		t.Errorf("status bar %q doesn't show the pending command", statusBar)
+	}
+}
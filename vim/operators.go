@@ -0,0 +1,367 @@
+package vim
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// Determines how the text between the start and end of a range is interpreted
+type rangeKind int
+
+const (
+	// Every rune from the start to the end
+	rangeKind_Characterwise rangeKind = iota
+
+	// Every row from the start row to the end row, in its entirety
+	rangeKind_Linewise
+
+	// The rectangle with the start and end at its corners
+	rangeKind_Blockwise
+)
+
+// The region of text that an operator acts on
+type textRange struct {
+	// Always at or before end (and for blockwise ranges, the top-left corner)
+	start textarea.Position
+
+	// For characterwise and blockwise ranges the column is exclusive; for linewise ranges only the row matters
+	end textarea.Position
+
+	kind rangeKind
+}
+
+type operator struct {
+	// Whether the operator modifies the buffer (and therefore needs a history checkpoint after it runs)
+	isChange bool
+
+	apply func(model *Model, cmd normalCommand, rng textRange)
+}
+
+var operators = map[string]operator{
+	"d":  {isChange: true, apply: applyDelete},
+	"c":  {isChange: true, apply: applyChange},
+	"y":  {isChange: false, apply: applyYank},
+	">":  {isChange: true, apply: applyShiftRight},
+	"<":  {isChange: true, apply: applyShiftLeft},
+	"g~": {isChange: true, apply: applyToggleCase},
+	"gu": {isChange: true, apply: applyLowercase},
+	"gU": {isChange: true, apply: applyUppercase},
+	"=":  {isChange: true, apply: applyReindent},
+}
+
+// Joining lines is only an operator in visual mode; in normal mode "J" and "gJ" take a count of lines instead of a
+// motion
+var joinOperator = operator{isChange: true, apply: applyJoin}
+var joinWithoutSpacesOperator = operator{isChange: true, apply: applyJoinWithoutSpaces}
+
+// Converts the cursor movement that a motion made into the range of text that an operator should act on
+func getMotionRange(model *Model, motionDef motion, motionName string, start textarea.Position, end textarea.Position) textRange {
+	if end.IsBefore(start) {
+		start, end = end, start
+	}
+
+	switch motionDef.kind {
+	case motionKind_Linewise:
+		return textRange{start: start, end: end, kind: rangeKind_Linewise}
+	case motionKind_Inclusive:
+		end.Col = min(end.Col+1, model.area.GetLineLength(end.Row))
+		return textRange{start: start, end: end}
+	}
+
+	// Special case from Vim: when "w" is used with an operator and the last word moved over is at the end of a line,
+	// the end of that word becomes the end of the operated text (rather than the first word of the next line)
+	if (motionName == "w" || motionName == "W") && end.Row > start.Row && end.Col <= model.area.GetFirstNonBlankColumn(end.Row) {
+		end = textarea.Position{Row: end.Row - 1, Col: model.area.GetLineLength(end.Row - 1)}
+	}
+
+	// Vim's rules for exclusive motions that end at the start of a line (see ":help exclusive")
+	if end.Row > start.Row && end.Col == 0 {
+		end = textarea.Position{Row: end.Row - 1, Col: model.area.GetLineLength(end.Row - 1)}
+		if start.Col <= model.area.GetFirstNonBlankColumn(start.Row) {
+			return textRange{start: start, end: end, kind: rangeKind_Linewise}
+		}
+	}
+
+	return textRange{start: start, end: end}
+}
+
+// Gets the range covering the cursor's line and the (count - 1) lines below it, as used by "dd", "yy", etc.
+func getCurrentLinesRange(model *Model, count int) textRange {
+	row := model.area.GetRow()
+	lastRow := min(row+count-1, model.area.GetNumRows()-1)
+	return textRange{
+		start: textarea.Position{Row: row, Col: 0},
+		end:   textarea.Position{Row: lastRow, Col: 0},
+		kind:  rangeKind_Linewise,
+	}
+}
+
+// Gets the text in the range; linewise text always ends in a newline, and blockwise text has one line per row
+func getRangeText(model *Model, rng textRange) string {
+	switch rng.kind {
+	case rangeKind_Linewise:
+		return strings.Join(model.area.GetLines(rng.start.Row, rng.end.Row), "\n") + "\n"
+	case rangeKind_Blockwise:
+		blockLines := make([]string, 0, rng.end.Row-rng.start.Row+1)
+		for row := rng.start.Row; row <= rng.end.Row; row++ {
+			line := model.area.GetLine(row)
+			leftCol, rightCol := clampBlockColumns(rng, len(line))
+			blockLines = append(blockLines, string(line[leftCol:rightCol]))
+		}
+		return strings.Join(blockLines, "\n")
+	}
+	return model.area.GetTextInRange(rng.start, rng.end)
+}
+
+// Gets the columns of the block that fall within a row of the given length
+func clampBlockColumns(rng textRange, lineLength int) (int, int) {
+	return min(rng.start.Col, lineLength), min(rng.end.Col, lineLength)
+}
+
+// Removes the block's columns from every row it covers
+func deleteBlock(model *Model, rng textRange) {
+	for row := rng.start.Row; row <= rng.end.Row; row++ {
+		line := model.area.GetLine(row)
+		leftCol, rightCol := clampBlockColumns(rng, len(line))
+		model.area.SetLine(row, append(line[:leftCol], line[rightCol:]...))
+	}
+}
+
+// ====================================================================================================
+//
+//	Operator Implementations
+//
+// ====================================================================================================
+func applyDelete(model *Model, cmd normalCommand, rng textRange) {
+	model.storeDeletedText(cmd, register{text: getRangeText(model, rng), kind: rng.kind})
+
+	switch rng.kind {
+	case rangeKind_Linewise:
+		model.area.DeleteLines(rng.start.Row, rng.end.Row)
+		model.area.SetCursorPosition(textarea.Position{Row: rng.start.Row, Col: 0})
+		model.area.MoveCursorToFirstNonBlank()
+	case rangeKind_Blockwise:
+		deleteBlock(model, rng)
+		model.area.SetCursorPosition(rng.start)
+	default:
+		model.area.DeleteRange(rng.start, rng.end)
+	}
+}
+
+func applyChange(model *Model, cmd normalCommand, rng textRange) {
+	model.storeDeletedText(cmd, register{text: getRangeText(model, rng), kind: rng.kind})
+
+	switch rng.kind {
+	case rangeKind_Linewise:
+		// Changing lines leaves a single empty line behind to type into
+		if rng.end.Row > rng.start.Row {
+			model.area.DeleteLines(rng.start.Row+1, rng.end.Row)
+		}
+		model.area.SetLine(rng.start.Row, []rune{})
+		model.area.SetCursorPosition(textarea.Position{Row: rng.start.Row, Col: 0})
+	case rangeKind_Blockwise:
+		deleteBlock(model, rng)
+		model.area.SetCursorPosition(rng.start)
+
+		// Whatever gets typed on the first row will be copied to the rest of the rows when insert mode ends
+		if rng.end.Row > rng.start.Row {
+			model.pendingBlockInsert = &blockInsert{
+				startRow:           rng.start.Row,
+				endRow:             rng.end.Row,
+				col:                rng.start.Col,
+				originalLineLength: model.area.GetLineLength(rng.start.Row),
+				originalNumRows:    model.area.GetNumRows(),
+			}
+		}
+	default:
+		model.area.DeleteRange(rng.start, rng.end)
+	}
+	model.mode = InsertMode
+}
+
+func applyYank(model *Model, cmd normalCommand, rng textRange) {
+	model.storeYankedText(cmd, register{text: getRangeText(model, rng), kind: rng.kind})
+
+	// The column of "]" is inclusive, unlike the range's end
+	lastYanked := rng.end
+	switch {
+	case rng.kind == rangeKind_Linewise:
+		lastYanked.Col = max(0, model.area.GetLineLength(rng.end.Row)-1)
+	case lastYanked.Col > 0:
+		lastYanked.Col--
+	}
+	model.markChangedText(rng.start, lastYanked, false)
+
+	if rng.kind == rangeKind_Linewise {
+		// Vim leaves the column alone when yanking lines, only moving the cursor up if it was below the range
+		if model.area.GetRow() != rng.start.Row {
+			model.area.SetCursorPosition(textarea.Position{Row: rng.start.Row, Col: model.area.GetCursorColumn()})
+		}
+		return
+	}
+	model.area.SetCursorPosition(rng.start)
+}
+
+func applyShiftRight(model *Model, cmd normalCommand, rng textRange) {
+	for row := rng.start.Row; row <= rng.end.Row; row++ {
+		// Vim doesn't indent empty lines
+		if model.area.GetLineLength(row) == 0 {
+			continue
+		}
+		model.setIndentWidth(row, model.getIndentWidth(row)+model.getShiftWidth())
+	}
+	model.area.SetCursorPosition(textarea.Position{Row: rng.start.Row, Col: 0})
+	model.area.MoveCursorToFirstNonBlank()
+}
+
+func applyShiftLeft(model *Model, cmd normalCommand, rng textRange) {
+	for row := rng.start.Row; row <= rng.end.Row; row++ {
+		model.setIndentWidth(row, max(0, model.getIndentWidth(row)-model.getShiftWidth()))
+	}
+	model.area.SetCursorPosition(textarea.Position{Row: rng.start.Row, Col: 0})
+	model.area.MoveCursorToFirstNonBlank()
+}
+
+// Without any indenting rules to go by, Vim's "=" indents each line like 'autoindent' would, which gives every line
+// the indent of the last non-blank line above the range (and empties the lines that are only whitespace)
+func applyReindent(model *Model, cmd normalCommand, rng textRange) {
+	indentWidth := 0
+	for row := rng.start.Row - 1; row >= 0; row-- {
+		if !isBlankLine(model.area.GetLine(row)) {
+			indentWidth = model.getIndentWidth(row)
+			break
+		}
+	}
+
+	for row := rng.start.Row; row <= rng.end.Row; row++ {
+		if isBlankLine(model.area.GetLine(row)) {
+			model.area.SetLine(row, []rune{})
+			continue
+		}
+		model.setIndentWidth(row, indentWidth)
+	}
+	model.area.SetCursorPosition(textarea.Position{Row: rng.start.Row, Col: 0})
+	model.area.MoveCursorToFirstNonBlank()
+}
+
+func applyToggleCase(model *Model, cmd normalCommand, rng textRange) {
+	mapRangeRunes(model, rng, toggleRuneCase)
+}
+
+func applyLowercase(model *Model, cmd normalCommand, rng textRange) {
+	mapRangeRunes(model, rng, unicode.ToLower)
+}
+
+func applyUppercase(model *Model, cmd normalCommand, rng textRange) {
+	mapRangeRunes(model, rng, unicode.ToUpper)
+}
+
+func applyJoin(model *Model, cmd normalCommand, rng textRange) {
+	// Joining always involves at least two lines, even if the range only covers one
+	endRow := max(rng.end.Row, rng.start.Row+1)
+	if endRow >= model.area.GetNumRows() {
+		return
+	}
+	model.area.JoinLines(rng.start.Row, endRow, true)
+}
+
+func applyJoinWithoutSpaces(model *Model, cmd normalCommand, rng textRange) {
+	endRow := max(rng.end.Row, rng.start.Row+1)
+	if endRow >= model.area.GetNumRows() {
+		return
+	}
+	model.area.JoinLines(rng.start.Row, endRow, false)
+}
+
+// Replaces every rune in the range with the result of the mapping function, leaving the cursor at the start of the
+// range
+func mapRangeRunes(model *Model, rng textRange, mapping func(rune) rune) {
+	start, end := rng.start, rng.end
+	switch rng.kind {
+	case rangeKind_Linewise:
+		start = textarea.Position{Row: rng.start.Row, Col: 0}
+		end = textarea.Position{Row: rng.end.Row, Col: model.area.GetLineLength(rng.end.Row)}
+	case rangeKind_Blockwise:
+		for row := rng.start.Row; row <= rng.end.Row; row++ {
+			line := model.area.GetLine(row)
+			leftCol, rightCol := clampBlockColumns(rng, len(line))
+			for col := leftCol; col < rightCol; col++ {
+				line[col] = mapping(line[col])
+			}
+			model.area.SetLine(row, line)
+		}
+		model.area.SetCursorPosition(start)
+		return
+	}
+
+	text := model.area.GetTextInRange(start, end)
+	model.area.ReplaceRange(start, end, strings.Map(mapping, text))
+	model.area.SetCursorPosition(start)
+}
+
+// Gets the number of columns that the row's leading whitespace takes up, with tabs going to the next tab stop
+func (model *Model) getIndentWidth(row int) int {
+	width := 0
+	for _, char := range model.area.GetLine(row) {
+		switch char {
+		case ' ':
+			width++
+		case '\t':
+			width += model.getTabStop() - width%model.getTabStop()
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// Replaces the row's leading whitespace with an indent of the given width, made of spaces if "expandtab" is set and
+// of as many tabs as possible otherwise
+func (model *Model) setIndentWidth(row int, width int) {
+	line := model.area.GetLine(row)
+	numIndentRunes := 0
+	for numIndentRunes < len(line) && (line[numIndentRunes] == ' ' || line[numIndentRunes] == '\t') {
+		numIndentRunes++
+	}
+
+	var indent string
+	if model.Settings.ExpandTab {
+		indent = strings.Repeat(" ", width)
+	} else {
+		indent = strings.Repeat("\t", width/model.getTabStop()) + strings.Repeat(" ", width%model.getTabStop())
+	}
+	model.area.SetLine(row, append([]rune(indent), line[numIndentRunes:]...))
+}
+
+// Gets the number of columns that ">" and "<" shift by, which is the tab stop when "shiftwidth" is 0 (like in Vim)
+func (model *Model) getShiftWidth() int {
+	if model.Settings.ShiftWidth <= 0 {
+		return model.getTabStop()
+	}
+	return model.Settings.ShiftWidth
+}
+
+func (model *Model) getTabStop() int {
+	if model.Settings.TabStop <= 0 {
+		return DefaultSettings().TabStop
+	}
+	return model.Settings.TabStop
+}
+
+func isBlankLine(line []rune) bool {
+	for _, char := range line {
+		if !unicode.IsSpace(char) {
+			return false
+		}
+	}
+	return true
+}
+
+func toggleRuneCase(char rune) rune {
+	if unicode.IsUpper(char) {
+		return unicode.ToLower(char)
+	}
+	return unicode.ToUpper(char)
+}
@@ -0,0 +1,85 @@
+package vim
+
+import "testing"
+
+func TestOperatorsWithMotions(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"foo bar baz", 0, 0, "dw", "bar baz", 0, 0},
+		{"foo bar baz", 0, 4, "dw", "foo baz", 0, 4},
+		{"foo bar baz", 0, 8, "dw", "foo bar ", 0, 7},
+		{"foo bar\nbaz", 0, 4, "dw", "foo \nbaz", 0, 3},
+		{"foo\nbar", 0, 0, "dw", "\nbar", 0, 0},
+		{"foo bar", 0, 4, "de", "foo ", 0, 3},
+		{"foo bar baz", 0, 4, "d$", "foo ", 0, 3},
+		{"  foo bar", 0, 6, "d^", "  bar", 0, 2},
+		{"a\nb\nc\nd", 1, 0, "dG", "a", 0, 0},
+		{"a\nb\nc\nd", 2, 0, "dgg", "d", 0, 0},
+		{"a\nb\nc", 0, 0, "dj", "c", 0, 0},
+		{"a\nb\nc", 2, 0, "dk", "a", 0, 0},
+		{"foo bar baz", 0, 0, "cwX<Esc>", "X bar baz", 0, 0},
+		{"foo bar baz", 0, 0, "ceY<Esc>", "Y bar baz", 0, 0},
+		{"foo bar", 0, 0, "yw", "foo bar", 0, 0},
+		{"foo bar baz", 0, 8, "yb", "foo bar baz", 0, 4},
+		{"abc def", 0, 0, "gUw", "ABC def", 0, 0},
+		{"abc def", 0, 0, "g~e", "ABC def", 0, 0},
+		{"a\nb", 0, 0, ">j", "    a\n    b", 0, 4},
+	})
+}
+
+func TestDoubledOperators(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nb\nc", 0, 0, "dd", "b\nc", 0, 0},
+		{"a\nb\nc", 1, 0, "ccX<Esc>", "a\nX\nc", 1, 0},
+		{"abc def", 0, 0, "gUU", "ABC DEF", 0, 0},
+		{"a\nb", 0, 0, ">>", "    a\nb", 0, 4},
+		{"      a", 0, 0, "<<", "  a", 0, 2},
+		{"abc", 0, 2, "x", "ab", 0, 1},
+		{"abc", 0, 0, "D", "", 0, 0},
+	})
+}
+
+func TestCaseOperators(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"abc", 0, 0, "~", "Abc", 0, 1},
+		{"abc", 0, 0, "5~", "ABC", 0, 2},
+		{"abcdef", 0, 0, "2~l.", "ABcDEf", 0, 5},
+		{"abc def", 0, 0, "g~~", "ABC DEF", 0, 0},
+	})
+}
+
+func TestIndentOperators(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nb\nc", 0, 0, "2>>", "    a\n    b\nc", 0, 4},
+		{"  a", 0, 0, "<<", "a", 0, 0},
+		{"  a\nb\n        c\n   \nd", 1, 0, "=G", "  a\n  b\n  c\n\n  d", 1, 2},
+		{"  a\nb\nc", 1, 0, "Vj=", "  a\n  b\n  c", 1, 2},
+	})
+
+	// Without "expandtab", indents use as many tabs as they can
+	model := newTestModel("a")
+	sendKeys(model, ":set sw=2 noet ts=4<CR>>>>>>>")
+	if value := model.GetValue(); value != "\t  a" {
+		t.Errorf("got %q after indenting three times", value)
+	}
+	sendKeys(model, "<<")
+	if value := model.GetValue(); value != "\ta" {
+		t.Errorf("got %q after unindenting", value)
+	}
+}
+
+func TestJoinLines(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\n  b\nc", 0, 0, "J", "a b\nc", 0, 1},
+		{"a\n  b\nc", 0, 0, "gJ", "a  b\nc", 0, 1},
+		{"a\nb\nc", 0, 0, "2J", "a b\nc", 0, 1},
+		{"a\nb\nc", 0, 0, "3J", "a b c", 0, 3},
+		{"a\nb\nc", 0, 0, "3gJ", "abc", 0, 2},
+		{"a\nb\nc", 0, 0, "VjgJ", "ab\nc", 0, 1},
+
+		// A count past the last line joins up to the last line, and there's nothing to join on the last line
+		{"a\nb\nc", 0, 0, "5J", "a b c", 0, 3},
+		{"a\nb\nc", 1, 0, "5J", "a\nb c", 1, 1},
+		{"a\nb\nc", 2, 0, "J", "a\nb\nc", 2, 0},
+		{"a\nb\nc", 2, 0, "5J", "a\nb\nc", 2, 0},
+	})
+}
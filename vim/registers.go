@@ -0,0 +1,259 @@
+package vim
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mieubrisse/vim-bubble/clipboard"
+)
+
+const (
+	// Used by commands that don't specify a register; it holds whatever was most recently yanked or deleted
+	unnamedRegister = '"'
+
+	// Holds the most recent yank that didn't specify a register
+	yankRegister = '0'
+
+	// Holds deletes within a single line that didn't specify a register
+	smallDeleteRegister = '-'
+
+	// Writing to this register throws the text away, and reading from it always gives nothing
+	blackholeRegister = '_'
+
+	// Backed by the system clipboard and the primary selection respectively
+	clipboardRegister        = '+'
+	primarySelectionRegister = '*'
+
+	// Read-only registers
+	lastInsertedTextRegister = '.'
+	lastCommandLineRegister  = ':'
+	fileNameRegister         = '%'
+)
+
+// The contents of a register
+type register struct {
+	text string
+
+	// Determines how the text gets put back into the buffer (e.g. linewise text is put on its own lines)
+	// Linewise text always ends in a newline, and blockwise text has one line per row of the block
+	kind rangeKind
+}
+
+// Per Vim's documentation, deleting with these motions always goes to the numbered registers, even when the deleted
+// text is within a single line
+var motionsUsingNumberedRegisters = map[string]bool{
+	"%": true,
+	"(": true,
+	")": true,
+	"`": true,
+	"/": true,
+	"?": true,
+	"n": true,
+	"N": true,
+	"{": true,
+	"}": true,
+}
+
+func isValidRegisterName(name rune) bool {
+	switch {
+	case name >= 'a' && name <= 'z', name >= 'A' && name <= 'Z', name >= '0' && name <= '9':
+		return true
+	}
+	return strings.ContainsRune(`"-_.:%+*`, name)
+}
+
+// Whether the register's contents are kept in the model's registers, rather than coming from somewhere else (e.g. the
+// clipboard) or being another name for one of them (e.g. "A" for "a")
+func isStoredRegisterName(name rune) bool {
+	return (name >= 'a' && name <= 'z') || (name >= '0' && name <= '9') || name == smallDeleteRegister || name == unnamedRegister
+}
+
+func isReadOnlyRegister(name rune) bool {
+	return name == lastInsertedTextRegister || name == lastCommandLineRegister || name == fileNameRegister
+}
+
+// Gets the contents of the register with the given name, where 0 means the unnamed register
+func (model *Model) getRegister(name rune) register {
+	switch name {
+	case 0:
+		name = unnamedRegister
+	case blackholeRegister:
+		return register{}
+	case lastInsertedTextRegister:
+		return register{text: model.lastInsertedText}
+	case lastCommandLineRegister:
+		return register{text: model.lastCommandLine}
+	case fileNameRegister:
+		return register{text: model.fileName}
+	case clipboardRegister, primarySelectionRegister:
+		return model.readClipboard(name)
+	}
+	return model.registers[unicode.ToLower(name)]
+}
+
+// Writes to the register with the given name, which also becomes the contents of the unnamed register
+// Uppercase names append to the lowercase register instead of replacing it
+func (model *Model) setRegister(name rune, reg register) {
+	if name == blackholeRegister || isReadOnlyRegister(name) {
+		return
+	}
+
+	if unicode.IsUpper(name) {
+		name = unicode.ToLower(name)
+		reg = appendToRegister(model.registers[name], reg)
+	}
+
+	switch name {
+	case clipboardRegister, primarySelectionRegister:
+		model.writeClipboard(name, reg)
+	case unnamedRegister:
+	default:
+		model.registers[name] = reg
+	}
+	model.registers[unnamedRegister] = reg
+}
+
+// Stores yanked text, which goes in register 0 unless the command specified another one
+func (model *Model) storeYankedText(cmd normalCommand, reg register) {
+	if cmd.register != 0 {
+		model.setRegister(cmd.register, reg)
+		return
+	}
+	model.setRegister(yankRegister, reg)
+}
+
+// Stores deleted (or changed) text, following Vim's rules:
+//   - Deletes of whole lines or across lines shift the numbered registers, and go in register 1 (even when the
+//     command also specified a register)
+//   - Other deletes go in the small delete register, unless the command specified a register
+func (model *Model) storeDeletedText(cmd normalCommand, reg register) {
+	if cmd.register == blackholeRegister {
+		return
+	}
+
+	isMultiline := reg.kind == rangeKind_Linewise || strings.Contains(reg.text, "\n")
+	if isMultiline || motionsUsingNumberedRegisters[cmd.motion] {
+		model.shiftNumberedRegisters()
+		model.setRegister('1', reg)
+	} else if cmd.register == 0 {
+		model.setRegister(smallDeleteRegister, reg)
+	}
+
+	if cmd.register != 0 {
+		model.setRegister(cmd.register, reg)
+	}
+}
+
+// Moves the contents of registers 1 through 8 up by one, dropping the contents of register 9
+func (model *Model) shiftNumberedRegisters() {
+	for name := '9'; name > '1'; name-- {
+		model.registers[name] = model.registers[name-1]
+	}
+}
+
+// Appends the new text to a register the way Vim does, where appending lines to characterwise text (or vice versa)
+// makes the result linewise
+func appendToRegister(existing register, addition register) register {
+	switch {
+	case existing.text == "":
+		return addition
+	case existing.kind == rangeKind_Linewise && addition.kind != rangeKind_Linewise:
+		return register{text: existing.text + addition.text + "\n", kind: rangeKind_Linewise}
+	case existing.kind != rangeKind_Linewise && addition.kind == rangeKind_Linewise:
+		return register{text: existing.text + "\n" + addition.text, kind: rangeKind_Linewise}
+	case existing.kind == rangeKind_Blockwise && addition.kind == rangeKind_Blockwise:
+		return register{text: existing.text + "\n" + addition.text, kind: rangeKind_Blockwise}
+	}
+	return register{text: existing.text + addition.text, kind: existing.kind}
+}
+
+// A write to the clipboard that's been sent out as a command, but hasn't finished yet
+type pendingClipboardWrite struct {
+	seq  int
+	text string
+}
+
+// Sent by the command writing to the clipboard once it's done
+type clipboardWrittenMsg struct {
+	selection clipboard.Selection
+	seq       int
+	err       error
+}
+
+// Bubble Tea can run commands in any order (and at the same time), so this makes sure that each clipboard only ever
+// gets written to by one command at a time, and never by an older write after a newer one
+type clipboardWriter struct {
+	mutex           sync.Mutex
+	lastWrittenSeqs map[clipboard.Selection]int
+}
+
+func newClipboardWriter() *clipboardWriter {
+	return &clipboardWriter{
+		lastWrittenSeqs: map[clipboard.Selection]int{},
+	}
+}
+
+func (writer *clipboardWriter) write(board clipboard.Clipboard, selection clipboard.Selection, seq int, text string) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	if seq < writer.lastWrittenSeqs[selection] {
+		return nil
+	}
+	writer.lastWrittenSeqs[selection] = seq
+	return board.Write(selection, text)
+}
+
+// Reads the clipboard behind the "+" or "*" register, which gives back the text of a write that hasn't finished yet
+// if there is one
+// Like Vim, text from the clipboard that ends in a newline gets treated as lines
+func (model *Model) readClipboard(name rune) register {
+	selection := getClipboardSelection(name)
+	text := ""
+	if write, isWriting := model.pendingClipboardWrites[selection]; isWriting {
+		text = write.text
+	} else {
+		var err error
+		if text, err = model.clipboard.Read(selection); err != nil {
+			model.Err = err
+			return register{}
+		}
+	}
+
+	if strings.HasSuffix(text, "\n") {
+		return register{text: text, kind: rangeKind_Linewise}
+	}
+	return register{text: text, kind: rangeKind_Characterwise}
+}
+
+// Writes to the clipboard behind the "+" or "*" register from a command that Update returns, since clipboards can be
+// slow (e.g. shelling out to xclip) or write to the terminal (e.g. OSC 52), neither of which should happen in Update
+func (model *Model) writeClipboard(name rune, reg register) {
+	selection := getClipboardSelection(name)
+	model.numClipboardWrites++
+	seq := model.numClipboardWrites
+	model.pendingClipboardWrites[selection] = pendingClipboardWrite{seq: seq, text: reg.text}
+
+	board, writer := model.clipboard, model.clipboardWriter
+	model.queuedCmds = append(model.queuedCmds, func() tea.Msg {
+		return clipboardWrittenMsg{selection: selection, seq: seq, err: writer.write(board, selection, seq, reg.text)}
+	})
+}
+
+func (model *Model) handleClipboardWritten(msg clipboardWrittenMsg) {
+	// Reads keep giving back the text being written until the newest write is done
+	if model.pendingClipboardWrites[msg.selection].seq == msg.seq {
+		delete(model.pendingClipboardWrites, msg.selection)
+	}
+	if msg.err != nil {
+		model.Err = msg.err
+	}
+}
+
+func getClipboardSelection(name rune) clipboard.Selection {
+	if name == primarySelectionRegister {
+		return clipboard.Selection_Primary
+	}
+	return clipboard.Selection_Clipboard
+}
@@ -0,0 +1,125 @@
+package vim
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/mieubrisse/vim-bubble/clipboard"
+)
+
+func TestRegisters(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nb", 0, 0, "ddp", "b\na", 1, 0},
+		{"a\nb", 1, 0, "ddP", "b\na", 0, 0},
+		{"abc", 0, 0, "xp", "bac", 0, 1},
+		{"abc", 0, 0, "yl$p", "abca", 0, 3},
+		{"a", 0, 0, "yy3p", "a\na\na\na", 1, 0},
+
+		// Named registers, where the uppercase names append
+		{"one two", 0, 0, `"ayw$"ap`, "one twoone ", 0, 10},
+		{"one two", 0, 0, `"ayww"Ayw$"ap`, "one twoone two", 0, 13},
+		{"a b", 0, 0, `2"ay3l"ap`, "aa b b", 0, 3},
+
+		// Deleted lines shift through the numbered registers, while yanks go in register 0
+		{"a\nb\nc", 0, 0, `dddd"2p`, "c\na", 1, 0},
+		{"a\nb\nc", 0, 0, `yyjdd"0P`, "a\na\nc", 1, 0},
+
+		// Small deletes go in the "-" register, unless they're to the blackhole register
+		{"abc", 0, 0, `x"_x"-p`, "ca", 0, 1},
+
+		{"ab", 0, 0, `iX<Esc>".p`, "XXab", 0, 1},
+		{"abc", 0, 0, `".x`, "abc", 0, 0},
+
+		// Blockwise text gets put as a block
+		{"abc\ndef", 0, 0, "<C-v>jy$p", "abca\ndefd", 0, 3},
+		{"ab\ncd", 0, 0, "<C-v>jyP", "aab\nccd", 0, 0},
+	})
+}
+
+// Runs the commands writing to the clipboard, then gives the model the messages they send back like Bubble Tea would
+func finishClipboardWrites(model *Model, cmd tea.Cmd) {
+	if cmd == nil {
+		return
+	}
+	switch msg := cmd().(type) {
+	case clipboardWrittenMsg:
+		model.Update(msg)
+	case tea.BatchMsg:
+		for _, batchedCmd := range msg {
+			finishClipboardWrites(model, batchedCmd)
+		}
+	}
+}
+
+func TestClipboardRegisters(t *testing.T) {
+	board := clipboard.NewInMemory()
+	model := New(WithClipboard(board))
+	model.Focus()
+	model.Resize(80, 20)
+	model.SetValue("one\ntwo")
+
+	finishClipboardWrites(&model, sendKeys(&model, `gg"+yy`))
+	if text, _ := board.Read(clipboard.Selection_Clipboard); text != "one\n" {
+		t.Errorf("got %q in the clipboard, want %q", text, "one\n")
+	}
+
+	// Text ending in a newline gets put as lines
+	sendKeys(&model, `j"+p`)
+	if value := model.GetValue(); value != "one\ntwo\none" {
+		t.Errorf("got %q after putting lines from the clipboard", value)
+	}
+
+	board.Write(clipboard.Selection_Primary, "XY")
+	sendKeys(&model, `gg"*P`)
+	if value := model.GetValue(); value != "XYone\ntwo\none" {
+		t.Errorf("got %q after putting from the primary selection", value)
+	}
+}
+
+func TestOSC52ClipboardRegister(t *testing.T) {
+	output := &strings.Builder{}
+	model := New(WithClipboard(clipboard.NewOSC52(output)))
+	model.Focus()
+	model.SetValue("hi there")
+
+	finishClipboardWrites(&model, sendKeys(&model, `0"+yiw`))
+	// "aGk=" is "hi" in base64
+	if !strings.Contains(output.String(), "\x1b]52;c;aGk=") {
+		t.Errorf("got %q written to the terminal, want an OSC 52 sequence setting the clipboard to \"hi\"", output.String())
+	}
+	sendKeys(&model, `$"+p`)
+	if value := model.GetValue(); value != "hi therehi" {
+		t.Errorf("got %q after putting from the clipboard", value)
+	}
+}
+
+func TestClipboardWritesHappenInCommands(t *testing.T) {
+	board := clipboard.NewInMemory()
+	model := New(WithClipboard(board))
+	model.Focus()
+	model.SetValue("one two")
+
+	firstCmd := sendKeys(&model, `0"+yiw`)
+	secondCmd := sendKeys(&model, `w"+yiw`)
+	if text, _ := board.Read(clipboard.Selection_Clipboard); text != "" {
+		t.Errorf("got %q in the clipboard before running the commands, want nothing", text)
+	}
+
+	// Until the writes are done, the register gives back the newest text
+	sendKeys(&model, `$"+p`)
+	if value := model.GetValue(); value != "one twotwo" {
+		t.Errorf("got %q after putting from the clipboard while it was being written", value)
+	}
+
+	// Bubble Tea might run the commands in any order, but the older write never wins
+	finishClipboardWrites(&model, secondCmd)
+	finishClipboardWrites(&model, firstCmd)
+	if text, _ := board.Read(clipboard.Selection_Clipboard); text != "two" {
+		t.Errorf("got %q in the clipboard after running the commands, want %q", text, "two")
+	}
+	if len(model.pendingClipboardWrites) != 0 {
+		t.Errorf("got writes %v still pending after running the commands", model.pendingClipboardWrites)
+	}
+}
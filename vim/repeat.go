@@ -0,0 +1,134 @@
+package vim
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// A change to the buffer that "." can repeat
+type repeatableChange struct {
+	// The count the change was made with (0 if none), which gets replaced by the count given to "." (if any)
+	count int
+
+	// The register the change was made with (0 if none)
+	register rune
+
+	// The keys that make the change, excluding its count and register but including anything typed in insert mode
+	keys []tea.KeyMsg
+}
+
+// Gets the keys that will replay the command (without its count or register)
+func (cmd normalCommand) getKeyNames() []string {
+	var result []string
+	if cmd.hasOperator() {
+		result = append(result, splitKeyName(cmd.operator)...)
+		if cmd.isOperatorDoubled {
+			return append(result, splitKeyName(cmd.operator)...)
+		}
+	}
+
+	if cmd.motion != "" {
+		result = append(result, splitKeyName(cmd.motion)...)
+		if motions[cmd.motion].takesArgument {
+			result = append(result, getRuneKeyName(cmd.argument))
+		}
+		if cmd.searchPattern != "" {
+			for _, char := range cmd.searchPattern {
+				result = append(result, getRuneKeyName(char))
+			}
+			result = append(result, "enter")
+		}
+	}
+
+	if cmd.textObject != "" {
+		result = append(result, splitKeyName(cmd.textObject)...)
+	}
+
+	if cmd.action != "" {
+		result = append(result, splitKeyName(cmd.action)...)
+		if actions[cmd.action].takesArgument {
+			result = append(result, getRuneKeyName(cmd.argument))
+		}
+	}
+	return result
+}
+
+// Starts recording a change, which is finished right away unless the change left us in insert mode (in which case
+// the keys typed until insert mode ends are part of it)
+func (model *Model) recordChange(change repeatableChange) {
+	model.changeBeingRecorded = &change
+	if !model.mode.isInsertOrReplace() {
+		model.finishRecordingChange()
+	}
+}
+
+func (model *Model) finishRecordingChange() {
+	if model.changeBeingRecorded == nil {
+		return
+	}
+	model.lastChange = model.changeBeingRecorded
+	model.changeBeingRecorded = nil
+}
+
+// Gets the keys that will select the same amount of text as the current visual mode selection, starting from
+// wherever the cursor is, the way Vim does when repeating a visual mode change
+func (model *Model) getSelectionKeyNames() []string {
+	start, end := model.visualAnchor, model.area.GetCursorPosition()
+	if end.IsBefore(start) {
+		start, end = end, start
+	}
+	numExtraRows := end.Row - start.Row
+
+	var result []string
+	switch model.mode {
+	case VisualLineMode:
+		result = append([]string{"V"}, getCountedMotionKeyNames(numExtraRows, "j")...)
+	case VisualBlockMode:
+		numExtraCols := abs(model.visualAnchor.Col - model.area.GetCursorColumn())
+		result = append([]string{"ctrl+v"}, getCountedMotionKeyNames(numExtraRows, "j")...)
+		result = append(result, getCountedMotionKeyNames(numExtraCols, "l")...)
+	default:
+		// Selections spanning lines end at the same column, while selections within a line have the same length
+		result = []string{"v"}
+		if numExtraRows > 0 {
+			result = append(result, getCountedMotionKeyNames(numExtraRows, "j")...)
+			result = append(result, "0")
+			result = append(result, getCountedMotionKeyNames(end.Col, "l")...)
+		} else {
+			result = append(result, getCountedMotionKeyNames(end.Col-start.Col, "l")...)
+		}
+	}
+	return result
+}
+
+// Gets the keys that move by the motion the given number of times, which is nothing if the count isn't positive
+func getCountedMotionKeyNames(count int, motionKeyName string) []string {
+	if count <= 0 {
+		return nil
+	}
+	return append(getCountKeyNames(count), motionKeyName)
+}
+
+// ====================================================================================================
+//
+//	Action Implementations
+//
+// ====================================================================================================
+func repeatLastChange(model *Model, cmd normalCommand) {
+	change := model.lastChange
+	if change == nil {
+		return
+	}
+
+	count := change.count
+	if cmd.count > 0 {
+		count = cmd.count
+	}
+
+	var keyNames []string
+	if change.register != 0 {
+		keyNames = append(keyNames, `"`, string(change.register))
+	}
+	keyNames = append(keyNames, getCountKeyNames(count)...)
+
+	model.replayKeys(append(getKeyMsgs(keyNames), change.keys...))
+}
@@ -0,0 +1,27 @@
+package vim
+
+import "testing"
+
+func TestDotRepeat(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a b c d e", 0, 0, "dw.", "c d e", 0, 0},
+		{"a\nb\nc\nd", 0, 0, "dd.", "c\nd", 0, 0},
+		{"a,b,c", 0, 0, "df,.", "c", 0, 0},
+		{"abc", 0, 0, "x.u", "bc", 0, 0},
+
+		// The repeat keeps the change's count, unless it's given a new one
+		{"a b c d e f g", 0, 0, "2dw.", "e f g", 0, 0},
+		{"a b c d e f g", 0, 0, "2dw3.", "f g", 0, 0},
+
+		// Changes that insert text repeat what was typed
+		{"a\nb\nc", 0, 0, "Ax<Esc>j.", "ax\nbx\nc", 1, 1},
+		{"abc abc", 0, 0, "cwxy<Esc>w.", "xy xy", 0, 4},
+		{"a\nb", 0, 0, "oX<Esc>.", "a\nX\nX\nb", 2, 0},
+
+		// Visual changes repeat on the same amount of text
+		{"abcdef", 0, 0, "vld.", "ef", 0, 0},
+		{"a\nb\nc\nd", 0, 0, "Vjd.", "", 0, 0},
+
+		{"a\nb", 0, 0, `"ayy"ap.`, "a\na\na\nb", 2, 0},
+	})
+}
@@ -0,0 +1,121 @@
+package vim
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	rw "github.com/mattn/go-runewidth"
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// What typing a key in replace mode did, so that backspace can put things back the way they were
+type replacedChar struct {
+	// Where the cursor was before the key was typed
+	pos textarea.Position
+
+	// The characters that got overwritten, which there are fewer of than were typed when the typing went past the end
+	// of the line (or none at all, for a line break)
+	overwritten []rune
+}
+
+// Handles a key typed in replace mode, where typed characters overwrite the ones under the cursor and backspace
+// restores them
+func (model *Model) handleReplaceModeKey(msg tea.KeyMsg) tea.Cmd {
+	var runes []rune
+	switch msg.Type {
+	case tea.KeyRunes, tea.KeySpace:
+		runes = msg.Runes
+	case tea.KeyEnter:
+		runes = []rune{'\n'}
+	case tea.KeyTab:
+		runes = []rune{'\t'}
+	case tea.KeyBackspace:
+		model.restoreReplacedChar()
+		return nil
+	default:
+		// Once the cursor has moved, what backspace would restore no longer lines up with it
+		model.replacedChars = nil
+		return model.area.Update(msg)
+	}
+
+	pos := model.area.GetCursorPosition()
+	overwritten := model.area.OverwriteRunes(runes)
+	model.replacedChars = append(model.replacedChars, replacedChar{pos: pos, overwritten: overwritten})
+	return nil
+}
+
+// Undoes the most recent key typed in replace mode, or just moves the cursor left if everything typed has already
+// been undone (like Vim, which doesn't delete text that was there before replace mode started)
+func (model *Model) restoreReplacedChar() {
+	if len(model.replacedChars) == 0 {
+		model.area.MoveCursorLeftOneRune()
+		return
+	}
+
+	last := model.replacedChars[len(model.replacedChars)-1]
+	model.replacedChars = model.replacedChars[:len(model.replacedChars)-1]
+	model.area.ReplaceRange(last.pos, model.area.GetCursorPosition(), string(last.overwritten))
+	model.area.SetCursorPosition(last.pos)
+}
+
+// ====================================================================================================
+//
+//	Action Implementations
+//
+// ====================================================================================================
+func enterReplaceMode(model *Model, cmd normalCommand) {
+	model.replacedChars = nil
+	model.mode = ReplaceMode
+}
+
+// "r" replaces count characters starting at the cursor with the argument, leaving the cursor on the last of them
+// Like Vim, nothing gets replaced if the line doesn't have count characters left, and "r<enter>" replaces them all
+// with a single line break.
+func replaceCharacters(model *Model, cmd normalCommand) {
+	pos := model.area.GetCursorPosition()
+	end := textarea.Position{Row: pos.Row, Col: pos.Col + cmd.getCount()}
+	if end.Col > model.area.GetLineLength(pos.Row) {
+		model.abortReplay()
+		return
+	}
+
+	if cmd.argument == '\n' {
+		model.area.ReplaceRange(pos, end, "\n")
+		model.area.SetCursorPosition(textarea.Position{Row: pos.Row + 1, Col: 0})
+		return
+	}
+
+	model.area.ReplaceRange(pos, end, strings.Repeat(string(cmd.argument), cmd.getCount()))
+	model.area.SetCursorPosition(textarea.Position{Row: pos.Row, Col: end.Col - 1})
+}
+
+// "gr" is like "r", except that it replaces screen cells rather than characters, so that the text after the
+// replacement stays where it was on screen (e.g. replacing a double-width character with a single-width one pads the
+// replacement with a space)
+func replaceVirtualCharacters(model *Model, cmd normalCommand) {
+	if cmd.argument == '\n' {
+		replaceCharacters(model, cmd)
+		return
+	}
+
+	pos := model.area.GetCursorPosition()
+	line := model.area.GetLine(pos.Row)
+	replacement := strings.Repeat(string(cmd.argument), cmd.getCount())
+	replacementWidth := max(1, rw.RuneWidth(cmd.argument)) * cmd.getCount()
+
+	// Covers the cells being replaced with whole characters, which can overshoot when the last one is wide
+	endCol := pos.Col
+	coveredWidth := 0
+	for coveredWidth < replacementWidth && endCol < len(line) {
+		coveredWidth += max(1, rw.RuneWidth(line[endCol]))
+		endCol++
+	}
+	if coveredWidth < replacementWidth {
+		model.abortReplay()
+		return
+	}
+
+	replacement += strings.Repeat(" ", coveredWidth-replacementWidth)
+	model.area.ReplaceRange(pos, textarea.Position{Row: pos.Row, Col: endCol}, replacement)
+	model.area.SetCursorPosition(textarea.Position{Row: pos.Row, Col: pos.Col + cmd.getCount() - 1})
+}
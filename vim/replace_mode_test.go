@@ -0,0 +1,37 @@
+package vim
+
+import "testing"
+
+func TestReplaceMode(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"abcdef", 0, 1, "RXY<Esc>", "aXYdef", 0, 2},
+		{"abc", 0, 1, "RXYZW<Esc>", "aXYZW", 0, 4},
+		{"abcdef", 0, 2, "RX<CR>Y<Esc>", "abX\nYef", 1, 0},
+		{"abcdef", 0, 1, "RXY<Esc>j.", "aXXYef", 0, 3},
+
+		// Backspace puts back the characters that were replaced, and removes the ones that were added
+		{"abcdef", 0, 1, "RXYZ<BS><BS><Esc>", "aXcdef", 0, 1},
+		{"abc", 0, 1, "RXYZW<BS><BS><Esc>", "aXY", 0, 2},
+		{"abcdef", 0, 2, "RX<BS><BS><BS>Q<Esc>", "Qbcdef", 0, 0},
+		{"abcdef", 0, 2, "RX<CR>Y<BS><BS><Esc>", "abXdef", -1, 0},
+	})
+}
+
+func TestSingleCharacterReplace(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"abcdef", 0, 1, "rx", "axcdef", 0, 1},
+		{"abcdef", 0, 1, "3rx", "axxxef", 0, 3},
+		{"abcdef", 0, 1, "2rxll.", "axxdxx", 0, 5},
+		{"abcdef", 0, 1, "2rxu", "abcdef", -1, 0},
+
+		// A count past the end of the line fails
+		{"abcdef", 0, 4, "3rx", "abcdef", 0, 4},
+
+		// Replacing with Enter replaces all of the characters with a single line break
+		{"abcdef", 0, 1, "2r<CR>", "a\ndef", 1, 0},
+
+		// "gr" replaces screen columns rather than characters
+		{"a日b", 0, 1, "grx", "ax b", 0, 1},
+		{"abc", 0, 0, "2grx", "xxc", 0, 1},
+	})
+}
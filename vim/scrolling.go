@@ -0,0 +1,139 @@
+package vim
+
+import (
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// ====================================================================================================
+//
+//	Screen Motions
+//
+// ====================================================================================================
+// "H" goes to the count'th row from the top of the view, and "L" to the count'th row from the bottom
+// Like Vim, the cursor stays "scrolloff" rows away from the edges of the view (unless an operator is pending, or the
+// edge is the start or end of the buffer).
+func moveToViewEdge(model *Model, cmd normalCommand) bool {
+	topRow, bottomRow := model.area.GetTopRow(), model.area.GetBottomRow()
+	minRow, maxRow := topRow, bottomRow
+	if !cmd.hasOperator() {
+		scrollOff := clamp(model.Settings.ScrollOff, 0, (bottomRow-topRow)/2)
+		if topRow > 0 {
+			minRow += scrollOff
+		}
+		if bottomRow < model.area.GetNumRows()-1 {
+			maxRow -= scrollOff
+		}
+	}
+
+	row := topRow + cmd.getCount() - 1
+	if cmd.motion == "L" {
+		row = bottomRow - cmd.getCount() + 1
+	}
+	moveToFirstNonBlankOfRow(model, clamp(row, minRow, max(minRow, maxRow)))
+	return true
+}
+
+// "M" goes to the row in the middle of the view, or the middle of the rows shown if the buffer ends before the view
+// does
+func moveToViewMiddle(model *Model, cmd normalCommand) bool {
+	topRow, bottomRow := model.area.GetTopRow(), model.area.GetBottomRow()
+	moveToFirstNonBlankOfRow(model, (topRow+bottomRow)/2)
+	return true
+}
+
+// ====================================================================================================
+//
+//	Scrolling
+//
+// ====================================================================================================
+// "zt", "zz" and "zb" scroll the view so that the cursor's row (or the row given as a count) is at the top, middle or
+// bottom of it, respectively
+func scrollCursorRow(model *Model, cmd normalCommand) {
+	if cmd.count > 0 {
+		row := clamp(cmd.count-1, 0, model.area.GetNumRows()-1)
+		model.area.SetCursorPosition(textarea.Position{Row: row, Col: model.area.GetCursorColumn()})
+	}
+
+	row := model.area.GetRow()
+	scrollOff := clamp(model.Settings.ScrollOff, 0, (model.area.GetHeight()-1)/2)
+	switch cmd.action {
+	case "zt":
+		model.area.SetTopRow(row - scrollOff)
+	case "zz":
+		model.area.SetMiddleRow(row)
+	case "zb":
+		model.area.SetBottomRow(row + scrollOff)
+	}
+}
+
+// "ctrl+e" scrolls the view down by count rows (as far as having the last row at the top), and "ctrl+y" scrolls it
+// up, with the cursor only moving if it would otherwise go out of view
+func scrollByRows(model *Model, cmd normalCommand) {
+	if cmd.action == "ctrl+y" {
+		model.area.ScrollBy(-cmd.getCount())
+	} else {
+		model.area.ScrollBy(cmd.getCount())
+	}
+}
+
+// "ctrl+d" scrolls the view down by half of its height (or the "scroll" setting, if it's set) and moves the cursor
+// down by the same amount, and "ctrl+u" does the same upwards
+// A count sets the "scroll" setting, like in Vim. The view doesn't scroll past the end of the buffer, but the cursor
+// keeps going until it gets there.
+func scrollHalfPage(model *Model, cmd normalCommand) {
+	if cmd.count > 0 {
+		model.Settings.Scroll = cmd.count
+	}
+	amount := model.Settings.Scroll
+	if amount <= 0 {
+		amount = max(1, model.area.GetHeight()/2)
+	}
+
+	cursor := model.area.GetCursorPosition()
+	topRow := model.area.GetTopRow()
+	lastRow := model.area.GetNumRows() - 1
+	if cmd.action == "ctrl+u" {
+		if cursor.Row == 0 {
+			model.abortReplay()
+			return
+		}
+		model.area.SetTopRow(topRow - amount)
+		model.area.SetCursorPosition(textarea.Position{Row: max(0, cursor.Row-amount), Col: cursor.Col})
+		return
+	}
+
+	if cursor.Row == lastRow {
+		model.abortReplay()
+		return
+	}
+	numRowsBelowView := lastRow - model.area.GetBottomRow()
+	model.area.SetTopRow(topRow + min(amount, max(0, numRowsBelowView)))
+	model.area.SetCursorPosition(textarea.Position{Row: min(lastRow, cursor.Row+amount), Col: cursor.Col})
+}
+
+// "ctrl+f" scrolls the view forward by count pages, leaving two rows of the last page in view, and "ctrl+b" scrolls
+// it backward in the same way
+// The cursor moves to the first row in view (or the last, for "ctrl+b") that's not within "scrolloff" of the edge.
+func scrollPage(model *Model, cmd normalCommand) {
+	isForward := cmd.action == "ctrl+f" || cmd.action == "pgdown"
+	for i := 0; i < cmd.getCount(); i++ {
+		topRow, bottomRow := model.area.GetTopRow(), model.area.GetBottomRow()
+		if isForward {
+			if topRow >= model.area.GetNumRows()-1 {
+				model.abortReplay()
+				return
+			}
+			model.area.SetTopRow(max(topRow+1, bottomRow-1))
+			continue
+		}
+
+		if topRow == 0 {
+			model.abortReplay()
+			return
+		}
+		model.area.SetBottomRow(min(bottomRow-1, topRow+1))
+	}
+
+	// Scrolling already moved the cursor into view
+	moveToFirstNonBlankOfRow(model, model.area.GetRow())
+}
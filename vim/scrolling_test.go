@@ -0,0 +1,114 @@
+package vim
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Makes numbered lines that are each short enough to fit on a single screen row
+func getNumberedLines(numLines int) string {
+	lines := make([]string, 0, numLines)
+	for idx := 0; idx < numLines; idx++ {
+		lines = append(lines, fmt.Sprintf("  line %d", idx))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestScreenMotionsAndScrolling(t *testing.T) {
+	// The test model shows 19 rows of text above the status bar
+	for _, test := range []struct {
+		keys       string
+		wantRow    int
+		wantTopRow int
+	}{
+		{"L", 18, 0},
+		{"3L", 16, 0},
+		{"M", 9, 0},
+		{"G", 49, 31},
+		{"GH", 31, 31},
+		{"G3H", 33, 31},
+		{"zt", 0, 0},
+		{"5Gzt", 4, 4},
+		{"30Gzt", 29, 29},
+		{"30Gzb", 29, 11},
+		{"30Gzz", 29, 20},
+		{"<C-e>", 1, 1},
+		{"5<C-e>", 5, 5},
+		{"5<C-e><C-y>", 5, 4},
+		{"<C-d>", 9, 9},
+		{"<C-d><C-d>", 18, 18},
+		{"<C-d><C-d><C-d><C-d>", 36, 31},
+		{"<C-d><C-d><C-d><C-d><C-d><C-d>", 49, 31},
+		{"<C-d><C-u>", 0, 0},
+		{"3<C-d><C-d>", 6, 6},
+		{"<C-f>", 17, 17},
+		{"<C-f><C-b>", 17, 0},
+		{"<PageDown>", 17, 17},
+
+		// "scrolloff" keeps lines around the cursor on the screen
+		{":set so=3<CR>L", 15, 0},
+		{":set so=3<CR><C-f>", 20, 17},
+		{":set so=3<CR>20j", 20, 5},
+		{":set so=3<CR>Gk", 48, 31},
+	} {
+		model := newTestModel(getNumberedLines(50))
+		sendKeys(model, test.keys)
+		if row, topRow := model.area.GetRow(), model.area.GetTopRow(); row != test.wantRow || topRow != test.wantTopRow {
+			t.Errorf("got row %d with top row %d after %q, want row %d with top row %d", row, topRow, test.keys, test.wantRow, test.wantTopRow)
+		}
+	}
+}
+
+func TestScreenMotionsOnShortBuffer(t *testing.T) {
+	model := newTestModel(getNumberedLines(5))
+	sendKeys(model, "L")
+	if row := model.area.GetRow(); row != 4 {
+		t.Errorf("got row %d after L, want the last line", row)
+	}
+	sendKeys(model, "M")
+	if row := model.area.GetRow(); row != 2 {
+		t.Errorf("got row %d after M, want the middle line", row)
+	}
+}
+
+func TestOperatorsWithScreenMotions(t *testing.T) {
+	model := newTestModel(getNumberedLines(50))
+	sendKeys(model, "dL")
+	if numRows := model.area.GetNumRows(); numRows != 31 {
+		t.Errorf("got %d lines after dL, want 31", numRows)
+	}
+
+	model = newTestModel(getNumberedLines(50))
+	sendKeys(model, "V<C-d>d")
+	if numRows := model.area.GetNumRows(); numRows != 40 {
+		t.Errorf("got %d lines after deleting a half-page selection, want 40", numRows)
+	}
+}
+
+func TestScrollingIsShown(t *testing.T) {
+	model := newTestModel(getNumberedLines(50))
+	sendKeys(model, "5<C-e>")
+	if firstLine := strings.Split(model.View(), "\n")[0]; !strings.Contains(firstLine, "line 5") {
+		t.Errorf("got %q as the first line shown after scrolling down 5 lines", firstLine)
+	}
+
+	sendKeys(model, "G")
+	if lastLine := strings.Split(model.View(), "\n")[18]; !strings.Contains(lastLine, "line 49") {
+		t.Errorf("got %q as the last line shown at the end of the buffer", lastLine)
+	}
+}
+
+func TestScrollingWrappedLines(t *testing.T) {
+	model := newTestModel(strings.Repeat("word ", 20) + "\n" + getNumberedLines(30))
+	sendKeys(model, "<C-e>")
+	if topRow := model.area.GetTopRow(); topRow != 1 {
+		t.Errorf("got top row %d after scrolling past a wrapped line", topRow)
+	}
+
+	// The wrapped line takes up two screen rows
+	sendKeys(model, "<C-y>L")
+	if row := model.area.GetRow(); row != 17 {
+		t.Errorf("got row %d after L with a wrapped line on the screen", row)
+	}
+}
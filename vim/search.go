@@ -0,0 +1,266 @@
+package vim
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// A search for a pattern in a direction, as remembered for "n" and "N"
+type search struct {
+	// Empty if there hasn't been a search yet
+	pattern string
+
+	direction textarea.CursorMovementDirection
+}
+
+// The direction that each of the search prompts searches in
+var searchDirections = map[string]textarea.CursorMovementDirection{
+	"/": textarea.CursorMovementDirection_Right,
+	"?": textarea.CursorMovementDirection_Left,
+}
+
+// Whether the command is a search that's still waiting for its pattern to be typed
+func (cmd normalCommand) isAwaitingSearchPattern() bool {
+	_, isSearch := searchDirections[cmd.motion]
+	return isSearch && cmd.searchPattern == ""
+}
+
+// Opens the command line for typing the search pattern of the command, previewing the search as it's typed and
+// running the command once the pattern is submitted
+// An empty pattern reuses the last one, like in Vim.
+func (model *Model) openSearchCommandLine(cmd normalCommand, runCommand func(model *Model, cmd normalCommand)) {
+	direction := searchDirections[cmd.motion]
+	model.openCommandLine(commandLine{
+		prompt: []rune(cmd.motion)[0],
+		onChange: func(model *Model, text string) {
+			model.previewSearch(text, direction)
+		},
+		onSubmit: func(model *Model, text string) {
+			if text == "" {
+				text = model.lastSearch.pattern
+			}
+			model.updateSearchHighlight()
+			if text == "" {
+				return
+			}
+			cmd.searchPattern = text
+			runCommand(model, cmd)
+		},
+		onCancel: func(model *Model) {
+			model.updateSearchHighlight()
+		},
+	})
+}
+
+// Moves the cursor to the first match of the pattern being typed, and highlights all of its matches
+func (model *Model) previewSearch(pattern string, direction textarea.CursorMovementDirection) {
+	originalCursor := model.commandLine.originalCursor
+	model.area.SetCursorPosition(originalCursor)
+	if pattern == "" {
+		model.updateSearchHighlight()
+		return
+	}
+
+	if !model.Settings.IncrementalSearch {
+		return
+	}
+
+	compiledPattern := model.compileSearchPattern(pattern)
+	if model.Settings.HighlightSearch {
+		model.area.SetSearchHighlight(compiledPattern)
+	}
+	if matchPos, found := model.area.FindMatch(compiledPattern, originalCursor, direction, model.Settings.WrapScan); found {
+		model.area.SetCursorPosition(matchPos)
+	}
+}
+
+// Highlights the matches of the last search, unless highlighting has been turned off
+func (model *Model) updateSearchHighlight() {
+	if !model.Settings.HighlightSearch || !model.isHighlightingSearch || model.lastSearch.pattern == "" {
+		model.area.SetSearchHighlight(nil)
+		return
+	}
+	model.area.SetSearchHighlight(model.compileSearchPattern(model.lastSearch.pattern))
+}
+
+// Moves to the count'th match of the pattern from the cursor, highlighting all of the pattern's matches
+func (model *Model) moveToMatch(pattern string, direction textarea.CursorMovementDirection, count int) bool {
+	return model.moveToMatchFrom(pattern, model.area.GetCursorPosition(), direction, count)
+}
+
+// Like moveToMatch, except that the search starts from the given position rather than the cursor
+func (model *Model) moveToMatchFrom(pattern string, from textarea.Position, direction textarea.CursorMovementDirection, count int) bool {
+	model.isHighlightingSearch = true
+	model.updateSearchHighlight()
+
+	compiledPattern := model.compileSearchPattern(pattern)
+	matchPos := from
+	for i := 0; i < count; i++ {
+		var found bool
+		matchPos, found = model.area.FindMatch(compiledPattern, matchPos, direction, model.Settings.WrapScan)
+		if !found {
+			return false
+		}
+	}
+	model.area.SetCursorPosition(matchPos)
+	return true
+}
+
+// Gets the keyword under the cursor (or, if the cursor isn't on one, the first keyword after it on the line)
+func (model *Model) getKeywordUnderCursor() (string, bool) {
+	pos := model.area.GetCursorPosition()
+	line := model.area.GetLine(pos.Row)
+
+	start := pos.Col
+	for start < len(line) && !model.isKeywordRune(line[start]) {
+		start++
+	}
+	if start >= len(line) {
+		return "", false
+	}
+	for start > 0 && model.isKeywordRune(line[start-1]) {
+		start--
+	}
+
+	end := start
+	for end < len(line) && model.isKeywordRune(line[end]) {
+		end++
+	}
+	return string(line[start:end]), true
+}
+
+// Patterns use Go's regexp syntax, but while a pattern is being typed it's often not valid yet (e.g. "foo("), in which
+// case it gets matched literally
+func (model *Model) compileSearchPattern(pattern string) *regexp.Regexp {
+	prefix := ""
+	if model.isIgnoringCase(pattern) {
+		prefix = "(?i)"
+	}
+
+	compiledPattern, err := regexp.Compile(prefix + pattern)
+	if err != nil {
+		return regexp.MustCompile(prefix + regexp.QuoteMeta(pattern))
+	}
+	return compiledPattern
+}
+
+// Whether the pattern should match case-insensitively, according to the "ignorecase" and "smartcase" settings
+func (model *Model) isIgnoringCase(pattern string) bool {
+	if !model.Settings.IgnoreCase {
+		return false
+	}
+	return !model.Settings.SmartCase || !hasUppercase(pattern)
+}
+
+// Whether the pattern has any uppercase characters, not counting the ones in escapes (e.g. "\S" or "\p{Lu}") and group
+// names (e.g. "(?P<Name>"), like Vim does
+func hasUppercase(pattern string) bool {
+	runes := []rune(pattern)
+	for idx := 0; idx < len(runes); idx++ {
+		switch {
+		case runes[idx] == '\\' && idx+1 < len(runes):
+			idx++
+			// Unicode classes can have their names in braces (e.g. "\p{Greek}")
+			if (runes[idx] == 'p' || runes[idx] == 'P') && idx+1 < len(runes) && runes[idx+1] == '{' {
+				idx = skipPastRune(runes, idx, '}')
+			} else if runes[idx] == 'p' || runes[idx] == 'P' {
+				idx++
+			}
+		case strings.HasPrefix(string(runes[idx:]), "(?P<"):
+			idx = skipPastRune(runes, idx, '>')
+		case unicode.IsUpper(runes[idx]):
+			return true
+		}
+	}
+	return false
+}
+
+// Gets the index of the first occurrence of the rune after the index (or the last index, if there isn't one)
+func skipPastRune(runes []rune, idx int, target rune) int {
+	for idx < len(runes)-1 && runes[idx] != target {
+		idx++
+	}
+	return idx
+}
+
+// ====================================================================================================
+//
+//	Motion Implementations
+//
+// ====================================================================================================
+func moveToSearchMatch(model *Model, cmd normalCommand) bool {
+	switch cmd.motion {
+	case "/", "?":
+		model.lastSearch = search{pattern: cmd.searchPattern, direction: searchDirections[cmd.motion]}
+	}
+
+	lastSearch := model.lastSearch
+	if lastSearch.pattern == "" {
+		return false
+	}
+
+	direction := lastSearch.direction
+	if cmd.motion == "N" {
+		direction = -direction
+	}
+	return model.moveToMatch(lastSearch.pattern, direction, cmd.getCount())
+}
+
+// Searches for the keyword under the cursor as a whole word ("*" searches forward and "#" backward)
+func moveToKeywordMatch(model *Model, cmd normalCommand) bool {
+	keyword, found := model.getKeywordUnderCursor()
+	if !found {
+		return false
+	}
+
+	direction := textarea.CursorMovementDirection_Right
+	if cmd.motion == "#" {
+		direction = textarea.CursorMovementDirection_Left
+	}
+
+	// The search starts from the start of the keyword, so that "#" doesn't just find the keyword under the cursor
+	start := model.area.GetCursorPosition()
+	line := model.area.GetLine(start.Row)
+	for start.Col > 0 && start.Col < len(line) && model.isKeywordRune(line[start.Col]) && model.isKeywordRune(line[start.Col-1]) {
+		start.Col--
+	}
+
+	model.lastSearch = search{pattern: model.getWholeKeywordPattern(keyword), direction: direction}
+	return model.moveToMatchFrom(model.lastSearch.pattern, start, direction, cmd.getCount())
+}
+
+// Gets a pattern matching the keyword as a whole word, i.e. not next to other keyword characters (as given by
+// "iskeyword", which Go's "\b" doesn't know about)
+// Go's regexps can't look around a match, so the characters around the keyword get matched too, with the keyword in
+// the textarea's match group.
+func (model *Model) getWholeKeywordPattern(keyword string) string {
+	nonKeywordChar := model.getNonKeywordCharPattern()
+	return fmt.Sprintf(`(?:^|%s)(?P<%s>%s)(?:%s|$)`, nonKeywordChar, textarea.MatchGroupName, regexp.QuoteMeta(keyword), nonKeywordChar)
+}
+
+// Gets a pattern matching any one character that isn't a keyword character
+// It's written with escapes, so that it doesn't have any uppercase characters for "smartcase" to notice.
+func (model *Model) getNonKeywordCharPattern() string {
+	// Characters from 256 up are keywords if they're letters or digits (see isKeywordRune)
+	alternatives := []string{`[^\x{0}-\x{ff}\pL\p{Nd}]`}
+
+	var ranges []string
+	for char := rune(0); char < rune(len(model.keywordChars)); char++ {
+		if model.isKeywordRune(char) {
+			continue
+		}
+		rangeStart := char
+		for char+1 < rune(len(model.keywordChars)) && !model.isKeywordRune(char+1) {
+			char++
+		}
+		ranges = append(ranges, fmt.Sprintf(`\x{%x}-\x{%x}`, rangeStart, char))
+	}
+	if len(ranges) > 0 {
+		alternatives = append(alternatives, "["+strings.Join(ranges, "")+"]")
+	}
+	return "(?:" + strings.Join(alternatives, "|") + ")"
+}
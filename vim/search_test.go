@@ -0,0 +1,85 @@
+package vim
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+func TestSearch(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"foo bar foo baz", 0, 0, "/foo<CR>", "foo bar foo baz", 0, 8},
+		{"foo bar foo baz", 0, 0, "/foo<CR>n", "foo bar foo baz", 0, 0},
+		{"foo bar foo baz", 0, 0, "/ba<CR>nN", "foo bar foo baz", 0, 4},
+		{"foo bar foo baz", 0, 0, "?ba<CR>", "foo bar foo baz", 0, 12},
+		{"a1 a2 a3 a4", 0, 0, "2/a<CR>", "a1 a2 a3 a4", 0, 6},
+		{"foo bar foo baz", 0, 0, "/bar<Esc>", "foo bar foo baz", 0, 0},
+
+		// Patterns that aren't valid yet get matched literally
+		{"a(b", 0, 0, "/(<CR>", "a(b", 0, 1},
+
+		// A search that fails leaves the cursor where it was
+		{"abc", 0, 0, "/zz<CR>x", "bc", 0, 0},
+
+		{"foo bar foo baz", 0, 0, "d/baz<CR>", "baz", 0, 0},
+		{"a1 a2 a3 a4", 0, 0, "d/a<CR>..", "a4", 0, 0},
+		{"a1 a2 a3 a4", 0, 0, "v/a3<CR>d", "3 a4", 0, 0},
+	})
+}
+
+func TestKeywordSearch(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a foo\nb foo\nc", 0, 2, "*", "a foo\nb foo\nc", 1, 2},
+		{"a foo\nb foo\nc", 1, 3, "#", "a foo\nb foo\nc", 0, 2},
+		{"foo foo foo", 0, 0, "**", "foo foo foo", 0, 8},
+		{"foo foo foo", 0, 0, "#", "foo foo foo", 0, 8},
+
+		// Only whole keywords match, as given by "iskeyword"
+		{"héllo héllox héllo", 0, 0, "*", "héllo héllox héllo", 0, 13},
+		{"foo-bar foo foo-bar", 0, 0, ":set iskeyword+=-<CR>*", "foo-bar foo foo-bar", 0, 12},
+		{"foo foobar foo", 0, 0, "*:%s//X/g<CR>", "X foobar X", 0, 0},
+
+		// The cursor only moves if there's a match
+		{"x foo bar\nbaz", 0, 3, "*", "x foo bar\nbaz", 0, 2},
+		{"x foo bar\nbaz", 0, 3, ":set nowrapscan<CR>*", "x foo bar\nbaz", 0, 3},
+	})
+}
+
+func TestIncrementalSearch(t *testing.T) {
+	model := newTestModel("foo bar")
+	sendKeys(model, "/ba")
+	if cursor := model.area.GetCursorPosition(); cursor != (textarea.Position{Row: 0, Col: 4}) {
+		t.Errorf("got the cursor at %v while typing the search, want it on the first match", cursor)
+	}
+	if !strings.Contains(model.View(), "/ba") {
+		t.Errorf("view doesn't show the search being typed")
+	}
+
+	sendKeys(model, "<Esc>")
+	if cursor := model.area.GetCursorPosition(); cursor != (textarea.Position{Row: 0, Col: 0}) {
+		t.Errorf("got the cursor at %v after cancelling the search, want it back where it started", cursor)
+	}
+}
+
+func TestSmartCase(t *testing.T) {
+	model := newTestModel("foo Foo")
+	model.Settings.IgnoreCase = true
+	model.Settings.SmartCase = true
+	for pattern, wantIgnoringCase := range map[string]bool{
+		"foo":             true,
+		"Foo":             false,
+		`\S\p{Lu}\pL`:     true,
+		`(?P<Name>x)`:     true,
+		`(?P<Name>x)\pLY`: false,
+	} {
+		if isIgnoringCase := model.isIgnoringCase(pattern); isIgnoringCase != wantIgnoringCase {
+			t.Errorf("got %v for whether %q ignores case, want %v", isIgnoringCase, pattern, wantIgnoringCase)
+		}
+	}
+
+	sendKeys(model, "/Foo<CR>")
+	if cursor := model.area.GetCursorPosition(); cursor != (textarea.Position{Row: 0, Col: 4}) {
+		t.Errorf("got the cursor at %v after searching for an uppercase pattern", cursor)
+	}
+}
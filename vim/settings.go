@@ -0,0 +1,235 @@
+package vim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Settings are the options that can be changed with ":set"
+type Settings struct {
+	// Whether searches wrap around the end of the buffer ("wrapscan")
+	WrapScan bool
+
+	// Whether searches ignore case ("ignorecase")
+	IgnoreCase bool
+
+	// Whether searches containing uppercase characters go back to matching case, when IgnoreCase is set ("smartcase")
+	SmartCase bool
+
+	// Whether the matches of the last search are highlighted ("hlsearch")
+	HighlightSearch bool
+
+	// Whether the cursor previews the match while a search pattern is being typed ("incsearch")
+	IncrementalSearch bool
+
+	// The characters that make up keywords, which words (e.g. for "w" or "iw") and "*" are made of ("iskeyword")
+	// It's in Vim's format, e.g. "@,48-57,_" for letters, digits and underscores.
+	IsKeyword string
+
+	// The pairs of characters that "%" jumps between and that get highlighted when the cursor is on one, e.g.
+	// "(:),[:]" ("matchpairs")
+	MatchPairs string
+
+	// The minimum number of rows kept above and below the cursor as it moves ("scrolloff")
+	ScrollOff int
+
+	// The number of rows that "ctrl+d" and "ctrl+u" scroll by, where 0 means half of the view ("scroll")
+	// It gets set by the count given to "ctrl+d" or "ctrl+u", like in Vim.
+	Scroll int
+
+	// The number of columns that ">" and "<" shift lines by, where 0 means to use TabStop ("shiftwidth")
+	ShiftWidth int
+
+	// The number of columns a tab character takes up ("tabstop")
+	TabStop int
+
+	// Whether indents are made of spaces rather than tabs ("expandtab")
+	// Unlike Vim this is on by default, since the textarea turns typed tabs into spaces anyway.
+	ExpandTab bool
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		WrapScan:          true,
+		IgnoreCase:        false,
+		SmartCase:         false,
+		HighlightSearch:   true,
+		IncrementalSearch: true,
+		IsKeyword:         "@,48-57,_,192-255",
+		MatchPairs:        "(:),{:},[:]",
+		ScrollOff:         0,
+		Scroll:            0,
+		ShiftWidth:        4,
+		TabStop:           8,
+		ExpandTab:         true,
+	}
+}
+
+// A setting as it's known to ":set"
+// Exactly one of the value getters is set, depending on the type of the setting.
+type option struct {
+	name         string
+	abbreviation string
+
+	getBoolValue   func(settings *Settings) *bool
+	getNumberValue func(settings *Settings) *int
+	getStringValue func(settings *Settings) *string
+
+	// Checks a new value of a string setting, if the setting needs checking
+	validate func(value string) error
+}
+
+var options = []option{
+	{name: "wrapscan", abbreviation: "ws", getBoolValue: func(settings *Settings) *bool { return &settings.WrapScan }},
+	{name: "ignorecase", abbreviation: "ic", getBoolValue: func(settings *Settings) *bool { return &settings.IgnoreCase }},
+	{name: "smartcase", abbreviation: "scs", getBoolValue: func(settings *Settings) *bool { return &settings.SmartCase }},
+	{name: "hlsearch", abbreviation: "hls", getBoolValue: func(settings *Settings) *bool { return &settings.HighlightSearch }},
+	{name: "incsearch", abbreviation: "is", getBoolValue: func(settings *Settings) *bool { return &settings.IncrementalSearch }},
+	{name: "iskeyword", abbreviation: "isk", getStringValue: func(settings *Settings) *string { return &settings.IsKeyword }, validate: validateKeywordChars},
+	{name: "scrolloff", abbreviation: "so", getNumberValue: func(settings *Settings) *int { return &settings.ScrollOff }},
+	{name: "scroll", abbreviation: "scr", getNumberValue: func(settings *Settings) *int { return &settings.Scroll }},
+	{name: "shiftwidth", abbreviation: "sw", getNumberValue: func(settings *Settings) *int { return &settings.ShiftWidth }},
+	{name: "tabstop", abbreviation: "ts", getNumberValue: func(settings *Settings) *int { return &settings.TabStop }},
+	{name: "expandtab", abbreviation: "et", getBoolValue: func(settings *Settings) *bool { return &settings.ExpandTab }},
+	{name: "matchpairs", abbreviation: "mps", getStringValue: func(settings *Settings) *string { return &settings.MatchPairs }, validate: validateMatchPairs},
+}
+
+func findOption(name string) (option, bool) {
+	for _, candidate := range options {
+		if name == candidate.name || name == candidate.abbreviation {
+			return candidate, true
+		}
+	}
+	return option{}, false
+}
+
+// Applies the arguments of a ":set" command (e.g. "noic hls shiftwidth=2"), returning the message to show (if any)
+// The forms Vim supports are "opt", "noopt", "invopt", "opt!", "opt?", "opt=value", "opt+=value" and "opt-=value".
+func (model *Model) applySetArguments(arguments string) (string, error) {
+	var messages []string
+	for _, argument := range strings.Fields(arguments) {
+		message, err := model.applySetArgument(argument)
+		if err != nil {
+			return "", err
+		}
+		if message != "" {
+			messages = append(messages, message)
+		}
+	}
+	return strings.Join(messages, "  "), nil
+}
+
+func (model *Model) applySetArgument(argument string) (string, error) {
+	name, value, operator := argument, "", ""
+	if idx := strings.IndexAny(argument, "=:"); idx > 0 {
+		name, value, operator = argument[:idx], argument[idx+1:], "="
+		if strings.HasSuffix(name, "+") || strings.HasSuffix(name, "-") || strings.HasSuffix(name, "^") {
+			operator = name[len(name)-1:] + "="
+			name = name[:len(name)-1]
+		}
+	}
+
+	isQuery := strings.HasSuffix(name, "?")
+	isToggle := strings.HasSuffix(name, "!")
+	name = strings.TrimRight(name, "?!")
+
+	opt, found := findOption(name)
+	boolValue := true
+	if !found && strings.HasPrefix(name, "no") {
+		opt, found = findOption(strings.TrimPrefix(name, "no"))
+		boolValue = false
+	}
+	if !found && strings.HasPrefix(name, "inv") {
+		opt, found = findOption(strings.TrimPrefix(name, "inv"))
+		isToggle = true
+	}
+	if !found {
+		return "", fmt.Errorf("E518: Unknown option: %s", argument)
+	}
+
+	settings := &model.Settings
+	switch {
+	case opt.getBoolValue != nil:
+		boolPtr := opt.getBoolValue(settings)
+		switch {
+		case operator != "":
+			return "", fmt.Errorf("E474: Invalid argument: %s", argument)
+		case isQuery:
+			if *boolPtr {
+				return opt.name, nil
+			}
+			return "no" + opt.name, nil
+		case isToggle:
+			*boolPtr = !*boolPtr
+		default:
+			*boolPtr = boolValue
+		}
+	case opt.getNumberValue != nil:
+		numberPtr := opt.getNumberValue(settings)
+		if operator == "" {
+			return fmt.Sprintf("%s=%d", opt.name, *numberPtr), nil
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("E521: Number required after =: %s", argument)
+		}
+		switch operator {
+		case "+=":
+			*numberPtr += number
+		case "-=":
+			*numberPtr -= number
+		case "^=":
+			*numberPtr *= number
+		default:
+			*numberPtr = number
+		}
+	case opt.getStringValue != nil:
+		stringPtr := opt.getStringValue(settings)
+		if operator == "" {
+			return fmt.Sprintf("%s=%s", opt.name, *stringPtr), nil
+		}
+		newValue := value
+		switch operator {
+		case "+=":
+			newValue = joinOptionValues(*stringPtr, value)
+		case "^=":
+			newValue = joinOptionValues(value, *stringPtr)
+		case "-=":
+			newValue = removeOptionValue(*stringPtr, value)
+		}
+		if opt.validate != nil {
+			if err := opt.validate(newValue); err != nil {
+				return "", err
+			}
+		}
+		*stringPtr = newValue
+	}
+
+	model.applySettings()
+	return "", nil
+}
+
+// Makes any changes needed for the current settings to take effect
+func (model *Model) applySettings() {
+	model.updateSearchHighlight()
+}
+
+// Joins two comma-separated option values
+func joinOptionValues(first string, second string) string {
+	if first == "" || second == "" {
+		return first + second
+	}
+	return first + "," + second
+}
+
+// Removes an entry from a comma-separated option value
+func removeOptionValue(optionValue string, toRemove string) string {
+	var kept []string
+	for _, entry := range strings.Split(optionValue, ",") {
+		if entry != toRemove {
+			kept = append(kept, entry)
+		}
+	}
+	return strings.Join(kept, ",")
+}
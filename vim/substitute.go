@@ -0,0 +1,527 @@
+package vim
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// Substitutions changing more lines than this report how many substitutions they made, like Vim's "report" option
+const numLinesToReportSubstitutions = 2
+
+// A ":s" command, as remembered for repeating with ":&", "&" and "g&"
+type substitution struct {
+	pattern string
+
+	// As typed, in Vim's syntax (e.g. "\1" or "&")
+	replacement string
+
+	flags substitutionFlags
+}
+
+type substitutionFlags struct {
+	// "g": replace every match in the line rather than just the first
+	isGlobal bool
+
+	// "c": ask before replacing each match
+	isConfirming bool
+
+	// "n": count the matches without replacing them
+	isCountOnly bool
+
+	// "e": don't treat finding no matches as an error
+	isSuppressingErrors bool
+
+	// "i" and "I": ignore or match case, regardless of the "ignorecase" setting
+	isIgnoringCase bool
+	isMatchingCase bool
+}
+
+// A substitution in progress, which works through the matches one line at a time
+// When confirming, this waits between matches for the user to say what to do with the match.
+type substitutionRun struct {
+	pattern *regexp.Regexp
+
+	// In the syntax of regexp.Expand
+	template string
+
+	flags substitutionFlags
+
+	// The row of the line being worked on, and the last row to work on
+	// The last row moves as replacements containing line breaks add rows.
+	row    int
+	endRow int
+
+	// The line being worked on as it was before any replacements, and its matches
+	line    string
+	matches [][]int
+
+	// The next match to decide on
+	matchIdx int
+
+	// The line's new text up to the end of the last match decided on, and where in the original line that is
+	newText     []byte
+	previousEnd int
+
+	// How many rows the line takes up, which goes up when replacements contain line breaks
+	numRows int
+
+	numSubstitutions    int
+	numSubstitutedLines int
+	isLineSubstituted   bool
+	lastSubstitutedRow  int
+
+	// Where the cursor goes back to if nothing gets substituted
+	originalCursor textarea.Position
+}
+
+// ":[range]s/{pattern}/{replacement}/[flags] [count]" replaces matches of the pattern in the lines of the range (or in
+// count lines, starting at the end of the range)
+// The pattern uses Go's regexp syntax. The replacement can refer to groups with "\1" or "$1", to the whole match with
+// "&", to the previous replacement with "~", and break the line with "\r". Any character other than a letter, digit,
+// backslash, double quote or "|" can be used in place of "/". Without a pattern (e.g. ":s" or ":s g") the last
+// substitution gets repeated, without its flags unless they start with "&".
+func runSubstitute(model *Model, invocation CommandInvocation) (tea.Cmd, error) {
+	args := []rune(invocation.Args)
+	if len(args) == 0 || !isValidPatternDelimiter(args[0]) {
+		return runRepeatSubstitute(model, invocation)
+	}
+	delimiter := args[0]
+	args = args[1:]
+
+	pattern, patternLength := splitAtDelimiter(args, delimiter)
+	args = args[min(patternLength+1, len(args)):]
+	replacement, replacementLength := splitAtDelimiter(args, delimiter)
+	args = args[min(replacementLength+1, len(args)):]
+
+	// Like Vim, an empty pattern means the last search pattern
+	if pattern == "" {
+		pattern = model.lastSearch.pattern
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("E35: No previous regular expression")
+	}
+
+	previousReplacement := ""
+	if model.lastSubstitution != nil {
+		previousReplacement = model.lastSubstitution.replacement
+	}
+	replacement = expandPreviousReplacement(replacement, previousReplacement)
+
+	return model.substitute(invocation, substitution{pattern: pattern, replacement: replacement}, string(args))
+}
+
+// ":[range]&[&][flags] [count]" repeats the last substitution, with "&&" keeping its flags
+func runRepeatSubstitute(model *Model, invocation CommandInvocation) (tea.Cmd, error) {
+	if model.lastSubstitution == nil {
+		return nil, fmt.Errorf("E35: No previous regular expression")
+	}
+	return model.substitute(invocation, substitution{
+		pattern:     model.lastSubstitution.pattern,
+		replacement: model.lastSubstitution.replacement,
+	}, invocation.Args)
+}
+
+// Runs the substitution on the invocation's range, after parsing the flags and count that follow it
+func (model *Model) substitute(invocation CommandInvocation, sub substitution, flagsAndCount string) (tea.Cmd, error) {
+	flags, startRow, endRow, err := model.parseSubstitutionFlagsAndCount(flagsAndCount, invocation.StartRow, invocation.EndRow)
+	if err != nil {
+		return nil, err
+	}
+	sub.flags = flags
+
+	// There's no way for ":g" to wait for the answers
+	if flags.isConfirming && model.isRunningGlobal {
+		return nil, fmt.Errorf("Can't confirm substitutions within :global")
+	}
+
+	model.lastSubstitution = &sub
+	model.lastSearch.pattern = sub.pattern
+	model.isHighlightingSearch = true
+	model.updateSearchHighlight()
+
+	run := &substitutionRun{
+		pattern:            model.compileSubstitutionPattern(sub.pattern, flags),
+		template:           getReplacementTemplate(sub.replacement),
+		flags:              flags,
+		row:                startRow,
+		endRow:             endRow,
+		lastSubstitutedRow: -1,
+		originalCursor:     model.area.GetCursorPosition(),
+	}
+
+	model.pendingSubstitution = run
+
+	// Confirming waits for the user's answers, so the substitution finishes (and gets checkpointed) later
+	if flags.isConfirming && !flags.isCountOnly {
+		if !model.showNextSubstitutionMatch() {
+			return nil, model.finishSubstitution()
+		}
+		return nil, nil
+	}
+
+	for run.findNextMatch(model) {
+		run.decide(true)
+	}
+	return nil, model.finishSubstitution()
+}
+
+// Parses the flags after the replacement (e.g. "gc"), along with an optional count (e.g. "g 3") which makes the range
+// that many lines starting at the end of the given range
+func (model *Model) parseSubstitutionFlagsAndCount(text string, startRow int, endRow int) (substitutionFlags, int, int, error) {
+	var flags substitutionFlags
+	runes := []rune(strings.TrimLeft(text, " \t"))
+
+	// "&" keeps the flags of the last substitution, and has to come first
+	if len(runes) > 0 && runes[0] == '&' {
+		if model.lastSubstitution != nil {
+			flags = model.lastSubstitution.flags
+		}
+		runes = runes[1:]
+	}
+
+	idx := 0
+	for ; idx < len(runes) && !unicode.IsSpace(runes[idx]) && !unicode.IsDigit(runes[idx]); idx++ {
+		switch runes[idx] {
+		case 'g':
+			flags.isGlobal = !flags.isGlobal
+		case 'c':
+			flags.isConfirming = true
+		case 'n':
+			flags.isCountOnly = true
+		case 'e':
+			flags.isSuppressingErrors = true
+		case 'i':
+			flags.isIgnoringCase, flags.isMatchingCase = true, false
+		case 'I':
+			flags.isIgnoringCase, flags.isMatchingCase = false, true
+		default:
+			return flags, 0, 0, fmt.Errorf("E488: Trailing characters: %s", string(runes[idx:]))
+		}
+	}
+
+	rest := []rune(strings.TrimLeft(string(runes[idx:]), " \t"))
+	if len(rest) == 0 {
+		return flags, startRow, endRow, nil
+	}
+	count, numDigits := parseNumber(rest)
+	if numDigits != len(rest) || count == 0 {
+		return flags, 0, 0, fmt.Errorf("E488: Trailing characters: %s", string(rest))
+	}
+	return flags, endRow, min(endRow+count-1, model.area.GetNumRows()-1), nil
+}
+
+// The "i" and "I" flags override the "ignorecase" and "smartcase" settings
+func (model *Model) compileSubstitutionPattern(pattern string, flags substitutionFlags) *regexp.Regexp {
+	if !flags.isIgnoringCase && !flags.isMatchingCase {
+		return model.compileSearchPattern(pattern)
+	}
+
+	prefix := ""
+	if flags.isIgnoringCase {
+		prefix = "(?i)"
+	}
+	compiledPattern, err := regexp.Compile(prefix + pattern)
+	if err != nil {
+		return regexp.MustCompile(prefix + regexp.QuoteMeta(pattern))
+	}
+	return compiledPattern
+}
+
+// Moves the cursor to the last line that was substituted on, and reports how the substitution went
+func (model *Model) finishSubstitution() error {
+	run := model.pendingSubstitution
+	model.pendingSubstitution = nil
+	if run == nil {
+		return nil
+	}
+	model.area.ClearSelection()
+
+	if run.numSubstitutions == 0 {
+		model.area.SetCursorPosition(run.originalCursor)
+
+		// Like Vim, ":g" running ":s" on lines it doesn't match isn't an error
+		if run.flags.isSuppressingErrors || model.isRunningGlobal {
+			return nil
+		}
+		return fmt.Errorf("E486: Pattern not found: %s", model.lastSubstitution.pattern)
+	}
+
+	moveToFirstNonBlankOfRow(model, run.lastSubstitutedRow)
+	switch {
+	case run.flags.isCountOnly:
+		model.statusMessage = fmt.Sprintf("%d matches on %d lines", run.numSubstitutions, run.numSubstitutedLines)
+	case run.numSubstitutedLines > numLinesToReportSubstitutions:
+		model.statusMessage = fmt.Sprintf("%d substitutions on %d lines", run.numSubstitutions, run.numSubstitutedLines)
+	}
+	return nil
+}
+
+// ====================================================================================================
+//
+//	Running Substitutions
+//
+// ====================================================================================================
+// Moves on to the next match to decide on, writing each finished line back to the buffer, and returns false once
+// there are no more matches in the range
+func (run *substitutionRun) findNextMatch(model *Model) bool {
+	for run.row <= run.endRow && run.row < model.area.GetNumRows() {
+		if run.matches == nil {
+			run.startLine(model)
+		}
+		if run.matchIdx < len(run.matches) {
+			return true
+		}
+		run.finishLine(model)
+	}
+	return false
+}
+
+func (run *substitutionRun) startLine(model *Model) {
+	run.line = string(model.area.GetLine(run.row))
+	limit := 1
+	if run.flags.isGlobal {
+		limit = -1
+	}
+	run.matches = textarea.FindAllMatchIndexes(run.pattern, run.line, limit)
+	if run.matches == nil {
+		run.matches = [][]int{}
+	}
+	run.matchIdx = 0
+	run.newText = nil
+	run.previousEnd = 0
+	run.numRows = 1
+	run.isLineSubstituted = false
+}
+
+// Writes the line back to the buffer and moves on to the next one, accounting for any rows that replacements added
+func (run *substitutionRun) finishLine(model *Model) {
+	if run.isLineSubstituted {
+		if !run.flags.isCountOnly {
+			run.writeLine(model)
+		}
+		run.numSubstitutedLines++
+		run.lastSubstitutedRow = run.row + run.numRows - 1
+	}
+	run.row += run.numRows
+	run.endRow += run.numRows - 1
+	run.matches = nil
+}
+
+// Replaces the current match (or leaves it be), and moves on to the next one
+// The replacement only reaches the buffer when the line gets written.
+func (run *substitutionRun) decide(shouldReplace bool) {
+	match := run.matches[run.matchIdx]
+	run.matchIdx++
+	if !shouldReplace {
+		run.newText = append(run.newText, run.line[run.previousEnd:match[1]]...)
+		run.previousEnd = match[1]
+		return
+	}
+
+	run.numSubstitutions++
+	run.isLineSubstituted = true
+	if run.flags.isCountOnly {
+		return
+	}
+
+	run.newText = append(run.newText, run.line[run.previousEnd:match[0]]...)
+	run.newText = run.pattern.ExpandString(run.newText, run.template, run.line, match)
+	run.previousEnd = match[1]
+}
+
+// Writes the line's new text to the buffer, replacing the rows it took up before
+func (run *substitutionRun) writeLine(model *Model) {
+	newLines := strings.Split(string(run.newText)+run.line[run.previousEnd:], "\n")
+	if run.numRows > 1 {
+		model.area.DeleteLines(run.row+1, run.row+run.numRows-1)
+	}
+	model.area.SetLine(run.row, []rune(newLines[0]))
+	model.area.InsertLines(run.row+1, newLines[1:])
+	run.numRows = len(newLines)
+}
+
+// Gets where the next match to decide on currently is in the buffer (it may have moved because of the replacements
+// before it), along with where it ends
+func (run *substitutionRun) getMatchPositions() (textarea.Position, textarea.Position) {
+	match := run.matches[run.matchIdx]
+	textBefore := string(run.newText) + run.line[run.previousEnd:match[0]]
+	start := getPositionAfterText(run.row, textBefore)
+	end := getPositionAfterText(start.Row, run.line[match[0]:match[1]])
+	if start.Row == end.Row {
+		end.Col += start.Col
+	}
+	return start, end
+}
+
+// Gets the position just after the text, if the text started at the beginning of the row
+func getPositionAfterText(row int, text string) textarea.Position {
+	lines := strings.Split(text, "\n")
+	return textarea.Position{Row: row + len(lines) - 1, Col: len([]rune(lines[len(lines)-1]))}
+}
+
+// ====================================================================================================
+//
+//	Confirmation
+//
+// ====================================================================================================
+// Highlights the next match of the confirming substitution and puts the cursor on it, returning false if there are
+// no more matches
+func (model *Model) showNextSubstitutionMatch() bool {
+	run := model.pendingSubstitution
+	if !run.findNextMatch(model) {
+		return false
+	}
+
+	start, end := run.getMatchPositions()
+	model.area.SetCursorPosition(start)
+	if start == end {
+		model.area.ClearSelection()
+		return true
+	}
+	lastMatchRune := textarea.Position{Row: end.Row, Col: end.Col - 1}
+	if end.Col == 0 {
+		lastMatchRune = textarea.Position{Row: end.Row - 1, Col: model.area.GetLineLength(end.Row - 1)}
+	}
+	model.area.SetSelection(textarea.SelectionMode_Characterwise, lastMatchRune)
+	return true
+}
+
+// Handles the answer to "replace with ...?" while a substitution is being confirmed
+func (model *Model) handleSubstitutionConfirmationKey(msg tea.KeyMsg) {
+	run := model.pendingSubstitution
+
+	switch msg.String() {
+	case "y":
+		run.decide(true)
+		run.writeLine(model)
+	case "n":
+		run.decide(false)
+	case "a":
+		for {
+			run.decide(true)
+			if !run.findNextMatch(model) {
+				break
+			}
+		}
+	case "l":
+		run.decide(true)
+		model.stopConfirmingSubstitution()
+		return
+	case "q", "esc", "ctrl+c":
+		model.stopConfirmingSubstitution()
+		return
+	default:
+		return
+	}
+
+	if !model.showNextSubstitutionMatch() {
+		model.stopConfirmingSubstitution()
+	}
+}
+
+// Finishes the substitution being confirmed, leaving the rest of its matches alone
+func (model *Model) stopConfirmingSubstitution() {
+	run := model.pendingSubstitution
+	if run.matches != nil {
+		run.finishLine(model)
+	}
+
+	if err := model.finishSubstitution(); err != nil {
+		model.statusMessage = err.Error()
+	}
+	model.bindCursorToLine()
+	model.CheckpointHistory()
+}
+
+func (model Model) renderSubstitutionPrompt() string {
+	runes := []rune(fmt.Sprintf("replace with %s (y/n/a/q/l)?", model.lastSubstitution.replacement))
+	if len(runes) > model.width {
+		runes = runes[:max(0, model.width)]
+	}
+	return string(runes) + strings.Repeat(" ", model.width-len(runes))
+}
+
+// ====================================================================================================
+//
+//	Replacements
+//
+// ====================================================================================================
+// Replaces each unescaped "~" in the replacement with the previous replacement, like Vim
+func expandPreviousReplacement(replacement string, previousReplacement string) string {
+	resultBuilder := strings.Builder{}
+	runes := []rune(replacement)
+	for idx := 0; idx < len(runes); idx++ {
+		switch {
+		case runes[idx] == '\\' && idx+1 < len(runes):
+			resultBuilder.WriteRune(runes[idx])
+			idx++
+			resultBuilder.WriteRune(runes[idx])
+		case runes[idx] == '~':
+			resultBuilder.WriteString(previousReplacement)
+		default:
+			resultBuilder.WriteRune(runes[idx])
+		}
+	}
+	return resultBuilder.String()
+}
+
+// Converts a replacement in Vim's syntax into a template for regexp.Expand, which handles the "$1" and "${name}" forms
+// of groups itself
+func getReplacementTemplate(replacement string) string {
+	resultBuilder := strings.Builder{}
+	runes := []rune(replacement)
+	for idx := 0; idx < len(runes); idx++ {
+		char := runes[idx]
+		if char == '&' {
+			resultBuilder.WriteString("${0}")
+			continue
+		}
+		if char != '\\' || idx+1 >= len(runes) {
+			resultBuilder.WriteRune(char)
+			continue
+		}
+
+		idx++
+		switch escaped := runes[idx]; {
+		case escaped >= '0' && escaped <= '9':
+			resultBuilder.WriteString("${" + string(escaped) + "}")
+		case escaped == 'r' || escaped == 'n':
+			resultBuilder.WriteRune('\n')
+		case escaped == 't':
+			resultBuilder.WriteRune('\t')
+		case escaped == '$':
+			resultBuilder.WriteString("$$")
+		default:
+			resultBuilder.WriteRune(escaped)
+		}
+	}
+	return resultBuilder.String()
+}
+
+func isValidPatternDelimiter(char rune) bool {
+	switch {
+	case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9':
+		return false
+	}
+	return !strings.ContainsRune("\\\"| \t&", char)
+}
+
+// ====================================================================================================
+//
+//	Action Implementations
+//
+// ====================================================================================================
+// "&" repeats the last substitution on the cursor's line, without its flags
+func repeatSubstitutionOnLine(model *Model, cmd normalCommand) {
+	model.executeExCommandLine("s")
+}
+
+// "g&" repeats the last substitution on every line, with its flags and the last search pattern
+func repeatSubstitutionEverywhere(model *Model, cmd normalCommand) {
+	model.executeExCommandLine("%s//~/&")
+}
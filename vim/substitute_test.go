@@ -0,0 +1,77 @@
+package vim
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSubstitute(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a a\nb a\na", 0, 0, ":%s/a/b/<CR>", "b a\nb b\nb", 2, 0},
+		{"Foo foo", 0, 0, `:s/foo/x/gi<CR>`, "x x", 0, 0},
+		{"a\na\na\na", 0, 0, `:s/a/b/ 2<CR>`, "b\nb\na\na", 1, 0},
+		{"ab", 0, 1, `:s/$/;/<CR>`, "ab;", 0, 0},
+
+		// Vim's replacement syntax, along with Go's
+		{"foo bar", 0, 0, `:s/(\w+) (\w+)/\2 \1/<CR>`, "bar foo", 0, 0},
+		{"foo bar", 0, 0, `:s/o/<&>/g<CR>`, "f<o><o> bar", 0, 0},
+		{"foo bar", 0, 0, `:s/o/\&/g<CR>`, "f&& bar", 0, 0},
+		{"a1", 0, 0, `:s/(\d)/[$1]/<CR>`, "a[1]", 0, 0},
+		{"a1", 0, 0, `:s/\d/$$/<CR>`, "a$", 0, 0},
+		{"a b", 0, 0, `:s/a/x/<CR>:s/b/~y/<CR>`, "x xy", 0, 0},
+
+		// "\r" splits the line
+		{"a,b,c", 0, 0, `:s/,/\r/g<CR>`, "a\nb\nc", 2, 0},
+		{"a,b\nc,d", 0, 0, `:%s/,/\r/g<CR>`, "a\nb\nc\nd", 3, 0},
+
+		// "e" hides the error for there being no match
+		{"a", 0, 0, `:s/z/x/e<CR>`, "a", 0, 0},
+	})
+}
+
+func TestRepeatedSubstitute(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\na\na", 0, 0, `:s/a/b/<CR>j:&<CR>`, "b\nb\na", 1, 0},
+		{"aa\naa\naa", 0, 0, `:s/a/b/g<CR>j:&&<CR>`, "bb\nbb\naa", 1, 0},
+		{"aa\naa\naa", 0, 0, `:s/a/b/g<CR>j&`, "bb\nba\naa", 1, 0},
+		{"aa\naa\naa", 0, 0, `:s/a/b/g<CR>g&`, "bb\nbb\nbb", 2, 0},
+	})
+}
+
+func TestConfirmedSubstitute(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a a a\na", 0, 0, `:%s/a/b/gc<CR>ynyy`, "b a b\nb", 1, 0},
+		{"a a a\na", 0, 0, `:%s/a/b/gc<CR>nq`, "a a a\na", 0, 0},
+		{"a a a\na", 0, 0, `:%s/a/b/gc<CR>na`, "a b b\nb", 1, 0},
+		{"a a a\na", 0, 0, `:%s/a/b/gc<CR>nl`, "a b a\na", 0, 0},
+		{"a,a\na", 0, 0, `:%s/,/\r/gc<CR>y`, "a\na\na", 1, 0},
+		{"a a\na", 0, 0, `:%s/a/x\ry/gc<CR>yyy`, "x\ny x\ny\nx\ny", 4, 0},
+	})
+
+	model := newTestModel("a a\na")
+	sendKeys(model, ":%s/a/b/gc<CR>")
+	if !strings.Contains(model.View(), "replace with b") {
+		t.Errorf("view doesn't show the confirmation prompt")
+	}
+}
+
+func TestSubstituteIsUndoneTogether(t *testing.T) {
+	for _, keys := range []string{":%s/a/b/g<CR>u", ":%s/a/b/gc<CR>yyyu", ":%s/a/b/gc<CR>yqu"} {
+		model := newTestModel("a a\na")
+		sendKeys(model, keys)
+		if value := model.GetValue(); value != "a a\na" {
+			t.Errorf("got %q after %q", value, keys)
+		}
+	}
+}
+
+func TestCountingSubstitute(t *testing.T) {
+	model := newTestModel("a a\na\na\na")
+	sendKeys(model, ":%s/a/b/gn<CR>")
+	if model.statusMessage != "5 matches on 4 lines" {
+		t.Errorf("got status message %q", model.statusMessage)
+	}
+	if value := model.GetValue(); value != "a a\na\na\na" {
+		t.Errorf("got %q after only counting the matches", value)
+	}
+}
@@ -0,0 +1,673 @@
+package vim
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// A region of text around the cursor that can be used after an operator (e.g. "diw") or in visual mode (e.g. "vi(")
+// Objects starting with "i" are the "inner" version, which leaves out surrounding whitespace or delimiters, and
+// objects starting with "a" include them.
+type textObject struct {
+	// Whether the objects can nest (like brackets), in which case using the object on a visual selection that already
+	// covers it selects the next one out
+	isNesting bool
+
+	// Finds the range of the object (or count of them, or count levels out for nesting objects) around the given
+	// position, returning false if there isn't one
+	selectRange func(model *Model, cmd normalCommand, pos textarea.Position) (textRange, bool)
+}
+
+var textObjects = map[string]textObject{
+	"iw": {isNesting: false, selectRange: selectWord},
+	"aw": {isNesting: false, selectRange: selectWord},
+	"iW": {isNesting: false, selectRange: selectWord},
+	"aW": {isNesting: false, selectRange: selectWord},
+	"is": {isNesting: false, selectRange: selectSentence},
+	"as": {isNesting: false, selectRange: selectSentence},
+	"ip": {isNesting: false, selectRange: selectParagraph},
+	"ap": {isNesting: false, selectRange: selectParagraph},
+	`i"`: {isNesting: false, selectRange: selectQuoted},
+	`a"`: {isNesting: false, selectRange: selectQuoted},
+	"i'": {isNesting: false, selectRange: selectQuoted},
+	"a'": {isNesting: false, selectRange: selectQuoted},
+	"i`": {isNesting: false, selectRange: selectQuoted},
+	"a`": {isNesting: false, selectRange: selectQuoted},
+	"i(": {isNesting: true, selectRange: selectBracketed},
+	"a(": {isNesting: true, selectRange: selectBracketed},
+	"i)": {isNesting: true, selectRange: selectBracketed},
+	"a)": {isNesting: true, selectRange: selectBracketed},
+	"ib": {isNesting: true, selectRange: selectBracketed},
+	"ab": {isNesting: true, selectRange: selectBracketed},
+	"i{": {isNesting: true, selectRange: selectBracketed},
+	"a{": {isNesting: true, selectRange: selectBracketed},
+	"i}": {isNesting: true, selectRange: selectBracketed},
+	"a}": {isNesting: true, selectRange: selectBracketed},
+	"iB": {isNesting: true, selectRange: selectBracketed},
+	"aB": {isNesting: true, selectRange: selectBracketed},
+	"i[": {isNesting: true, selectRange: selectBracketed},
+	"a[": {isNesting: true, selectRange: selectBracketed},
+	"i]": {isNesting: true, selectRange: selectBracketed},
+	"a]": {isNesting: true, selectRange: selectBracketed},
+	"i<": {isNesting: true, selectRange: selectBracketed},
+	"a<": {isNesting: true, selectRange: selectBracketed},
+	"i>": {isNesting: true, selectRange: selectBracketed},
+	"a>": {isNesting: true, selectRange: selectBracketed},
+	"it": {isNesting: true, selectRange: selectTagged},
+	"at": {isNesting: true, selectRange: selectTagged},
+}
+
+// The opening and closing brackets for each of the bracket objects, keyed by the character after the "i" or "a"
+var bracketObjectPairs = map[rune][2]rune{
+	'(': {'(', ')'},
+	')': {'(', ')'},
+	'b': {'(', ')'},
+	'{': {'{', '}'},
+	'}': {'{', '}'},
+	'B': {'{', '}'},
+	'[': {'[', ']'},
+	']': {'[', ']'},
+	'<': {'<', '>'},
+	'>': {'<', '>'},
+}
+
+// Matches an HTML/XML tag, capturing whether it's a closing tag, its name, and whether it closes itself
+var tagPattern = regexp.MustCompile(`<(/?)([^\s<>/]+)[^<>]*?(/?)>`)
+
+// Whether the text object includes its surroundings (e.g. "aw") rather than being the inner version (e.g. "iw")
+func isAroundTextObject(name string) bool {
+	return strings.HasPrefix(name, "a")
+}
+
+// Applies the text object given after an operator, returning false if there was no such object at the cursor
+func (model *Model) selectTextObject(cmd normalCommand) (textRange, bool) {
+	return textObjects[cmd.textObject].selectRange(model, cmd, model.area.GetCursorPosition())
+}
+
+// Selects the text object in visual mode
+// Nesting objects select the innermost object that's bigger than the selection. Other objects select the object
+// under the cursor when only a single character is selected, and otherwise extend the selection by the object after
+// the cursor.
+func (model *Model) selectTextObjectInVisualMode(cmd normalCommand) bool {
+	objectDef := textObjects[cmd.textObject]
+	anchor, cursor := model.visualAnchor, model.area.GetCursorPosition()
+
+	var rng textRange
+	switch {
+	case model.mode == VisualBlockMode || (anchor == cursor && !objectDef.isNesting):
+		var found bool
+		if rng, found = objectDef.selectRange(model, cmd, cursor); !found {
+			return false
+		}
+	case objectDef.isNesting:
+		selection := model.getSelectionRange()
+		for count := cmd.getCount(); ; count++ {
+			cmd.count = count
+			var found bool
+			if rng, found = objectDef.selectRange(model, cmd, cursor); !found {
+				return false
+			}
+			if rng.start.IsBefore(selection.start) || selection.end.IsBefore(rng.end) {
+				break
+			}
+		}
+	default:
+		// The object after the cursor starts right after it, which may be on the next row
+		next := textarea.Position{Row: cursor.Row, Col: cursor.Col + 1}
+		if cursor.IsBefore(anchor) {
+			next.Col = cursor.Col - 1
+		}
+		if next.Col >= model.area.GetLineLength(cursor.Row) {
+			if cursor.Row+1 >= model.area.GetNumRows() {
+				return false
+			}
+			next = textarea.Position{Row: cursor.Row + 1, Col: 0}
+		}
+		if next.Col < 0 {
+			return false
+		}
+
+		extension, found := objectDef.selectRange(model, cmd, next)
+		if !found {
+			return false
+		}
+		rng = textRange{start: anchor, end: extension.end, kind: extension.kind}
+		if cursor.IsBefore(anchor) {
+			rng = textRange{start: extension.start, end: textarea.Position{Row: anchor.Row, Col: anchor.Col + 1}, kind: extension.kind}
+			model.selectRange(rng, true)
+			return true
+		}
+	}
+
+	model.selectRange(rng, false)
+	return true
+}
+
+// Makes the range the visual selection, with the cursor at its end (or its start, if isCursorAtStart is set)
+// Linewise ranges switch to linewise visual mode, and characterwise ones switch away from it.
+func (model *Model) selectRange(rng textRange, isCursorAtStart bool) {
+	mode := model.mode
+	switch {
+	case rng.kind == rangeKind_Linewise:
+		mode = VisualLineMode
+	case model.mode == VisualLineMode:
+		mode = VisualMode
+	}
+
+	// The visual selection includes the character under the cursor, so its end is one before the range's end
+	lastPos := rng.end
+	if rng.kind != rangeKind_Linewise && rng.start.IsBefore(rng.end) {
+		if lastPos.Col > 0 {
+			lastPos.Col--
+		} else {
+			lastPos = textarea.Position{Row: lastPos.Row - 1, Col: model.area.GetLineLength(lastPos.Row - 1)}
+		}
+	}
+
+	anchor, cursor := rng.start, lastPos
+	if isCursorAtStart {
+		anchor, cursor = cursor, anchor
+	}
+	model.area.SetCursorPosition(cursor)
+	model.enterVisualMode(mode, anchor)
+}
+
+// ====================================================================================================
+//
+//	Words
+//
+// ====================================================================================================
+// "iw" selects count words (with the whitespace between words counting as a word), and "aw" selects count words along
+// with the whitespace after them (or before them, if there's none after)
+// Words don't span rows, but counts carry on to the next row.
+func selectWord(model *Model, cmd normalCommand, pos textarea.Position) (textRange, bool) {
+	isBigWord := strings.HasSuffix(cmd.textObject, "W")
+	start, end, class := model.getWordRun(pos, isBigWord)
+
+	if !isAroundTextObject(cmd.textObject) {
+		for i := 1; i < cmd.getCount(); i++ {
+			var found bool
+			if _, end, _, found = model.getNextWordRun(end, isBigWord); !found {
+				return textRange{}, false
+			}
+		}
+		return textRange{start: start, end: end}, true
+	}
+
+	// Starting on whitespace selects the whitespace along with the words after it
+	numWords := 0
+	if class != charClass_Whitespace {
+		numWords = 1
+	}
+	for numWords < cmd.getCount() {
+		_, nextEnd, nextClass, found := model.getNextWordRun(end, isBigWord)
+		if !found {
+			return textRange{}, false
+		}
+		end = nextEnd
+		if nextClass != charClass_Whitespace {
+			numWords++
+		}
+	}
+	if class == charClass_Whitespace {
+		return textRange{start: start, end: end}, true
+	}
+
+	// Trailing whitespace has to be on the same row
+	line := model.area.GetLine(end.Row)
+	if end.Col < len(line) && model.getCharClass(line[end.Col], isBigWord) == charClass_Whitespace {
+		_, end, _ = model.getWordRun(end, isBigWord)
+		return textRange{start: start, end: end}, true
+	}
+	startLine := model.area.GetLine(start.Row)
+	for start.Col > 0 && unicode.IsSpace(startLine[start.Col-1]) {
+		start.Col--
+	}
+	return textRange{start: start, end: end}, true
+}
+
+// Gets the run of characters of the same class as the one at the position, within its row
+// An empty row is an empty run of whitespace.
+func (model *Model) getWordRun(pos textarea.Position, isBigWord bool) (textarea.Position, textarea.Position, charClass) {
+	line := model.area.GetLine(pos.Row)
+	if len(line) == 0 {
+		return textarea.Position{Row: pos.Row, Col: 0}, textarea.Position{Row: pos.Row, Col: 0}, charClass_Whitespace
+	}
+
+	col := clamp(pos.Col, 0, len(line)-1)
+	class := model.getCharClass(line[col], isBigWord)
+	start, end := col, col+1
+	for start > 0 && model.getCharClass(line[start-1], isBigWord) == class {
+		start--
+	}
+	for end < len(line) && model.getCharClass(line[end], isBigWord) == class {
+		end++
+	}
+	return textarea.Position{Row: pos.Row, Col: start}, textarea.Position{Row: pos.Row, Col: end}, class
+}
+
+// Gets the run after the one ending at the given position, which is the first run of the next row if the position
+// is at the end of its row
+func (model *Model) getNextWordRun(end textarea.Position, isBigWord bool) (textarea.Position, textarea.Position, charClass, bool) {
+	if end.Col >= model.area.GetLineLength(end.Row) {
+		if end.Row+1 >= model.area.GetNumRows() {
+			return end, end, charClass_Whitespace, false
+		}
+		end = textarea.Position{Row: end.Row + 1, Col: 0}
+	}
+	start, newEnd, class := model.getWordRun(end, isBigWord)
+	return start, newEnd, class, true
+}
+
+// ====================================================================================================
+//
+//	Sentences & Paragraphs
+//
+// ====================================================================================================
+// "is" selects count sentences, and "as" selects them along with the whitespace after them (or before them, if
+// there's none after)
+// A sentence ends at a ".", "!" or "?" followed by whitespace or the end of a row (with any closing brackets and
+// quotes in between), and paragraph boundaries end sentences too. Whitespace between sentences counts as a sentence.
+func selectSentence(model *Model, cmd normalCommand, pos textarea.Position) (textRange, bool) {
+	buffer := model.getFlatBuffer()
+	spans := getSentenceSpans(buffer.text)
+	idx := buffer.getIndex(pos)
+
+	// Find the sentence the position is in, or the one after the whitespace it's in
+	spanIdx := sort.Search(len(spans), func(i int) bool { return spans[i][1] > idx })
+	isOnWhitespace := spanIdx >= len(spans) || idx < spans[spanIdx][0]
+
+	var start, end int
+	switch {
+	case isOnWhitespace && !isAroundTextObject(cmd.textObject):
+		// The whitespace is the first "sentence"
+		start = 0
+		if spanIdx > 0 {
+			start = spans[spanIdx-1][1]
+		}
+		end = len(buffer.text)
+		if spanIdx < len(spans) {
+			end = spans[spanIdx][0]
+		}
+		if lastSpanIdx := spanIdx + cmd.getCount() - 2; cmd.getCount() > 1 {
+			if lastSpanIdx >= len(spans) {
+				return textRange{}, false
+			}
+			end = spans[lastSpanIdx][1]
+		}
+	case isOnWhitespace:
+		// The whitespace gets selected along with the sentences after it
+		lastSpanIdx := spanIdx + cmd.getCount() - 1
+		if lastSpanIdx >= len(spans) {
+			return textRange{}, false
+		}
+		start = idx
+		for start > 0 && unicode.IsSpace(buffer.text[start-1]) {
+			start--
+		}
+		end = spans[lastSpanIdx][1]
+	default:
+		lastSpanIdx := spanIdx + cmd.getCount() - 1
+		if lastSpanIdx >= len(spans) {
+			return textRange{}, false
+		}
+		start, end = spans[spanIdx][0], spans[lastSpanIdx][1]
+		if isAroundTextObject(cmd.textObject) {
+			start, end = includeSurroundingWhitespace(buffer.text, start, end, true)
+		}
+	}
+
+	return textRange{start: buffer.getPosition(start), end: buffer.getPosition(end)}, true
+}
+
+// Gets the start and end (exclusive) of each sentence in the text, leaving out the whitespace between them
+func getSentenceSpans(text []rune) [][2]int {
+	var spans [][2]int
+	idx := 0
+	for idx < len(text) {
+		for idx < len(text) && unicode.IsSpace(text[idx]) {
+			idx++
+		}
+		if idx >= len(text) {
+			break
+		}
+
+		start := idx
+		end := len(text)
+		for idx < len(text) {
+			char := text[idx]
+			idx++
+			if char == '\n' && idx < len(text) && isBlankUpToNewline(text[idx:]) {
+				// An empty (or blank) line is a paragraph boundary
+				end = idx - 1
+				break
+			}
+			if char != '.' && char != '!' && char != '?' {
+				continue
+			}
+			for idx < len(text) && strings.ContainsRune(`)]"'`, text[idx]) {
+				idx++
+			}
+			if idx >= len(text) || unicode.IsSpace(text[idx]) {
+				end = idx
+				break
+			}
+		}
+		spans = append(spans, [2]int{start, end})
+	}
+	return spans
+}
+
+// Whether the text is only whitespace up to its first newline (or its end)
+func isBlankUpToNewline(text []rune) bool {
+	for _, char := range text {
+		if char == '\n' {
+			return true
+		}
+		if !unicode.IsSpace(char) {
+			return false
+		}
+	}
+	return true
+}
+
+// Extends the span over the whitespace after it, or if there isn't any (or isTrailingOnly is set and the whitespace
+// after it runs into a paragraph boundary), the whitespace before it on the same row
+func includeSurroundingWhitespace(text []rune, start int, end int, isTrailingOnly bool) (int, int) {
+	newEnd := end
+	for newEnd < len(text) && unicode.IsSpace(text[newEnd]) {
+		if text[newEnd] == '\n' && newEnd+1 < len(text) && isBlankUpToNewline(text[newEnd+1:]) {
+			break
+		}
+		newEnd++
+	}
+	if newEnd > end && newEnd < len(text) {
+		return start, newEnd
+	}
+
+	for start > 0 && (text[start-1] == ' ' || text[start-1] == '\t') {
+		start--
+	}
+	return start, end
+}
+
+// "ip" selects count paragraphs, where runs of blank lines count as paragraphs too, and "ap" selects count paragraphs
+// along with the blank lines after them (or before them, if there are none after)
+// Paragraphs are always linewise.
+func selectParagraph(model *Model, cmd normalCommand, pos textarea.Position) (textRange, bool) {
+	numRows := model.area.GetNumRows()
+	isBlankRow := func(row int) bool {
+		return strings.TrimSpace(string(model.area.GetLine(row))) == ""
+	}
+
+	// Gets the last row of the run of rows that are as blank as the given one
+	getRunEnd := func(row int) int {
+		isBlank := isBlankRow(row)
+		for row+1 < numRows && isBlankRow(row+1) == isBlank {
+			row++
+		}
+		return row
+	}
+
+	startRow := pos.Row
+	for startRow > 0 && isBlankRow(startRow-1) == isBlankRow(pos.Row) {
+		startRow--
+	}
+	endRow := getRunEnd(pos.Row)
+
+	numRuns := cmd.getCount()
+	if isAroundTextObject(cmd.textObject) {
+		numRuns *= 2
+	}
+	for i := 1; i < numRuns; i++ {
+		if endRow+1 >= numRows {
+			// "ap" at the end of the buffer takes the blank lines before the paragraph instead
+			if !isAroundTextObject(cmd.textObject) || i != numRuns-1 || isBlankRow(pos.Row) {
+				return textRange{}, false
+			}
+			for startRow > 0 && isBlankRow(startRow-1) {
+				startRow--
+			}
+			break
+		}
+		endRow = getRunEnd(endRow + 1)
+	}
+
+	return textRange{
+		start: textarea.Position{Row: startRow, Col: 0},
+		end:   textarea.Position{Row: endRow, Col: 0},
+		kind:  rangeKind_Linewise,
+	}, true
+}
+
+// ====================================================================================================
+//
+//	Quotes, Brackets & Tags
+//
+// ====================================================================================================
+// `i"` selects the text between the quotes around the cursor (or the next quotes on the row, if the cursor isn't
+// inside any), and `a"` selects the quotes too, along with the whitespace after them (or before them, if there's none
+// after)
+// Quotes don't span rows, and quotes escaped with a backslash are skipped. Like Vim, giving the inner version a count
+// of 2 includes the quotes without the whitespace.
+func selectQuoted(model *Model, cmd normalCommand, pos textarea.Position) (textRange, bool) {
+	quote := []rune(cmd.textObject)[1]
+	line := model.area.GetLine(pos.Row)
+
+	var quoteCols []int
+	for col := 0; col < len(line); col++ {
+		if line[col] == '\\' {
+			col++
+			continue
+		}
+		if line[col] == quote {
+			quoteCols = append(quoteCols, col)
+		}
+	}
+
+	// Quotes pair up from the start of the row
+	openCol, closeCol := -1, -1
+	for pairIdx := 0; pairIdx+1 < len(quoteCols); pairIdx += 2 {
+		if quoteCols[pairIdx+1] >= pos.Col {
+			openCol, closeCol = quoteCols[pairIdx], quoteCols[pairIdx+1]
+			break
+		}
+	}
+	if openCol < 0 {
+		return textRange{}, false
+	}
+
+	start, end := openCol+1, closeCol
+	switch {
+	case isAroundTextObject(cmd.textObject):
+		start, end = includeSurroundingWhitespace(line, openCol, closeCol+1, false)
+	case cmd.count > 1:
+		start, end = openCol, closeCol+1
+	}
+	return textRange{
+		start: textarea.Position{Row: pos.Row, Col: start},
+		end:   textarea.Position{Row: pos.Row, Col: end},
+	}, true
+}
+
+// "i(" selects the text inside the count'th pair of brackets around the cursor, and "a(" selects the brackets too
+// Like Vim, when the inner text starts with a line break and ends on a row of its own, the inner version selects
+// the rows in between.
+func selectBracketed(model *Model, cmd normalCommand, pos textarea.Position) (textRange, bool) {
+	brackets := bracketObjectPairs[[]rune(cmd.textObject)[1]]
+	buffer := model.getFlatBuffer()
+	idx := buffer.getIndex(pos)
+
+	openIdx := idx
+	if openIdx >= len(buffer.text) || buffer.text[openIdx] != brackets[0] {
+		// Starting on a closing bracket counts as being inside its pair
+		if openIdx < len(buffer.text) && buffer.text[openIdx] == brackets[1] {
+			openIdx--
+		}
+		openIdx = findUnmatchedBracket(buffer.text, openIdx, brackets, -1)
+	}
+	for level := 1; level < cmd.getCount() && openIdx >= 0; level++ {
+		openIdx = findUnmatchedBracket(buffer.text, openIdx-1, brackets, -1)
+	}
+	if openIdx < 0 {
+		return textRange{}, false
+	}
+	closeIdx := findUnmatchedBracket(buffer.text, openIdx+1, brackets, 1)
+	if closeIdx < 0 {
+		return textRange{}, false
+	}
+
+	if isAroundTextObject(cmd.textObject) {
+		return textRange{start: buffer.getPosition(openIdx), end: buffer.getPosition(closeIdx + 1)}, true
+	}
+	return model.getInnerBlockRange(buffer, openIdx+1, closeIdx), true
+}
+
+// "it" selects the text inside the count'th pair of matching tags (e.g. "<b>...</b>") around the cursor, and "at"
+// selects the tags too
+func selectTagged(model *Model, cmd normalCommand, pos textarea.Position) (textRange, bool) {
+	buffer := model.getFlatBuffer()
+	idx := buffer.getIndex(pos)
+
+	// Pair up the opening and closing tags, ignoring the ones that close themselves or don't match
+	type tagPair struct {
+		openStart, openEnd, closeStart, closeEnd int
+	}
+	var pairs []tagPair
+	var openTags [][]int
+	for _, match := range tagPattern.FindAllStringSubmatchIndex(string(buffer.text), -1) {
+		match = buffer.getRuneIndices(match)
+		isClosing, isSelfClosing := match[3] > match[2], match[7] > match[6]
+		name := string(buffer.text[match[4]:match[5]])
+		switch {
+		case isSelfClosing:
+		case !isClosing:
+			openTags = append(openTags, match)
+		default:
+			for openIdx := len(openTags) - 1; openIdx >= 0; openIdx-- {
+				openTag := openTags[openIdx]
+				if string(buffer.text[openTag[4]:openTag[5]]) == name {
+					pairs = append(pairs, tagPair{openTag[0], openTag[1], match[0], match[1]})
+					openTags = openTags[:openIdx]
+					break
+				}
+			}
+		}
+	}
+
+	// Pairs get added innermost first, so the count'th one around the position is the one we want
+	level := 0
+	for _, pair := range pairs {
+		if pair.openStart > idx || idx >= pair.closeEnd {
+			continue
+		}
+		level++
+		if level < cmd.getCount() {
+			continue
+		}
+
+		if isAroundTextObject(cmd.textObject) {
+			return textRange{start: buffer.getPosition(pair.openStart), end: buffer.getPosition(pair.closeEnd)}, true
+		}
+		return model.getInnerBlockRange(buffer, pair.openEnd, pair.closeStart), true
+	}
+	return textRange{}, false
+}
+
+// Searches for the bracket that's unmatched going in the direction (1 for forward, -1 for backward) from the index,
+// returning -1 if there isn't one
+func findUnmatchedBracket(text []rune, idx int, brackets [2]rune, direction int) int {
+	target, nested := brackets[1], brackets[0]
+	if direction < 0 {
+		target, nested = brackets[0], brackets[1]
+	}
+
+	depth := 0
+	for ; idx >= 0 && idx < len(text); idx += direction {
+		switch text[idx] {
+		case nested:
+			depth++
+		case target:
+			if depth == 0 {
+				return idx
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// Gets the range of the text inside a block, which is the rows in between when the block's opening is followed by a
+// line break and its closing is on a row of its own
+func (model *Model) getInnerBlockRange(buffer flatBuffer, start int, end int) textRange {
+	startPos, endPos := buffer.getPosition(start), buffer.getPosition(end)
+	startsWithLineBreak := start < len(buffer.text) && buffer.text[start] == '\n'
+	endsOnOwnRow := strings.TrimSpace(string(model.area.GetLine(endPos.Row)[:endPos.Col])) == ""
+	if startsWithLineBreak && endsOnOwnRow && endPos.Row-startPos.Row >= 2 {
+		return textRange{
+			start: textarea.Position{Row: startPos.Row + 1, Col: 0},
+			end:   textarea.Position{Row: endPos.Row - 1, Col: 0},
+			kind:  rangeKind_Linewise,
+		}
+	}
+	return textRange{start: startPos, end: endPos}
+}
+
+// ====================================================================================================
+//
+//	Flat Buffer
+//
+// ====================================================================================================
+// The buffer's rows joined by newlines, for the text objects that span rows
+type flatBuffer struct {
+	text []rune
+
+	// The index in the text that each row starts at
+	rowStarts []int
+}
+
+func (model *Model) getFlatBuffer() flatBuffer {
+	buffer := flatBuffer{}
+	for row := 0; row < model.area.GetNumRows(); row++ {
+		if row > 0 {
+			buffer.text = append(buffer.text, '\n')
+		}
+		buffer.rowStarts = append(buffer.rowStarts, len(buffer.text))
+		buffer.text = append(buffer.text, model.area.GetLine(row)...)
+	}
+	return buffer
+}
+
+func (buffer flatBuffer) getIndex(pos textarea.Position) int {
+	return min(buffer.rowStarts[pos.Row]+pos.Col, len(buffer.text))
+}
+
+func (buffer flatBuffer) getPosition(idx int) textarea.Position {
+	row := sort.Search(len(buffer.rowStarts), func(i int) bool { return buffer.rowStarts[i] > idx }) - 1
+	return textarea.Position{Row: row, Col: idx - buffer.rowStarts[row]}
+}
+
+// Converts the byte indices of a regexp match on the text (as a string) into rune indices, leaving -1s alone
+func (buffer flatBuffer) getRuneIndices(byteIndices []int) []int {
+	result := make([]int, len(byteIndices))
+	byteIdx, runeIdx := 0, 0
+	for idx, target := range byteIndices {
+		if target < 0 {
+			result[idx] = -1
+			continue
+		}
+		if target < byteIdx {
+			byteIdx, runeIdx = 0, 0
+		}
+		for byteIdx < target {
+			byteIdx += len(string(buffer.text[runeIdx]))
+			runeIdx++
+		}
+		result[idx] = runeIdx
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+package vim
+
+import "testing"
+
+func TestWordTextObjects(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"foo bar baz", 0, 5, "diw", "foo  baz", 0, 4},
+		{"foo bar baz", 0, 5, "daw", "foo baz", 0, 4},
+		{"foo bar", 0, 5, "daw", "foo", 0, 2},
+		{"foo bar baz", 0, 5, "ciwX<Esc>", "foo X baz", 0, 4},
+		{"foo  bar", 0, 3, "diw", "foobar", 0, 3},
+		{"foo  bar", 0, 3, "daw", "foo", 0, 2},
+		{"a.b c", 0, 0, "diw", ".b c", 0, 0},
+		{"a.b c", 0, 0, "diW", " c", 0, 0},
+		{"one two three four", 0, 0, "d2aw", "three four", 0, 0},
+		{"one two three", 0, 0, "d3iw", " three", 0, 0},
+		{"a b", 0, 0, "yiwP", "aa b", 0, 0},
+		{"", 0, 0, "diw", "", 0, 0},
+	})
+}
+
+func TestBracketTextObjects(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a (b c) d", 0, 4, "di(", "a () d", 0, 3},
+		{"a (b c) d", 0, 4, "da(", "a  d", 0, 2},
+		{"a (b c) d", 0, 4, "dab", "a  d", 0, 2},
+		{"a (b (c) d) e", 0, 6, "di)", "a (b () d) e", 0, 6},
+		{"a (b (c) d) e", 0, 6, "d2i(", "a () e", 0, 3},
+		{"{a [b] c}", 0, 4, "di[", "{a [] c}", 0, 4},
+		{"{a [b] c}", 0, 4, "diB", "{}", 0, 1},
+		{"x <a> y", 0, 3, "di<", "x <> y", 0, 3},
+		{"x", 0, 0, "di(", "x", 0, 0},
+
+		// Brackets on lines of their own keep their lines
+		{"f(\n  x\n  y\n)", 1, 2, "di(", "f(\n)", 1, 0},
+		{"f {\n  x\n  y\n}", 1, 2, "ci{z<Esc>", "f {\nz\n}", 1, 0},
+		{"f(a,\n b)", 1, 1, "di(", "f()", 0, 2},
+	})
+}
+
+func TestQuoteTextObjects(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{`say "hi there" ok`, 0, 6, `di"`, `say "" ok`, 0, 5},
+		{`say "hi there" ok`, 0, 6, `da"`, `say ok`, 0, 4},
+		{`say "hi there"`, 0, 6, `da"`, `say`, 0, 2},
+		{`x 'a\'b' y`, 0, 4, "di'", `x '' y`, 0, 3},
+
+		// Before the quotes, the first quoted string on the line gets used
+		{`x "a" y`, 0, 0, `di"`, `x "" y`, 0, 3},
+	})
+}
+
+func TestTagTextObjects(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"<a><b>x</b> y</a>", 0, 6, "dit", "<a><b></b> y</a>", 0, 6},
+		{"<a><b>x</b> y</a>", 0, 6, "dat", "<a> y</a>", 0, 3},
+		{"<a><b>x</b> y</a>", 0, 6, "d2it", "<a></a>", 0, 3},
+		{`<div class="x">t<br/></div>`, 0, 16, "dit", `<div class="x"></div>`, 0, 15},
+	})
+}
+
+func TestSentenceAndParagraphTextObjects(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"One two. Three four. Five.", 0, 10, "dis", "One two.  Five.", 0, 9},
+		{"One two. Three four. Five.", 0, 10, "das", "One two. Five.", 0, 9},
+		{"One two. Three four.", 0, 10, "das", "One two.", 0, 7},
+		{"a\nb\n\nc\nd", 0, 0, "dip", "\nc\nd", 0, 0},
+		{"a\nb\n\nc\nd", 0, 0, "dap", "c\nd", 0, 0},
+		{"a\nb\n\nc\nd", 3, 0, "dap", "a\nb", 1, 0},
+		{"a\nb\n\nc\nd", 0, 0, "yipP", "a\nb\na\nb\n\nc\nd", 0, 0},
+	})
+}
+
+func TestVisualTextObjects(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"foo bar baz", 0, 5, "viwd", "foo  baz", 0, 4},
+		{"foo bar baz", 0, 5, "vawd", "foo baz", 0, 4},
+		{"foo bar baz", 0, 5, "Viwd", "foo  baz", 0, 4},
+		{"a\nb\n\nc", 0, 0, "vipd", "\nc", 0, 0},
+		{`a "b" c`, 0, 3, `vi"y$p`, `a "b" cb`, 0, 7},
+
+		// Repeating the text object extends the selection
+		{"foo bar baz", 0, 5, "viwiwiwd", "foo ", 0, 3},
+		{"foo bar baz", 0, 9, "vbiwd", "foo barz", 0, 7},
+		{"a (b (c) d) e", 0, 6, "vi(i(d", "a () e", 0, 3},
+		{"a (b (c) d) e", 0, 6, "va(a(d", "a  e", 0, 2},
+	})
+}
+
+func TestRepeatedTextObjects(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"foo bar baz", 0, 5, "diw.", "foobaz", 0, 3},
+		{"(a) (b)", 0, 1, "di(w.", "() ()", 0, 4},
+	})
+}
@@ -0,0 +1,550 @@
+package vim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// A change to the buffer, as the text that got replaced and the text that replaced it
+type textDelta struct {
+	// Where the change starts, which is the same before and after it
+	start textarea.Position
+
+	oldText string
+	newText string
+}
+
+// A state of the buffer in the undo tree, which (apart from the original state) is made by a change to an earlier state
+// Undoing goes back to the state the change was made to, and making a new change after undoing starts a new branch
+// rather than throwing away what was undone.
+type undoState struct {
+	// The state that the change was made to, or -1 for the original state
+	parentSeq int
+
+	// The states made by changes to this one, oldest first
+	childSeqs []int
+
+	// The child that redoing goes to, which is the one most recently made or undone, or -1 if there are no children
+	redoChildSeq int
+
+	// The change from the parent state to this one
+	delta textDelta
+
+	// Where the cursor was before the change was made, which undoing it goes back to
+	cursorBefore textarea.Position
+
+	// Where the cursor was once the change was made, which redoing it goes back to
+	cursorAfter textarea.Position
+
+	// When the change was checkpointed (or the model was created, for the original state)
+	time time.Time
+}
+
+// UndoState describes a state of the buffer in the undo tree, for host applications that show their own history
+type UndoState struct {
+	// The number of the state, counting up from 0 (the original state) in the order the states were made
+	Seq int
+
+	// The state that this state's change was made to, or -1 for the original state
+	ParentSeq int
+
+	// The states made by changes to this one, oldest first
+	ChildSeqs []int
+
+	// The number of changes between the original state and this one
+	NumChanges int
+
+	// When the change that made the state was made (or the model was created, for the original state)
+	Time time.Time
+}
+
+// GetUndoStates gets every state in the undo tree, ordered by Seq (so the original state comes first)
+func (model Model) GetUndoStates() []UndoState {
+	result := make([]UndoState, 0, len(model.undoStates))
+	for seq, state := range model.undoStates {
+		result = append(result, UndoState{
+			Seq:        seq,
+			ParentSeq:  state.parentSeq,
+			ChildSeqs:  append([]int{}, state.childSeqs...),
+			NumChanges: model.getUndoStateDepth(seq),
+			Time:       state.time,
+		})
+	}
+	return result
+}
+
+// GetCurrentUndoState gets the Seq of the state in the undo tree that the buffer is in
+func (model Model) GetCurrentUndoState() int {
+	return model.currentUndoSeq
+}
+
+// GoToUndoState undoes and redoes changes until the buffer is in the state with the given Seq, which can be on a
+// different branch of the undo tree
+func (model *Model) GoToUndoState(seq int) error {
+	if seq < 0 || seq >= len(model.undoStates) {
+		return fmt.Errorf("E830: Undo number %d not found", seq)
+	}
+	model.goToUndoState(seq)
+	return nil
+}
+
+// Forces a checkpoint in the Vim buffer's history, for undo
+func (model *Model) CheckpointHistory() {
+	if model.isPuttingOffCheckpoints() {
+		return
+	}
+	change := model.area.GetChange()
+	if change == nil {
+		return
+	}
+	model.area.SetChange(nil)
+
+	// The rows might have been changed back (e.g. by typing something and then deleting it)
+	delta := model.getChangeDelta(change)
+	if delta.oldText == delta.newText {
+		return
+	}
+
+	start, end := model.getChangedRegion(delta)
+	model.markChangedText(start, end, true)
+
+	cursorBefore := delta.start
+	if model.cursorBeforeChange != nil {
+		cursorBefore = *model.cursorBeforeChange
+	}
+
+	seq := len(model.undoStates)
+	model.undoStates = append(model.undoStates, undoState{
+		parentSeq:    model.currentUndoSeq,
+		childSeqs:    nil,
+		redoChildSeq: -1,
+		delta:        delta,
+		cursorBefore: cursorBefore,
+		cursorAfter:  model.area.GetCursorPosition(),
+		time:         time.Now(),
+	})
+	parent := &model.undoStates[model.currentUndoSeq]
+	parent.childSeqs = append(parent.childSeqs, seq)
+	parent.redoChildSeq = seq
+
+	model.currentUndoSeq = seq
+	model.cursorBeforeChange = nil
+}
+
+// BeginEdit starts grouping programmatic edits (e.g. SetValue and ReplaceLine) into a single undo step, which gets
+// made by CommitEdit
+// Edits can't be nested, so beginning one while another is in progress is an error.
+func (model *Model) BeginEdit() error {
+	if model.isInEdit {
+		return fmt.Errorf("an edit is already in progress")
+	}
+	model.CheckpointHistory()
+	model.rememberCursorBeforeChange()
+	model.isInEdit = true
+	return nil
+}
+
+// CommitEdit ends the edit started by BeginEdit, making everything changed since then into a single undo step
+func (model *Model) CommitEdit() error {
+	if !model.isInEdit {
+		return fmt.Errorf("no edit is in progress")
+	}
+	model.isInEdit = false
+	model.CheckpointHistory()
+	return nil
+}
+
+// RollbackEdit ends the edit started by BeginEdit, putting the buffer and the cursor back the way they were when it
+// began
+func (model *Model) RollbackEdit() error {
+	if !model.isInEdit {
+		return fmt.Errorf("no edit is in progress")
+	}
+	model.isInEdit = false
+
+	if change := model.area.GetChange(); change != nil {
+		delta := model.getChangeDelta(change)
+		model.applyTextDelta(delta.start, delta.newText, delta.oldText)
+		model.area.SetChange(nil)
+	}
+	if model.cursorBeforeChange != nil {
+		model.area.SetCursorPosition(*model.cursorBeforeChange)
+	}
+	model.cursorBeforeChange = nil
+	return nil
+}
+
+// Whether checkpoints are being put off until a larger change has finished, so that it gets undone in one step
+// Ex commands get checkpointed once they've finished, and programmatic edits once they've been committed.
+func (model *Model) isPuttingOffCheckpoints() bool {
+	return model.exCommandDepth > 0 || model.isInEdit
+}
+
+// Makes a programmatic edit (e.g. from SetValue), which becomes an undo step of its own unless it's part of a larger
+// change
+func (model *Model) makeProgrammaticEdit(edit func()) {
+	model.CheckpointHistory()
+	model.rememberCursorBeforeChange()
+	edit()
+	model.CheckpointHistory()
+}
+
+// Whether the model is still as empty as it was when it was created, with nothing to undo
+func (model *Model) isNewAndEmpty() bool {
+	return len(model.undoStates) == 1 && !model.isInEdit && model.area.GetChange() == nil && model.area.GetNumRows() == 1 && model.area.GetLineLength(0) == 0
+}
+
+// Handles the insert mode keys that split what gets typed into separate undo steps, returning whether the key was used
+// up
+// Like Vim, "ctrl+g u" starts a new undo step, and so does moving the cursor (unless "ctrl+g U" came just before).
+func (model *Model) handleInsertModeUndoKey(msg tea.KeyMsg) bool {
+	if model.isAwaitingInsertModeUndoKey {
+		model.isAwaitingInsertModeUndoKey = false
+		switch msg.String() {
+		case "u":
+			model.breakInsertModeUndoStep()
+		case "U":
+			model.shouldKeepUndoStepOnNextMove = true
+		}
+		return true
+	}
+	if msg.String() == "ctrl+g" {
+		model.isAwaitingInsertModeUndoKey = true
+		return true
+	}
+
+	keyMap := model.area.KeyMap
+	if key.Matches(msg, keyMap.CharacterForward, keyMap.CharacterBackward, keyMap.WordForward, keyMap.WordBackward, keyMap.LineNext, keyMap.LinePrevious, keyMap.LineStart, keyMap.LineEnd, keyMap.InputBegin, keyMap.InputEnd) {
+		if model.shouldKeepUndoStepOnNextMove {
+			model.shouldKeepUndoStepOnNextMove = false
+		} else {
+			model.breakInsertModeUndoStep()
+		}
+	}
+	return false
+}
+
+// Makes what's been typed so far into an undo step of its own
+// Undoing whatever gets typed next puts the cursor where it was typed, which is where its change starts.
+func (model *Model) breakInsertModeUndoStep() {
+	model.CheckpointHistory()
+	model.cursorBeforeChange = nil
+}
+
+// Remembers where the cursor is as a command starts, so that undoing whatever change the command makes can put the
+// cursor back
+// Commands that move the cursor before entering insert mode (like "A") remember it again once it's moved, since (like
+// in Vim) undoing the typed text puts the cursor where the typing started.
+func (model *Model) rememberCursorBeforeChange() {
+	// The change that's already in progress started before this command did
+	if model.isPuttingOffCheckpoints() {
+		return
+	}
+	pos := model.area.GetCursorPosition()
+	model.cursorBeforeChange = &pos
+}
+
+// Undoes the given number of changes (or as many as there are), going back up the undo tree
+func (model *Model) undoBy(count int) {
+	// Anything changed since the last checkpoint has to become a state of its own, or the undo tree won't line up
+	// with the buffer
+	model.CheckpointHistory()
+
+	targetSeq := model.currentUndoSeq
+	for i := 0; i < count && targetSeq > 0; i++ {
+		targetSeq = model.undoStates[targetSeq].parentSeq
+	}
+	model.goToUndoState(targetSeq)
+}
+
+// Redoes the given number of changes (or as many as there are), going back down the branch of the undo tree that was
+// most recently undone
+func (model *Model) redoBy(count int) {
+	model.CheckpointHistory()
+
+	targetSeq := model.currentUndoSeq
+	for i := 0; i < count && model.undoStates[targetSeq].redoChildSeq != -1; i++ {
+		targetSeq = model.undoStates[targetSeq].redoChildSeq
+	}
+	model.goToUndoState(targetSeq)
+}
+
+// Moves through the undo tree chronologically by the given number of states (backwards, if it's negative), regardless
+// of which branches the states are on
+func (model *Model) moveThroughUndoStatesBy(numStates int) {
+	model.CheckpointHistory()
+	model.goToUndoState(clamp(model.currentUndoSeq+numStates, 0, len(model.undoStates)-1))
+}
+
+// Moves through the undo tree to the last state made before the given time (or the original state, if there isn't one)
+func (model *Model) goToUndoStateAtTime(targetTime time.Time) {
+	model.CheckpointHistory()
+
+	targetSeq := 0
+	for seq, state := range model.undoStates {
+		if !state.time.After(targetTime) {
+			targetSeq = seq
+		}
+	}
+	model.goToUndoState(targetSeq)
+}
+
+// Undoes changes back to where the current state's branch meets the target state's, and then redoes changes along the
+// target state's branch, leaving the cursor where the last change undone or redone puts it
+func (model *Model) goToUndoState(targetSeq int) {
+	if targetSeq == model.currentUndoSeq {
+		return
+	}
+
+	isCurrentStateAncestor := map[int]bool{}
+	for seq := model.currentUndoSeq; seq != -1; seq = model.undoStates[seq].parentSeq {
+		isCurrentStateAncestor[seq] = true
+	}
+	var seqsToRedo []int
+	commonAncestorSeq := targetSeq
+	for !isCurrentStateAncestor[commonAncestorSeq] {
+		seqsToRedo = append(seqsToRedo, commonAncestorSeq)
+		commonAncestorSeq = model.undoStates[commonAncestorSeq].parentSeq
+	}
+
+	var cursor textarea.Position
+	for seq := model.currentUndoSeq; seq != commonAncestorSeq; seq = model.undoStates[seq].parentSeq {
+		state := model.undoStates[seq]
+		model.applyTextDelta(state.delta.start, state.delta.newText, state.delta.oldText)
+		model.undoStates[state.parentSeq].redoChildSeq = seq
+		cursor = state.cursorBefore
+	}
+	for idx := len(seqsToRedo) - 1; idx >= 0; idx-- {
+		state := model.undoStates[seqsToRedo[idx]]
+		model.applyTextDelta(state.delta.start, state.delta.oldText, state.delta.newText)
+		model.undoStates[state.parentSeq].redoChildSeq = seqsToRedo[idx]
+		cursor = state.cursorAfter
+	}
+
+	model.currentUndoSeq = targetSeq
+	model.area.SetChange(nil)
+	model.area.SetCursorPosition(cursor)
+}
+
+// Gets the number of changes between the original state and the state with the given Seq
+func (model Model) getUndoStateDepth(seq int) int {
+	depth := 0
+	for model.undoStates[seq].parentSeq != -1 {
+		seq = model.undoStates[seq].parentSeq
+		depth++
+	}
+	return depth
+}
+
+// Replaces the text at the position (which must match the text currently there) with the new text
+func (model *Model) applyTextDelta(start textarea.Position, currentText string, newText string) {
+	model.area.ReplaceRange(start, getTextEnd(start, currentText), newText)
+}
+
+// Gets the change to the buffer that the textarea has recorded since the last checkpoint, working it out from only the
+// rows that changed
+func (model *Model) getChangeDelta(change *textarea.Change) textDelta {
+	// An unchanged row on either side of the changed rows lets getTextDelta tell whether whole rows were inserted or
+	// deleted
+	firstRow, oldRows := change.StartRow, change.OldRows
+	endRow := change.StartRow + change.NumNewRows
+	if firstRow > 0 {
+		firstRow--
+		oldRows = append([]string{string(model.area.GetLine(firstRow))}, oldRows...)
+	}
+	if endRow < model.area.GetNumRows() {
+		oldRows = append(oldRows[:len(oldRows):len(oldRows)], string(model.area.GetLine(endRow)))
+		endRow++
+	}
+
+	newRows := model.area.GetLines(firstRow, endRow-1)
+	delta := getTextDelta(strings.Join(oldRows, "\n"), strings.Join(newRows, "\n"))
+	delta.start.Row += firstRow
+	return delta
+}
+
+// Gets the contents of the buffer as of the last checkpoint, without any of the changes made since
+func (model *Model) getCheckpointedValue() string {
+	change := model.area.GetChange()
+	rows := model.area.GetLines(0, model.area.GetNumRows()-1)
+	if change == nil {
+		return strings.Join(rows, "\n")
+	}
+
+	checkpointedRows := make([]string, 0, len(rows)-change.NumNewRows+len(change.OldRows))
+	checkpointedRows = append(checkpointedRows, rows[:change.StartRow]...)
+	checkpointedRows = append(checkpointedRows, change.OldRows...)
+	checkpointedRows = append(checkpointedRows, rows[change.StartRow+change.NumNewRows:]...)
+	return strings.Join(checkpointedRows, "\n")
+}
+
+// Gets the smallest change that turns the old value of the buffer into the new one
+// Rows that were inserted or deleted whole are kept whole in the change, so that undoing it inserts or deletes rows
+// rather than splicing text across them.
+func getTextDelta(oldValue string, newValue string) textDelta {
+	oldRows, newRows := strings.Split(oldValue, "\n"), strings.Split(newValue, "\n")
+
+	numPrefixRows := 0
+	for numPrefixRows < len(oldRows) && numPrefixRows < len(newRows) && oldRows[numPrefixRows] == newRows[numPrefixRows] {
+		numPrefixRows++
+	}
+	numSuffixRows := 0
+	for numPrefixRows+numSuffixRows < len(oldRows) && numPrefixRows+numSuffixRows < len(newRows) && oldRows[len(oldRows)-1-numSuffixRows] == newRows[len(newRows)-1-numSuffixRows] {
+		numSuffixRows++
+	}
+	changedOldRows := oldRows[numPrefixRows : len(oldRows)-numSuffixRows]
+	changedNewRows := newRows[numPrefixRows : len(newRows)-numSuffixRows]
+
+	// Only whole rows were inserted or deleted, which takes the newline before them when they're at the end of the
+	// buffer (since there's no row after them to take the newline after them)
+	if len(changedOldRows) == 0 || len(changedNewRows) == 0 {
+		if numSuffixRows > 0 {
+			return textDelta{
+				start:   textarea.Position{Row: numPrefixRows, Col: 0},
+				oldText: joinRowsWithTrailingNewline(changedOldRows),
+				newText: joinRowsWithTrailingNewline(changedNewRows),
+			}
+		}
+		lastPrefixRow := numPrefixRows - 1
+		return textDelta{
+			start:   textarea.Position{Row: lastPrefixRow, Col: len([]rune(oldRows[lastPrefixRow]))},
+			oldText: joinRowsWithLeadingNewline(changedOldRows),
+			newText: joinRowsWithLeadingNewline(changedNewRows),
+		}
+	}
+
+	oldText, newText := []rune(strings.Join(changedOldRows, "\n")), []rune(strings.Join(changedNewRows, "\n"))
+	numPrefixRunes := 0
+	for numPrefixRunes < len(oldText) && numPrefixRunes < len(newText) && oldText[numPrefixRunes] == newText[numPrefixRunes] {
+		numPrefixRunes++
+	}
+	numSuffixRunes := 0
+	for numPrefixRunes+numSuffixRunes < len(oldText) && numPrefixRunes+numSuffixRunes < len(newText) && oldText[len(oldText)-1-numSuffixRunes] == newText[len(newText)-1-numSuffixRunes] {
+		numSuffixRunes++
+	}
+	return textDelta{
+		start:   textarea.Position{Row: numPrefixRows, Col: numPrefixRunes},
+		oldText: string(oldText[numPrefixRunes : len(oldText)-numSuffixRunes]),
+		newText: string(newText[numPrefixRunes : len(newText)-numSuffixRunes]),
+	}
+}
+
+func joinRowsWithTrailingNewline(rows []string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	return strings.Join(rows, "\n") + "\n"
+}
+
+func joinRowsWithLeadingNewline(rows []string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	return "\n" + strings.Join(rows, "\n")
+}
+
+// Gets the position just past the text, if it were to start at the given position
+func getTextEnd(start textarea.Position, text string) textarea.Position {
+	lastNewlineIdx := strings.LastIndex(text, "\n")
+	if lastNewlineIdx == -1 {
+		return textarea.Position{Row: start.Row, Col: start.Col + len([]rune(text))}
+	}
+	return textarea.Position{
+		Row: start.Row + strings.Count(text, "\n"),
+		Col: len([]rune(text[lastNewlineIdx+1:])),
+	}
+}
+
+// ====================================================================================================
+//
+//	Action Implementations
+//
+// ====================================================================================================
+func undo(model *Model, cmd normalCommand) {
+	model.undoBy(cmd.getCount())
+}
+
+func redo(model *Model, cmd normalCommand) {
+	model.redoBy(cmd.getCount())
+}
+
+// "g-" and "g+" go to older and newer states of the buffer, in the order they were made
+func moveThroughUndoStatesAction(model *Model, cmd normalCommand) {
+	if cmd.action == "g-" {
+		model.moveThroughUndoStatesBy(-cmd.getCount())
+		return
+	}
+	model.moveThroughUndoStatesBy(cmd.getCount())
+}
+
+// ====================================================================================================
+//
+//	Ex Commands
+//
+// ====================================================================================================
+// ":earlier" and ":later" go to older and newer states of the buffer, either by a number of states (like "g-" and
+// "g+") or by an amount of time (e.g. ":earlier 5m" goes to the buffer as it was five minutes before the current state)
+func runEarlierOrLater(model *Model, invocation CommandInvocation) (tea.Cmd, error) {
+	direction := 1
+	if invocation.Name == "earlier" {
+		direction = -1
+	}
+
+	args := strings.TrimSpace(invocation.Args)
+	if args == "" {
+		model.moveThroughUndoStatesBy(direction)
+		return nil, nil
+	}
+
+	unitDurations := map[byte]time.Duration{'s': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour}
+	numberText := args
+	unitDuration, hasUnit := unitDurations[args[len(args)-1]]
+	if hasUnit {
+		numberText = args[:len(args)-1]
+	}
+	number, err := strconv.Atoi(numberText)
+	if err != nil || number < 0 {
+		return nil, fmt.Errorf("E475: Invalid argument: %s", args)
+	}
+
+	if !hasUnit {
+		model.moveThroughUndoStatesBy(direction * number)
+		return nil, nil
+	}
+	currentTime := model.undoStates[model.currentUndoSeq].time
+	model.goToUndoStateAtTime(currentTime.Add(time.Duration(direction*number) * unitDuration))
+	return nil, nil
+}
+
+// ":undolist" shows the states at the ends of the undo tree's branches, with how many changes and when they were made
+func runUndoList(model *Model, invocation CommandInvocation) (tea.Cmd, error) {
+	var entries []string
+	for _, state := range model.GetUndoStates() {
+		if state.Seq == 0 || len(state.ChildSeqs) > 0 {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("%d (%d changes, %s)", state.Seq, state.NumChanges, formatUndoTime(state.Time)))
+	}
+	if len(entries) == 0 {
+		model.statusMessage = "Nothing to undo"
+		return nil, nil
+	}
+	model.statusMessage = strings.Join(entries, "  ")
+	return nil, nil
+}
+
+// Formats the time the way Vim's ":undolist" does, which is the number of seconds ago for recent times
+func formatUndoTime(t time.Time) string {
+	secondsAgo := int(time.Since(t).Seconds())
+	if secondsAgo < 100 {
+		return fmt.Sprintf("%d seconds ago", secondsAgo)
+	}
+	return t.Format("15:04:05")
+}
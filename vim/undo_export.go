@@ -0,0 +1,338 @@
+package vim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// The version of the exported undo history format, which goes up whenever the format changes in a way that older
+// versions can't read
+const undoHistoryFormatVersion = 1
+
+// The names that register kinds are exported under
+var registerKindNames = map[rangeKind]string{
+	rangeKind_Characterwise: "characterwise",
+	rangeKind_Linewise:      "linewise",
+	rangeKind_Blockwise:     "blockwise",
+}
+
+// The exported undo history, which is JSON of the form:
+//
+//	{
+//	  "version": 1,
+//	  "contentHash": "<hex SHA-256 of the buffer's contents>",
+//	  "currentSeq": 3,
+//	  "states": [
+//	    {
+//	      "parentSeq": -1,
+//	      "redoChildSeq": 1,
+//	      "time": "2023-04-01T12:00:00Z",
+//	      "start": {"row": 0, "col": 0},
+//	      "oldText": "",
+//	      "newText": "",
+//	      "cursorBefore": {"row": 0, "col": 0},
+//	      "cursorAfter": {"row": 0, "col": 0}
+//	    },
+//	    ...
+//	  ],
+//	  "registers": {"a": {"text": "foo\n", "kind": "linewise"}, ...}
+//	}
+//
+// The states are indexed by their Seq, with the original state first. Each state (besides the original one) has the
+// change from its parent state as the text at "start" that "oldText" got replaced with ("newText"), in rows and columns
+// of runes. The "registers" are only there when they were exported.
+type exportedUndoHistory struct {
+	Version     int                         `json:"version"`
+	ContentHash string                      `json:"contentHash"`
+	CurrentSeq  int                         `json:"currentSeq"`
+	States      []exportedUndoState         `json:"states"`
+	Registers   map[string]exportedRegister `json:"registers,omitempty"`
+}
+
+type exportedUndoState struct {
+	ParentSeq    int              `json:"parentSeq"`
+	RedoChildSeq int              `json:"redoChildSeq"`
+	Time         time.Time        `json:"time"`
+	Start        exportedPosition `json:"start"`
+	OldText      string           `json:"oldText"`
+	NewText      string           `json:"newText"`
+	CursorBefore exportedPosition `json:"cursorBefore"`
+	CursorAfter  exportedPosition `json:"cursorAfter"`
+}
+
+type exportedPosition struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+type exportedRegister struct {
+	Text string `json:"text"`
+	Kind string `json:"kind"`
+}
+
+// ExportUndoHistory serializes the undo tree (along with the cursor positions that undoing and redoing go to) so that
+// it can be saved alongside the buffer's contents and brought back with ImportUndoHistory
+// If includeRegisters is set, the contents of the writable registers (e.g. "a" and "1", but not the clipboard) are
+// saved too. Any changes since the last checkpoint get checkpointed first, so that the history matches the buffer.
+func (model *Model) ExportUndoHistory(includeRegisters bool) ([]byte, error) {
+	model.CheckpointHistory()
+
+	exported := exportedUndoHistory{
+		Version:     undoHistoryFormatVersion,
+		ContentHash: hashBufferContents(model.getCheckpointedValue()),
+		CurrentSeq:  model.currentUndoSeq,
+		States:      make([]exportedUndoState, 0, len(model.undoStates)),
+		Registers:   nil,
+	}
+	for _, state := range model.undoStates {
+		exported.States = append(exported.States, exportedUndoState{
+			ParentSeq:    state.parentSeq,
+			RedoChildSeq: state.redoChildSeq,
+			Time:         state.time,
+			Start:        exportPosition(state.delta.start),
+			OldText:      state.delta.oldText,
+			NewText:      state.delta.newText,
+			CursorBefore: exportPosition(state.cursorBefore),
+			CursorAfter:  exportPosition(state.cursorAfter),
+		})
+	}
+
+	if includeRegisters {
+		exported.Registers = map[string]exportedRegister{}
+		for name, reg := range model.registers {
+			exported.Registers[string(name)] = exportedRegister{Text: reg.text, Kind: registerKindNames[reg.kind]}
+		}
+	}
+
+	return json.MarshalIndent(exported, "", "  ")
+}
+
+// ImportUndoHistory replaces the undo tree with one exported by ExportUndoHistory, along with the registers if they
+// were exported
+// The buffer must already hold the contents it had when the history was exported (e.g. from SetValue), and the
+// history is rejected if it doesn't.
+func (model *Model) ImportUndoHistory(data []byte) error {
+	var imported exportedUndoHistory
+	if err := json.Unmarshal(data, &imported); err != nil {
+		return fmt.Errorf("E824: Incompatible undo file: %w", err)
+	}
+	if imported.Version != undoHistoryFormatVersion {
+		return fmt.Errorf("E824: Incompatible undo file: unsupported version %d", imported.Version)
+	}
+
+	value := model.area.GetValue()
+	if imported.ContentHash != hashBufferContents(value) {
+		return fmt.Errorf("E822: Buffer contents changed, cannot use undo info")
+	}
+
+	states, err := importUndoStates(imported.States)
+	if err != nil {
+		return err
+	}
+	if imported.CurrentSeq < 0 || imported.CurrentSeq >= len(states) {
+		return fmt.Errorf("E824: Incompatible undo file: current state %d not found", imported.CurrentSeq)
+	}
+	if err := checkUndoStatesApply(states, imported.CurrentSeq, value); err != nil {
+		return err
+	}
+
+	registers := map[rune]register{}
+	for nameText, exportedReg := range imported.Registers {
+		nameRunes := []rune(nameText)
+		if len(nameRunes) != 1 || !isStoredRegisterName(nameRunes[0]) {
+			return fmt.Errorf("E824: Incompatible undo file: invalid register %q", nameText)
+		}
+		kind, found := getRegisterKind(exportedReg.Kind)
+		if !found {
+			return fmt.Errorf("E824: Incompatible undo file: invalid register kind %q", exportedReg.Kind)
+		}
+		registers[nameRunes[0]] = register{text: exportedReg.Text, kind: kind}
+	}
+
+	model.undoStates = states
+	model.currentUndoSeq = imported.CurrentSeq
+	model.area.SetChange(nil)
+	model.cursorBeforeChange = nil
+	if imported.Registers != nil {
+		model.registers = registers
+	}
+	return nil
+}
+
+// Rebuilds the undo tree's states, checking that they form a tree rooted at the original state
+func importUndoStates(exportedStates []exportedUndoState) ([]undoState, error) {
+	if len(exportedStates) == 0 || exportedStates[0].ParentSeq != -1 {
+		return nil, fmt.Errorf("E824: Incompatible undo file: missing original state")
+	}
+
+	states := make([]undoState, 0, len(exportedStates))
+	for seq, exportedState := range exportedStates {
+		// Parents always come before their children, since the states are in the order they were made
+		if seq > 0 && (exportedState.ParentSeq < 0 || exportedState.ParentSeq >= seq) {
+			return nil, fmt.Errorf("E824: Incompatible undo file: state %d has invalid parent %d", seq, exportedState.ParentSeq)
+		}
+		for _, pos := range []exportedPosition{exportedState.Start, exportedState.CursorBefore, exportedState.CursorAfter} {
+			if pos.Row < 0 || pos.Col < 0 {
+				return nil, fmt.Errorf("E824: Incompatible undo file: state %d has invalid position", seq)
+			}
+		}
+
+		states = append(states, undoState{
+			parentSeq:    exportedState.ParentSeq,
+			childSeqs:    nil,
+			redoChildSeq: exportedState.RedoChildSeq,
+			delta: textDelta{
+				start:   importPosition(exportedState.Start),
+				oldText: exportedState.OldText,
+				newText: exportedState.NewText,
+			},
+			cursorBefore: importPosition(exportedState.CursorBefore),
+			cursorAfter:  importPosition(exportedState.CursorAfter),
+			time:         exportedState.Time,
+		})
+		if seq > 0 {
+			parent := &states[exportedState.ParentSeq]
+			parent.childSeqs = append(parent.childSeqs, seq)
+		}
+	}
+
+	for seq, state := range states {
+		if state.redoChildSeq != -1 && (state.redoChildSeq >= len(states) || states[state.redoChildSeq].parentSeq != seq) {
+			return nil, fmt.Errorf("E824: Incompatible undo file: state %d has invalid redo state %d", seq, state.redoChildSeq)
+		}
+	}
+	return states, nil
+}
+
+// Checks that every state's change applies cleanly, by walking the whole tree from the current state (whose text is
+// the buffer's) and checking that each change finds the text it expects where it expects it
+// The walk keeps one copy of the buffer's rows, changing it on the way down to each state and changing it back on the
+// way up, so each change only costs as much as the rows it touches
+func checkUndoStatesApply(states []undoState, currentSeq int, value string) error {
+	// A move from one state to a neighbouring one, replacing the current text at the start with the new text
+	type move struct {
+		toSeq       int
+		fromSeq     int
+		start       textarea.Position
+		currentText string
+		newText     string
+		isReturn    bool
+	}
+	rows := strings.Split(value, "\n")
+
+	// Going up to the parent undoes the state's change, and going down to a child redoes the child's
+	getMovesFrom := func(seq int, fromSeq int) []move {
+		state := states[seq]
+		moves := []move{}
+		if state.parentSeq != -1 && state.parentSeq != fromSeq {
+			moves = append(moves, move{
+				toSeq:       state.parentSeq,
+				fromSeq:     seq,
+				start:       state.delta.start,
+				currentText: state.delta.newText,
+				newText:     state.delta.oldText,
+				isReturn:    false,
+			})
+		}
+		for _, childSeq := range state.childSeqs {
+			if childSeq == fromSeq {
+				continue
+			}
+			child := states[childSeq]
+			moves = append(moves, move{
+				toSeq:       childSeq,
+				fromSeq:     seq,
+				start:       child.delta.start,
+				currentText: child.delta.oldText,
+				newText:     child.delta.newText,
+				isReturn:    false,
+			})
+		}
+		return moves
+	}
+
+	toMake := getMovesFrom(currentSeq, -1)
+	for len(toMake) > 0 {
+		current := toMake[len(toMake)-1]
+		toMake = toMake[:len(toMake)-1]
+
+		var ok bool
+		if rows, ok = replaceRowsAt(rows, current.start, current.currentText, current.newText); !ok {
+			// The change that doesn't apply is the child's when going down, or the state's own when going up
+			badSeq := current.toSeq
+			if states[current.fromSeq].parentSeq == current.toSeq {
+				badSeq = current.fromSeq
+			}
+			return fmt.Errorf("E824: Incompatible undo file: state %d doesn't apply to the buffer", badSeq)
+		}
+		if current.isReturn {
+			continue
+		}
+
+		// Once everything past the state has been checked, the rows get changed back for the next move from the state
+		// this one came from
+		toMake = append(toMake, move{
+			toSeq:       current.fromSeq,
+			fromSeq:     current.toSeq,
+			start:       current.start,
+			currentText: current.newText,
+			newText:     current.currentText,
+			isReturn:    true,
+		})
+		toMake = append(toMake, getMovesFrom(current.toSeq, current.fromSeq)...)
+	}
+	return nil
+}
+
+// Replaces the current text at the position in the rows with the new text, returning false if the current text isn't
+// there
+// Only the rows that the current text covers get looked at, and they get changed in place when the number of rows stays
+// the same
+func replaceRowsAt(rows []string, start textarea.Position, currentText string, newText string) ([]string, bool) {
+	endRow := start.Row + strings.Count(currentText, "\n")
+	if endRow >= len(rows) || start.Col > utf8.RuneCountInString(rows[start.Row]) {
+		return rows, false
+	}
+
+	touched := strings.Join(rows[start.Row:endRow+1], "\n")
+	startIdx := len(string([]rune(rows[start.Row])[:start.Col]))
+	if !strings.HasPrefix(touched[startIdx:], currentText) {
+		return rows, false
+	}
+	newRows := strings.Split(touched[:startIdx]+newText+touched[startIdx+len(currentText):], "\n")
+
+	if len(newRows) == endRow+1-start.Row {
+		copy(rows[start.Row:], newRows)
+		return rows, true
+	}
+	return append(rows[:start.Row], append(newRows, rows[endRow+1:]...)...), true
+}
+
+func hashBufferContents(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+func getRegisterKind(name string) (rangeKind, bool) {
+	for kind, kindName := range registerKindNames {
+		if kindName == name {
+			return kind, true
+		}
+	}
+	return rangeKind_Characterwise, false
+}
+
+func exportPosition(pos textarea.Position) exportedPosition {
+	return exportedPosition{Row: pos.Row, Col: pos.Col}
+}
+
+func importPosition(pos exportedPosition) textarea.Position {
+	return textarea.Position{Row: pos.Row, Col: pos.Col}
+}
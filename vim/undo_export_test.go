@@ -0,0 +1,136 @@
+package vim
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// Makes a model with a branching undo history and something in register "a", returning it along with its exported
+// history
+func getExportedTestModel(t *testing.T) (*Model, []byte) {
+	t.Helper()
+	model := newTestModel("one\ntwo\nthree")
+	sendKeys(model, `ddjx"ayyuGofour<Esc>uu<C-r>`)
+	data, err := model.ExportUndoHistory(true)
+	if err != nil {
+		t.Fatalf("exporting the undo history failed: %v", err)
+	}
+	return model, data
+}
+
+func TestUndoHistoryRoundTrip(t *testing.T) {
+	exported, data := getExportedTestModel(t)
+
+	model := newTestModel(exported.GetValue())
+	if err := model.ImportUndoHistory(data); err != nil {
+		t.Fatalf("importing the undo history failed: %v", err)
+	}
+	sendKeys(model, "u")
+	if value := model.GetValue(); value != "one\ntwo\nthree" {
+		t.Errorf("got %q after undoing", value)
+	}
+	sendKeys(model, "<C-r><C-r>")
+	if value := model.GetValue(); value != "two\nthree\nfour" {
+		t.Errorf("got %q after redoing the newest branch", value)
+	}
+	sendKeys(model, "g-")
+	if value := model.GetValue(); value != "two\nhree" {
+		t.Errorf("got %q after going back to the older branch", value)
+	}
+	if text := model.getRegister('a').text; text != "hree\n" {
+		t.Errorf("got %q in register a", text)
+	}
+}
+
+func TestExportWithoutRegisters(t *testing.T) {
+	model, _ := getExportedTestModel(t)
+	data, err := model.ExportUndoHistory(false)
+	if err != nil {
+		t.Fatalf("exporting the undo history failed: %v", err)
+	}
+	if strings.Contains(string(data), "registers") {
+		t.Errorf("got registers in the export, want none")
+	}
+}
+
+func TestImportRejectsMismatches(t *testing.T) {
+	exported, data := getExportedTestModel(t)
+
+	if err := newTestModel("different").ImportUndoHistory(data); err == nil {
+		t.Errorf("importing history for a different buffer succeeded")
+	}
+	if err := newTestModel(exported.GetValue()).ImportUndoHistory([]byte(`{"version":2}`)); err == nil {
+		t.Errorf("importing an unknown version succeeded")
+	}
+
+	// A change that doesn't apply to the text it's meant to change makes the history unusable
+	tampered := strings.Replace(string(data), `"oldText": "t"`, `"oldText": "q"`, 1)
+	if tampered == string(data) {
+		t.Fatalf("export doesn't have the change to tamper with:\n%s", data)
+	}
+	err := newTestModel(exported.GetValue()).ImportUndoHistory([]byte(tampered))
+	if err == nil || !strings.Contains(err.Error(), "doesn't apply") {
+		t.Errorf("got error %v from importing a change that doesn't apply, want E824", err)
+	}
+}
+
+func TestImportRejectsRegisters(t *testing.T) {
+	exported, data := getExportedTestModel(t)
+	// Registers that can't be read back the way they were stored (e.g. "A" is an alias for appending to "a")
+	for _, name := range []string{"A", "+", "*", "_", "."} {
+		renamed := strings.Replace(string(data), `"a": {`, `"`+name+`": {`, 1)
+		if renamed == string(data) {
+			t.Fatalf("export doesn't have register a:\n%s", data)
+		}
+		if err := newTestModel(exported.GetValue()).ImportUndoHistory([]byte(renamed)); err == nil {
+			t.Errorf("importing register %q succeeded", name)
+		}
+	}
+}
+
+func TestReplaceRowsAt(t *testing.T) {
+	for _, test := range []struct {
+		rows        []string
+		start       textarea.Position
+		currentText string
+		newText     string
+		wantRows    []string
+		wantOk      bool
+	}{
+		{[]string{"abc", "def"}, textarea.Position{Row: 0, Col: 1}, "b", "XY", []string{"aXYc", "def"}, true},
+		{[]string{"abc", "def"}, textarea.Position{Row: 0, Col: 2}, "c\nd", "", []string{"abef"}, true},
+		{[]string{"abc", "def"}, textarea.Position{Row: 1, Col: 3}, "", "\nghi", []string{"abc", "def", "ghi"}, true},
+		{[]string{"éa", "b"}, textarea.Position{Row: 0, Col: 1}, "a", "z", []string{"éz", "b"}, true},
+		{[]string{"abc", "def"}, textarea.Position{Row: 0, Col: 1}, "c", "", []string{"abc", "def"}, false},
+		{[]string{"abc", "def"}, textarea.Position{Row: 1, Col: 2}, "f\n", "", []string{"abc", "def"}, false},
+		{[]string{"abc", "def"}, textarea.Position{Row: 2, Col: 0}, "", "x", []string{"abc", "def"}, false},
+		{[]string{"abc", "def"}, textarea.Position{Row: 0, Col: 4}, "", "x", []string{"abc", "def"}, false},
+	} {
+		rows := append([]string{}, test.rows...)
+		gotRows, ok := replaceRowsAt(rows, test.start, test.currentText, test.newText)
+		if ok != test.wantOk || !reflect.DeepEqual(gotRows, test.wantRows) {
+			t.Errorf("got %q (ok: %v) from replacing %q with %q at %v in %q, want %q (ok: %v)", gotRows, ok, test.currentText, test.newText, test.start, test.rows, test.wantRows, test.wantOk)
+		}
+	}
+}
+
+func TestImportChecksEveryBranch(t *testing.T) {
+	// Each branch deletes from the start of the buffer, so the rows have to be changed back after checking one branch for
+	// the next to apply
+	model := newTestModel("abc\ndef")
+	sendKeys(model, "xuxxuuxu")
+	data, err := model.ExportUndoHistory(false)
+	if err != nil {
+		t.Fatalf("exporting the undo history failed: %v", err)
+	}
+	imported := newTestModel(model.GetValue())
+	if err := imported.ImportUndoHistory(data); err != nil {
+		t.Fatalf("importing the undo history failed: %v", err)
+	}
+	if numStates := len(imported.GetUndoStates()); numStates != len(model.GetUndoStates()) {
+		t.Errorf("got %d undo states after importing, want %d", numStates, len(model.GetUndoStates()))
+	}
+}
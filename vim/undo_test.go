@@ -0,0 +1,247 @@
+package vim
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+func TestUndoRestoresCursor(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nb\nc", 1, 0, "ddu", "a\nb\nc", 1, 0},
+		{"a\nb\nc", 2, 0, "ddu", "a\nb\nc", 2, 0},
+		{"a\nb\nc", 2, 0, "ddGu", "a\nb\nc", 2, 0},
+		{"a\nb\nc", 0, 0, "ddjju", "a\nb\nc", 0, 0},
+		{"foo bar", 0, 4, "dwggu", "foo bar", 0, 4},
+		{"foo bar", 0, 4, "dw0u<C-r>", "foo ", 0, 3},
+		{"a\nb", 1, 0, "ofoo<Esc>u", "a\nb", 1, 0},
+		{"a\nb", 0, 0, "ofoo<Esc>ggu<C-r>", "a\nfoo\nb", 1, 2},
+		{"abc", 0, 1, "Rxy<Esc>0u", "abc", 0, 1},
+		{"one two", 0, 0, ":s/o/0/g<CR>u", "one two", 0, 0},
+		{"x\ny\nz", 0, 0, "Gddggdd:1<CR>uu", "x\ny\nz", 2, 0},
+	})
+}
+
+func TestUndoCounts(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a b c", 0, 0, "xwxwx3u", "a b c", 0, 0},
+		{"a b c", 0, 0, "xwxwx3u2<C-r>", "  c", 0, 1},
+	})
+}
+
+func TestUndoRestoresMarks(t *testing.T) {
+	model := newTestModel("a\nb\nc")
+	sendKeys(model, "jmxkddu`x")
+	if cursor := model.area.GetCursorPosition(); cursor != (textarea.Position{Row: 1, Col: 0}) {
+		t.Errorf("got the cursor at %v after jumping to a mark that was moved by an undone change", cursor)
+	}
+
+	model = newTestModel("l0\nl1\nl2\nl3")
+	sendKeys(model, "jjmxggddGdduu`x")
+	if cursor := model.area.GetCursorPosition(); cursor != (textarea.Position{Row: 2, Col: 0}) {
+		t.Errorf("got the cursor at %v after jumping to a mark that was moved by two undone changes", cursor)
+	}
+}
+
+func TestTextDeltas(t *testing.T) {
+	// Every text of up to three characters, including line breaks
+	texts := []string{""}
+	for length := 1; length <= 3; length++ {
+		for _, text := range texts {
+			if len(text) == length-1 {
+				texts = append(texts, text+"a", text+"b", text+"\n")
+			}
+		}
+	}
+
+	for _, oldText := range texts {
+		for _, newText := range texts {
+			// The textarea drops a trailing line break when its value gets set, but deltas can still add one
+			model := newTestModel(oldText)
+			oldText := model.GetValue()
+			delta := getTextDelta(oldText, newText)
+			model.applyTextDelta(delta.start, delta.oldText, delta.newText)
+			if value := model.GetValue(); value != newText {
+				t.Fatalf("got %q from applying delta %+v from %q to %q", value, delta, oldText, newText)
+			}
+			model.applyTextDelta(delta.start, delta.newText, delta.oldText)
+			if value := model.GetValue(); value != oldText {
+				t.Fatalf("got %q from reverting delta %+v from %q to %q", value, delta, oldText, newText)
+			}
+		}
+	}
+}
+
+func TestUndoTree(t *testing.T) {
+	// "x", then undoing it and "$x" makes state 1 ("bc") and state 2 ("ab") branch off the original state
+	runKeysTests(t, []keysTest{
+		{"abc", 0, 0, "xuxu<C-r>", "bc", -1, 0},
+		{"abc", 0, 0, "xu$xg-", "bc", -1, 0},
+		{"abc", 0, 0, "xu$xg-g-", "abc", -1, 0},
+		{"abc", 0, 0, "xu$xg-g-g+g+", "ab", -1, 0},
+		{"abc", 0, 0, "xu$x3g-", "abc", -1, 0},
+		{"abc", 0, 0, "xu$x:earlier 2<CR>", "abc", -1, 0},
+		{"abc", 0, 0, "xu$x:earlier 2<CR>:later<CR>", "bc", -1, 0},
+		{"abc", 0, 0, "xxx:earlier 1h<CR>", "abc", -1, 0},
+		{"abc", 0, 0, "xxx:earlier 1h<CR>:later 1d<CR>", "", -1, 0},
+		{"abc", 0, 0, "xxx:earlier 1f<CR>", "", -1, 0},
+	})
+}
+
+func TestHostUndoTree(t *testing.T) {
+	model := newTestModel("abc")
+	sendKeys(model, "xu$x")
+	if seq := model.GetCurrentUndoState(); seq != 2 {
+		t.Errorf("got current state %d, want 2", seq)
+	}
+	states := model.GetUndoStates()
+	if len(states) != 3 || !reflect.DeepEqual(states[0].ChildSeqs, []int{1, 2}) || states[2].ParentSeq != 0 || states[2].NumChanges != 1 {
+		t.Errorf("got states %+v, want two states branching off the original one", states)
+	}
+
+	if err := model.GoToUndoState(1); err != nil {
+		t.Errorf("going to state 1 failed: %v", err)
+	}
+	if value := model.GetValue(); value != "bc" {
+		t.Errorf("got %q after going to state 1", value)
+	}
+	if err := model.GoToUndoState(9); err == nil {
+		t.Errorf("going to a state that doesn't exist succeeded")
+	}
+}
+
+func TestUndoByTime(t *testing.T) {
+	model := newTestModel("abcd")
+	sendKeys(model, "xxx")
+	start := time.Now()
+	for seq := range model.undoStates {
+		model.undoStates[seq].time = start.Add(time.Duration(seq) * time.Minute)
+	}
+
+	sendKeys(model, ":earlier 90s<CR>")
+	if value := model.GetValue(); value != "bcd" {
+		t.Errorf("got %q after going 90 seconds back from the last change", value)
+	}
+	sendKeys(model, ":later 60s<CR>")
+	if value := model.GetValue(); value != "cd" {
+		t.Errorf("got %q after going 60 seconds forward", value)
+	}
+}
+
+func TestProgrammaticEditsAreUndoable(t *testing.T) {
+	// Setting the value of a new model loads it, rather than making a change
+	model := newTestModel("abc")
+	sendKeys(model, "u")
+	if value := model.GetValue(); value != "abc" {
+		t.Errorf("got %q after undoing the loaded value", value)
+	}
+
+	model.SetValue("xyz")
+	sendKeys(model, "u")
+	if value := model.GetValue(); value != "abc" {
+		t.Errorf("got %q after undoing SetValue", value)
+	}
+	sendKeys(model, "<C-r>")
+	if value := model.GetValue(); value != "xyz" {
+		t.Errorf("got %q after redoing SetValue", value)
+	}
+}
+
+func TestEdits(t *testing.T) {
+	model := newTestModel("xyz")
+	model.SetValue("abc")
+
+	if err := model.BeginEdit(); err != nil {
+		t.Fatalf("beginning an edit failed: %v", err)
+	}
+	if err := model.BeginEdit(); err == nil {
+		t.Errorf("beginning an edit inside another one succeeded")
+	}
+	model.SetValue("one\ntwo")
+	model.ReplaceLine("TWO")
+	sendKeys(model, "0x")
+	if err := model.CommitEdit(); err != nil {
+		t.Fatalf("committing the edit failed: %v", err)
+	}
+	if err := model.CommitEdit(); err == nil {
+		t.Errorf("committing an edit that isn't open succeeded")
+	}
+	if value := model.GetValue(); value != "one\nWO" {
+		t.Errorf("got %q after the edit", value)
+	}
+
+	// The whole edit gets undone in one step
+	sendKeys(model, "u")
+	if value := model.GetValue(); value != "abc" {
+		t.Errorf("got %q after undoing the edit", value)
+	}
+}
+
+func TestRolledBackEdits(t *testing.T) {
+	model := newTestModel("one\ntwo")
+	model.SetValue("one\nWO")
+	sendKeys(model, "gg0")
+
+	model.BeginEdit()
+	model.ReplaceLine("zzz")
+	model.SetValue("qqq")
+	if err := model.RollbackEdit(); err != nil {
+		t.Fatalf("rolling back the edit failed: %v", err)
+	}
+	if value := model.GetValue(); value != "one\nWO" {
+		t.Errorf("got %q after rolling back the edit", value)
+	}
+	if cursor := model.area.GetCursorPosition(); cursor != (textarea.Position{Row: 0, Col: 0}) {
+		t.Errorf("got the cursor at %v after rolling back the edit", cursor)
+	}
+
+	// Nothing's left of the edit to undo
+	sendKeys(model, "u")
+	if value := model.GetValue(); value != "one\ntwo" {
+		t.Errorf("got %q after undoing", value)
+	}
+}
+
+func TestInsertModeUndoBreaks(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"abc", 0, 0, "Afoobar<Esc>u", "abc", -1, 0},
+
+		// Ctrl+G u and moving the cursor both start a new undo step, unless Ctrl+G U comes before the move
+		{"abc", 0, 0, "Afoo<C-g>ubar<Esc>u", "abcfoo", -1, 0},
+		{"abc", 0, 0, "Afoo<C-g>ubar<Esc>uu", "abc", -1, 0},
+		{"abc", 0, 0, "Afoo<Left>bar<Esc>u", "abcfoo", 0, 5},
+		{"abc", 0, 0, "Afoo<C-g>U<Left>bar<Esc>u", "abc", -1, 0},
+	})
+}
+
+func TestUndoStatesHoldOnlyTheChange(t *testing.T) {
+	for _, test := range []struct {
+		keys      string
+		wantDelta textDelta
+	}{
+		{"50G0x", textDelta{start: textarea.Position{Row: 49, Col: 1}, oldText: " ", newText: ""}},
+		{"50Gdd", textDelta{start: textarea.Position{Row: 49, Col: 0}, oldText: "  line 49\n", newText: ""}},
+		{"Gdd", textDelta{start: textarea.Position{Row: 98, Col: 9}, oldText: "\n  line 99", newText: ""}},
+		{"50Gox<CR>y<Esc>", textDelta{start: textarea.Position{Row: 50, Col: 0}, oldText: "", newText: "x\ny\n"}},
+		{"50GAa<BS>b<Esc>", textDelta{start: textarea.Position{Row: 49, Col: 9}, oldText: "", newText: "b"}},
+		{"50GJ", textDelta{start: textarea.Position{Row: 49, Col: 9}, oldText: "\n ", newText: ""}},
+		{"50G:m51<CR>", textDelta{start: textarea.Position{Row: 49, Col: 7}, oldText: "49\n  line 50", newText: "50\n  line 49"}},
+	} {
+		model := newTestModel(getNumberedLines(100))
+		sendKeys(model, test.keys)
+		if numStates := len(model.undoStates); numStates != 2 {
+			t.Errorf("got %d undo states after %q, want the original one and the change", numStates, test.keys)
+			continue
+		}
+		if delta := model.undoStates[1].delta; delta != test.wantDelta {
+			t.Errorf("got delta %+v after %q, want %+v", delta, test.keys, test.wantDelta)
+		}
+
+		sendKeys(model, "u")
+		if value := model.GetValue(); value != getNumberedLines(100) {
+			t.Errorf("got %q after undoing %q", value, test.keys)
+		}
+	}
+}
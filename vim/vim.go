@@ -3,17 +3,29 @@ package vim
 import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/mieubrisse/vim-bubble/clipboard"
 	"github.com/mieubrisse/vim-bubble/textarea"
 	"strings"
+	"time"
 )
 
 type Mode string
 
 const (
-	NormalMode Mode = "NORMAL"
-	InsertMode Mode = "INSERT"
+	NormalMode  Mode = "NORMAL"
+	InsertMode  Mode = "INSERT"
+	ReplaceMode Mode = "REPLACE"
+
+	VisualMode      Mode = "VISUAL"
+	VisualLineMode  Mode = "V-LINE"
+	VisualBlockMode Mode = "V-BLOCK"
 )
 
+// Whether typing in the mode puts text into the buffer, in which case the cursor can go past the end of the line
+func (mode Mode) isInsertOrReplace() bool {
+	return mode == InsertMode || mode == ReplaceMode
+}
+
 const (
 	shouldBindToLineWhenMovingRight = true
 
@@ -22,10 +34,8 @@ const (
 
 	minModePlacardCharacters = 1
 	// TODO Make this dynamic by looking at the length of the mode strings!
-	maxModePlacardCharacters  = 6
+	maxModePlacardCharacters  = 7
 	desiredModePlacardPadding = 1
-
-	numHistoryStepsToKeep = 20
 )
 
 var defaultNormalModePlacardStyle = lipgloss.NewStyle().
@@ -36,58 +46,274 @@ var defaultInsertModePlacardStyle = lipgloss.NewStyle().
 	Background(lipgloss.Color("#61d4fa")).
 	Foreground(lipgloss.Color("#000000"))
 
+var defaultReplaceModePlacardStyle = lipgloss.NewStyle().
+	Background(lipgloss.Color("#c061fa")).
+	Foreground(lipgloss.Color("#000000"))
+
+var defaultVisualModePlacardStyle = lipgloss.NewStyle().
+	Background(lipgloss.Color("#f5a142")).
+	Foreground(lipgloss.Color("#000000"))
+
+var defaultVisualLineModePlacardStyle = lipgloss.NewStyle().
+	Background(lipgloss.Color("#f57b42")).
+	Foreground(lipgloss.Color("#000000"))
+
+var defaultVisualBlockModePlacardStyle = lipgloss.NewStyle().
+	Background(lipgloss.Color("#f54e42")).
+	Foreground(lipgloss.Color("#000000"))
+
 var unknownModePlacardStyle = lipgloss.NewStyle().
 	Background(lipgloss.Color("#FFFFFF")).
 	Foreground(lipgloss.Color("#000000"))
 
 type Model struct {
+	// The most recent error (e.g. from reading the clipboard), if any
+	Err error
+
 	NormalModePlacardStyle lipgloss.Style
 
 	InsertModePlacardStyle lipgloss.Style
 
+	ReplaceModePlacardStyle lipgloss.Style
+
+	VisualModePlacardStyle lipgloss.Style
+
+	VisualLineModePlacardStyle lipgloss.Style
+
+	VisualBlockModePlacardStyle lipgloss.Style
+
+	// The options that can be changed with ":set"
+	Settings Settings
+
+	// How big the buffer can get from the keys the user types
+	Limits Limits
+
 	mode Mode
 
 	isFocused bool
 
 	area textarea.Model
 
-	// Buffer for storing N-graphs (e.g. digraphs, trigraphs, etc.)
+	// Buffer for storing N-graphs (e.g. digraphs, trigraphs, etc.), one entry per keypress
 	// TODO is this actually called an ngraph?
-	nGraphBuffer string
+	nGraphBuffer []string
 
 	// TODO something about the written vs unwritten buffer
 
-	// The undo history, which gets an entry every time we leave insert mode
-	// New history entries are added to the back of this list
-	undoHistory []string
+	// The undo tree's states, indexed by their Seq, which gets a new state every time a change is checkpointed (e.g.
+	// when we leave insert mode)
+	undoStates []undoState
+
+	// The Seq of the state that the buffer is in
+	currentUndoSeq int
+
+	// Where the cursor was when the command being run started, if it hasn't made a checkpoint yet
+	cursorBeforeChange *textarea.Position
+
+	// Set between BeginEdit and CommitEdit (or RollbackEdit), while programmatic edits are grouped into one undo step
+	isInEdit bool
+
+	// Set after "ctrl+g" in insert mode, while waiting for the key that says what to do with the undo history
+	isAwaitingInsertModeUndoKey bool
+
+	// Set by "ctrl+g U" in insert mode, so that the next cursor movement doesn't start a new undo step
+	shouldKeepUndoStepOnNextMove bool
+
+	// The contents of the writable registers, keyed by their (lowercase) name
+	registers map[rune]register
+
+	// The text typed since entering insert mode, which becomes the last inserted text when leaving it
+	insertedText []rune
+
+	// What each character typed in replace mode did, most recent last, so that backspace can undo it
+	replacedChars []replacedChar
+
+	// The contents of the read-only "." register
+	lastInsertedText string
+
+	// The contents of the read-only ":" register
+	lastCommandLine string
+
+	// The contents of the read-only "%" register
+	fileName string
+
+	// Backs the "+" and "*" registers
+	clipboard clipboard.Clipboard
+
+	// Clipboard writes get sent out as commands (see writeClipboard), numbered in the order they're made
+	clipboardWriter        *clipboardWriter
+	numClipboardWrites     int
+	pendingClipboardWrites map[clipboard.Selection]pendingClipboardWrite
+
+	// The most recent change, for repeating with "."
+	lastChange *repeatableChange
 
-	// The pointer within the history of what the text buffer is currently displaying (needed for redoing)
-	historyPointer int
+	// The change in progress while in insert mode, which becomes the last change when insert mode ends
+	changeBeingRecorded *repeatableChange
 
-	// Corresponds to Vim's " register, which contains both yanked and deleted text
-	commaRegister string
+	// Keys waiting to be handled as though they'd been typed (e.g. by "." or "@")
+	keysToReplay []tea.KeyMsg
+
+	// The register that keys are being recorded into with "q", or 0 if we're not recording
+	macroRegister rune
+
+	// The keys typed since the current recording started
+	macroKeys []tea.KeyMsg
+
+	// The register most recently played with "@", for "@@"
+	lastPlayedMacroRegister rune
+
+	// The line being typed in the status bar area (e.g. a search pattern), if any
+	commandLine *commandLine
+
+	// Previously submitted command lines, oldest first, keyed by the kind of command line (see getHistoryKind)
+	commandLineHistories map[rune][]string
+
+	// The ex commands that can be run from the ":" command line, including the ones the host application registered
+	exCommands []exCommand
+
+	// How many ex commands are running (ex commands can run other ex commands, e.g. with ":normal :d")
+	// History checkpoints are put off until the outermost command finishes, so it gets undone in one step.
+	exCommandDepth int
+
+	// Set while ":g" runs its command on each line, since it can't be nested
+	isRunningGlobal bool
+
+	// The message shown in the status bar (e.g. an error from an ex command), until the next key is pressed
+	statusMessage string
+
+	// Commands produced while handling keys (e.g. by host-registered ex commands), for Update to return
+	queuedCmds []tea.Cmd
+
+	// The characters that make up keywords, parsed from the "iskeyword" setting (which is kept alongside, so that
+	// changes to the setting can be noticed)
+	keywordChars     keywordCharSet
+	keywordCharsSpec string
+
+	// The pairs from the "matchpairs" setting, parsed (and kept alongside the setting) like keywordChars
+	matchPairs     [][2]rune
+	matchPairsSpec string
+
+	// The most recent search, for repeating with "n" and "N"
+	lastSearch search
+
+	// The most recent ":s", for repeating with ":&", "&" and "g&"
+	lastSubstitution *substitution
+
+	// The ":s" in progress, while its "c" flag has it waiting for the user to confirm a replacement
+	pendingSubstitution *substitutionRun
+
+	// Whether the matches of the last search are highlighted
+	isHighlightingSearch bool
+
+	// The last "f", "F", "t", or "T" motion, for repeating with ";" and ","
+	lastCharacterFind characterFind
+
+	// The end of the visual mode selection that stays put while the cursor moves
+	visualAnchor textarea.Position
+
+	// The most recent visual mode selection, for reselecting with "gv"
+	lastVisualSelection visualSelection
+
+	// The marks set with "m" or by the editor itself (e.g. "." and "["), keyed by name
+	marks map[rune]mark
+
+	// The positions jumped away from, oldest first, for going back and forth with "ctrl+o" and "ctrl+i"
+	jumpList []mark
+
+	// Where we are in the jumplist, which is its length when we're not moving through it
+	jumpListIdx int
+
+	// Set while in insert mode after changing a visual block, so that the typed text can be copied to every row
+	pendingBlockInsert *blockInsert
 
 	width  int
 	height int
 }
 
-func New() Model {
+// Option configures a Model when it's created
+type Option func(*Model)
+
+// WithClipboard sets the clipboard backing the "+" and "*" registers (and insert mode's paste), in place of the
+// clipboard of the machine the program is running on
+func WithClipboard(board clipboard.Clipboard) Option {
+	return func(model *Model) {
+		model.clipboard = board
+		model.area.SetClipboard(board)
+	}
+}
+
+func New(opts ...Option) Model {
 	area := textarea.New()
 	area.SetValue("")
+	area.SetChange(nil)
 	area.Prompt = ""
-	return Model{
-		NormalModePlacardStyle: defaultNormalModePlacardStyle,
-		InsertModePlacardStyle: defaultInsertModePlacardStyle,
-		mode:                   NormalMode,
-		isFocused:              false,
-		area:                   area,
-		nGraphBuffer:           "",
-		undoHistory:            []string{""},
-		historyPointer:         0,
-		commaRegister:          "",
-		width:                  0,
-		height:                 0,
+	model := Model{
+		Err:                          nil,
+		NormalModePlacardStyle:       defaultNormalModePlacardStyle,
+		InsertModePlacardStyle:       defaultInsertModePlacardStyle,
+		ReplaceModePlacardStyle:      defaultReplaceModePlacardStyle,
+		VisualModePlacardStyle:       defaultVisualModePlacardStyle,
+		VisualLineModePlacardStyle:   defaultVisualLineModePlacardStyle,
+		VisualBlockModePlacardStyle:  defaultVisualBlockModePlacardStyle,
+		Settings:                     DefaultSettings(),
+		Limits:                       Limits{MaxLines: 0, MaxChars: 0},
+		mode:                         NormalMode,
+		isFocused:                    false,
+		area:                         area,
+		nGraphBuffer:                 nil,
+		undoStates:                   []undoState{{parentSeq: -1, childSeqs: nil, redoChildSeq: -1, time: time.Now()}},
+		currentUndoSeq:               0,
+		cursorBeforeChange:           nil,
+		isInEdit:                     false,
+		isAwaitingInsertModeUndoKey:  false,
+		shouldKeepUndoStepOnNextMove: false,
+		registers:                    map[rune]register{},
+		insertedText:                 nil,
+		replacedChars:                nil,
+		lastInsertedText:             "",
+		lastCommandLine:              "",
+		fileName:                     "",
+		clipboard:                    clipboard.NewAtotto(),
+		clipboardWriter:              newClipboardWriter(),
+		numClipboardWrites:           0,
+		pendingClipboardWrites:       map[clipboard.Selection]pendingClipboardWrite{},
+		lastChange:                   nil,
+		changeBeingRecorded:          nil,
+		keysToReplay:                 nil,
+		macroRegister:                0,
+		macroKeys:                    nil,
+		lastPlayedMacroRegister:      0,
+		commandLine:                  nil,
+		commandLineHistories:         map[rune][]string{},
+		exCommands:                   getBuiltinExCommands(),
+		exCommandDepth:               0,
+		isRunningGlobal:              false,
+		statusMessage:                "",
+		queuedCmds:                   nil,
+		keywordChars:                 keywordCharSet{},
+		keywordCharsSpec:             "",
+		matchPairs:                   nil,
+		matchPairsSpec:               "",
+		lastSearch:                   search{},
+		lastSubstitution:             nil,
+		pendingSubstitution:          nil,
+		isHighlightingSearch:         false,
+		lastCharacterFind:            characterFind{},
+		visualAnchor:                 textarea.Position{},
+		lastVisualSelection:          visualSelection{},
+		marks:                        map[rune]mark{},
+		jumpList:                     nil,
+		jumpListIdx:                  0,
+		pendingBlockInsert:           nil,
+		width:                        0,
+		height:                       0,
+	}
+
+	for _, opt := range opts {
+		opt(&model)
 	}
+	return model
 }
 
 func (model Model) Init() tea.Cmd {
@@ -95,210 +321,41 @@ func (model Model) Init() tea.Cmd {
 }
 
 func (model *Model) Update(msg tea.Msg) tea.Cmd {
-	var resultCmds []tea.Cmd
-
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		switch model.mode {
-		case InsertMode:
-			if msg.String() == "esc" {
-				model.mode = NormalMode
-				model.area.MoveCursorLeftOneRune()
-
-				model.CheckpointHistory()
-
-				break
-			}
-			resultCmds = append(resultCmds, model.area.Update(msg))
-		case NormalMode:
-			// TODO clean this whole thing up to make the processing of motion commands way better!
-
-			// TODO handle ngraphs + motion keys (right now they just clear)
-			switch msg.String() {
-			case "esc":
-				model.nGraphBuffer = ""
-			case "a":
-				// This is a deviation from Vim, but I'm fine with it
-				model.nGraphBuffer = ""
-				model.area.MoveCursorRightOneRune(false)
-				model.mode = InsertMode
-			case "A":
-				model.area.MoveCursorToLineEnd(false)
-				model.mode = InsertMode
-			case "i":
-				// TODO handle movement commands with numbers
-				model.nGraphBuffer = ""
-				model.mode = InsertMode
-				break
-			case "I":
-				model.area.MoveCursorToLineStart()
-				model.mode = InsertMode
-			case "h":
-				// TODO handle movement commands with numbers
-				model.nGraphBuffer = ""
-				model.area.MoveCursorLeftOneRune()
-			case "j":
-				// TODO handle movement commands with numbers
-				model.nGraphBuffer = ""
-				// We want line-binding because we're in normal mode, so we shouldn't have the cursor beyond the end of the line
-				model.area.MoveCursorDown(true)
-			case "k":
-				// TODO handle movement commands with numbers
-				model.nGraphBuffer = ""
-				// We want line-binding because we're in normal mode, so we shouldn't have the cursor beyond the end of the line
-				model.area.MoveCursorUp(true)
-			case "l":
-				// TODO handle movement commands with numbers
-				model.nGraphBuffer = ""
-				model.area.MoveCursorRightOneRune(shouldBindToLineWhenMovingRight)
-			case "b", "B":
-				// TODO handle movement commands with numbers
-				model.nGraphBuffer = ""
-				model.area.MoveCursorByWord(textarea.CursorMovementDirection_Left, textarea.WordwiseMovementStopPosition_Terminus)
-			case "w", "W":
-				// TODO handle movement commands with numbers
-				model.nGraphBuffer = ""
-				model.area.MoveCursorByWord(textarea.CursorMovementDirection_Right, textarea.WordwiseMovementStopPosition_Incidence)
-			case "e", "E":
-				// TODO handle repeats
-				switch model.nGraphBuffer {
-				case "":
-					model.area.MoveCursorByWord(textarea.CursorMovementDirection_Right, textarea.WordwiseMovementStopPosition_Terminus)
-				case "g":
-					model.area.MoveCursorByWord(textarea.CursorMovementDirection_Left, textarea.WordwiseMovementStopPosition_Incidence)
-				}
-				// I thiiink this is right??
-				model.nGraphBuffer = ""
-			case "^":
-				switch model.nGraphBuffer {
-				case "d":
-					model.area.DeleteBeforeCursor()
-					model.nGraphBuffer = ""
-					// TODO extract this into something better!
-					model.CheckpointHistory()
-				case "c":
-					model.area.DeleteBeforeCursor()
-					model.mode = InsertMode
-					model.nGraphBuffer = ""
-					// TODO extract this into something better!
-					model.CheckpointHistory()
-				default:
-					model.area.MoveCursorToLineStart()
-				}
-			case "$":
-				switch model.nGraphBuffer {
-				case "d":
-					model.area.DeleteAfterCursor()
-					model.nGraphBuffer = ""
-					// TODO extract this into something better!
-					model.CheckpointHistory()
-				case "c":
-					model.area.DeleteAfterCursor()
-					model.area.MoveCursorRightOneRune(false)
-					model.mode = InsertMode
-					model.nGraphBuffer = ""
-				default:
-					model.area.MoveCursorToLineEnd(true)
-				}
-			case "g":
-				switch model.nGraphBuffer {
-				case "":
-					model.nGraphBuffer = msg.String()
-				case "g":
-					model.area.SetCursorRow(0)
-					model.nGraphBuffer = ""
-				default:
-					// TODO is this right?
-					model.nGraphBuffer = ""
-				}
-			case "f":
-				switch model.nGraphBuffer {
-				case "":
-					model.nGraphBuffer = msg.String()
-				case "f":
-				}
-			case "G":
-				model.area.MoveCursorToLastRow()
-			case "D":
-				model.area.DeleteAfterCursor()
-				// TODO extract this into something better!
-				model.CheckpointHistory()
-			case "C":
-				model.area.DeleteAfterCursor()
-				model.area.MoveCursorRightOneRune(false)
-				model.mode = InsertMode
-			case "o":
-				model.area.InsertLineBelow()
-				model.area.MoveCursorDown(true)
-				model.mode = InsertMode
-			case "O":
-				model.area.InsertLineAbove()
-				model.area.MoveCursorUp(true)
-				model.mode = InsertMode
-			case "d":
-				switch model.nGraphBuffer {
-				case "":
-					model.nGraphBuffer = msg.String()
-				case "d":
-					model.nGraphBuffer = ""
-					model.area.DeleteLine()
-					// TODO extract this into something better!
-					model.CheckpointHistory()
-				default:
-					model.nGraphBuffer = ""
-				}
-			case "c":
-				switch model.nGraphBuffer {
-				case "":
-					model.nGraphBuffer = msg.String()
-				case "c":
-					model.nGraphBuffer = ""
-					model.area.ClearLine()
-					model.mode = InsertMode
-				default:
-					model.nGraphBuffer = ""
-				}
-			case "0":
-				if model.nGraphBuffer == "" {
-					model.area.MoveCursorToLineStart()
-				} else {
-					model.nGraphBuffer += msg.String()
-				}
-			case "1", "2", "3", "4", "5", "6", "7", "8", "9":
-				model.nGraphBuffer += msg.String()
-			case "u":
-				newHistoryPointer := max(0, model.historyPointer-1)
-				if newHistoryPointer != model.historyPointer {
-					model.area.SetValue(model.undoHistory[newHistoryPointer])
-					model.historyPointer = newHistoryPointer
-				}
-			case "ctrl+r":
-				newHistoryPointer := min(len(model.undoHistory)-1, model.historyPointer+1)
-				if newHistoryPointer != model.historyPointer {
-					model.area.SetValue(model.undoHistory[newHistoryPointer])
-					model.historyPointer = newHistoryPointer
-				}
-				// TODO keep the cursor position when reinserting text
-			case "x":
-				deletedRunes := model.area.DeleteOnCursor()
-				model.commaRegister = string(deletedRunes)
-				// TODO extract this into something better!
-				model.CheckpointHistory()
-			case "p":
-				// TODO make this a better thing in the textarea class - it's a kind of hacky way to implement the "paste AFTER cursor location" logic of Vim
-				model.area.MoveCursorRightOneRune(false)
-				model.area.InsertString(model.commaRegister)
-				model.area.MoveCursorLeftOneRune()
-			}
-			// TODO 't', 'f', ';', and ','
+		model.statusMessage = ""
+
+		// The host can change the settings directly, so the textarea gets the one it needs before every key
+		model.area.ScrollOff = model.Settings.ScrollOff
+
+		// Only the keys actually typed get recorded, and not the ones they cause to be replayed (e.g. "@a" gets
+		// recorded, but not the contents of register a)
+		wasRecordingMacro := model.macroRegister != 0
+		limitCheckpoint := model.getLimitCheckpoint(msg)
+		model.queuedCmds = append(model.queuedCmds, model.handleKey(msg))
+		if wasRecordingMacro {
+			model.recordMacroKey(msg)
 		}
+		model.handleReplayedKeys()
+		model.enforceLimits(limitCheckpoint)
+	case clipboardWrittenMsg:
+		model.handleClipboardWritten(msg)
 	}
+
+	// View works on a copy of the model, so this keeps it from having to parse the pairs again on every render
+	model.getMatchPairs()
+
+	resultCmds := model.queuedCmds
+	model.queuedCmds = nil
 	return tea.Batch(resultCmds...)
 }
 
 func (model Model) View() string {
 	resultBuilder := strings.Builder{}
 
+	// The model is a copy, so the highlight can be worked out fresh for every render without anything keeping it
+	// up to date as the cursor moves
+	model.area.SetMatchParenHighlight(model.getMatchParenHighlights())
 	resultBuilder.WriteString(model.area.View())
 	resultBuilder.WriteString("\n")
 	resultBuilder.WriteString(model.renderStatusBar())
@@ -338,14 +395,28 @@ func (model Model) GetHeight() int {
 	return model.height
 }
 
+// SetValue replaces the contents of the buffer, as an undo step of its own (unless it's part of an edit, see BeginEdit)
+// Setting the contents of a new, empty model loads them instead, which (like opening a file in Vim) can't be undone.
 func (model *Model) SetValue(str string) {
-	model.area.SetValue(str)
+	if model.isNewAndEmpty() {
+		model.area.SetValue(str)
+		model.area.SetChange(nil)
+		return
+	}
+	model.makeProgrammaticEdit(func() {
+		model.area.SetValue(str)
+	})
 }
 
 func (model *Model) GetValue() string {
 	return model.area.GetValue()
 }
 
+// SetFileName sets the name of the file being edited, which Vim makes available in the "%" register
+func (model *Model) SetFileName(fileName string) {
+	model.fileName = fileName
+}
+
 func (model *Model) SetMode(mode Mode) {
 	model.mode = mode
 }
@@ -358,32 +429,38 @@ func (model Model) GetCursorRow() int {
 	return model.area.GetRow()
 }
 
-// TODO this is a nasty hack, that I'm exposing purely to allow for tab completion in the app that needs this
-// TODO the ideal would be some standard way to programmatically manipulate the Vim buffer
-func (model *Model) ReplaceLine(newContents string) {
-	model.area.ClearLine()
-	model.area.InsertString(newContents)
+// GetTopRow gets the first row that's in view
+func (model Model) GetTopRow() int {
+	return model.area.GetTopRow()
 }
 
-// Forces a checkpoint in the Vim buffer's history, for undo
-func (model *Model) CheckpointHistory() {
-	if model.area.GetValue() == model.undoHistory[len(model.undoHistory)-1] {
-		return
+// SetTopRow scrolls the view so that the row is at the top, moving the cursor if it would otherwise be out of view
+func (model *Model) SetTopRow(row int) {
+	model.area.ScrollOff = model.Settings.ScrollOff
+	model.area.SetTopRow(row)
+	if !model.mode.isInsertOrReplace() {
+		model.bindCursorToLine()
 	}
+}
 
-	// If the user has rewound, then we discard things they've rewound past
-	preservedHistory := model.undoHistory[:model.historyPointer+1]
-	newHistory := append(
-		preservedHistory,
-		model.area.GetValue(),
-	)
-
-	// Now discard down to the appropriate number of history steps
-	subsliceStartIdx := max(0, len(newHistory)-numHistoryStepsToKeep)
-	model.undoHistory = newHistory[subsliceStartIdx:]
+// ScrollBy scrolls the view down by the number of rows (or up, if it's negative), moving the cursor if it would
+// otherwise be out of view
+func (model *Model) ScrollBy(numRows int) {
+	model.area.ScrollOff = model.Settings.ScrollOff
+	model.area.ScrollBy(numRows)
+	if !model.mode.isInsertOrReplace() {
+		model.bindCursorToLine()
+	}
+}
 
-	// We reset the steps-rewound because we've now thrown away the steps the user rewound past
-	model.historyPointer = len(model.undoHistory) - 1
+// TODO this is a nasty hack, that I'm exposing purely to allow for tab completion in the app that needs this
+// TODO the ideal would be some standard way to programmatically manipulate the Vim buffer
+// The replacement is an undo step of its own, unless it's part of an edit (see BeginEdit).
+func (model *Model) ReplaceLine(newContents string) {
+	model.makeProgrammaticEdit(func() {
+		model.area.ClearLine()
+		model.area.InsertString(newContents)
+	})
 }
 
 // ====================================================================================================
@@ -391,10 +468,125 @@ func (model *Model) CheckpointHistory() {
 //	Private Helper Functions
 //
 // ====================================================================================================
+// Keeps track of the text typed in insert mode, for the "." register
+func (model *Model) recordInsertedText(msg tea.KeyMsg) {
+	switch msg.Type {
+	case tea.KeyRunes, tea.KeySpace:
+		model.insertedText = append(model.insertedText, msg.Runes...)
+	case tea.KeyEnter:
+		model.insertedText = append(model.insertedText, '\n')
+	case tea.KeyTab:
+		model.insertedText = append(model.insertedText, '\t')
+	case tea.KeyBackspace:
+		if len(model.insertedText) > 0 {
+			model.insertedText = model.insertedText[:len(model.insertedText)-1]
+		}
+	}
+}
+
+func (model *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
+	if model.pendingSubstitution != nil {
+		model.handleSubstitutionConfirmationKey(msg)
+		return nil
+	}
+	if model.commandLine != nil {
+		model.handleCommandLineKey(msg)
+		return nil
+	}
+
+	switch model.mode {
+	case InsertMode, ReplaceMode:
+		if msg.String() == "esc" {
+			model.mode = NormalMode
+			model.lastInsertedText = string(model.insertedText)
+			model.insertedText = nil
+			model.replacedChars = nil
+			model.isAwaitingInsertModeUndoKey = false
+			model.shouldKeepUndoStepOnNextMove = false
+			model.finishBlockInsert()
+			if model.changeBeingRecorded != nil {
+				model.changeBeingRecorded.keys = append(model.changeBeingRecorded.keys, msg)
+				model.finishRecordingChange()
+			}
+			model.area.MoveCursorLeftOneRune()
+
+			model.CheckpointHistory()
+			return nil
+		}
+		if model.handleInsertModeUndoKey(msg) {
+			return nil
+		}
+		model.recordInsertedText(msg)
+		if model.changeBeingRecorded != nil {
+			model.changeBeingRecorded.keys = append(model.changeBeingRecorded.keys, msg)
+		}
+		if model.mode == ReplaceMode {
+			return model.handleReplaceModeKey(msg)
+		}
+		return model.area.Update(msg)
+	case NormalMode:
+		model.handleNormalModeKey(msg)
+	case VisualMode, VisualLineMode, VisualBlockMode:
+		model.handleVisualModeKey(msg)
+	}
+	return nil
+}
+
+// Queues up keys to be handled as though they'd been typed, ahead of any keys that are already queued
+func (model *Model) replayKeys(keys []tea.KeyMsg) {
+	model.keysToReplay = append(append([]tea.KeyMsg{}, keys...), model.keysToReplay...)
+}
+
+// Commands that replay keys (like ".") queue them up rather than running them directly, so that they all get handled
+// here before the next render
+func (model *Model) handleReplayedKeys() {
+	for len(model.keysToReplay) > 0 {
+		key := model.keysToReplay[0]
+		model.keysToReplay = model.keysToReplay[1:]
+		model.queuedCmds = append(model.queuedCmds, model.handleKey(key))
+	}
+}
+
+// Handles the keys (and any keys they cause to be replayed) right away, rather than queueing them up, leaving any keys
+// that were already queued where they were
+func (model *Model) handleKeysNow(keys []tea.KeyMsg) {
+	outerKeysToReplay := model.keysToReplay
+	model.keysToReplay = nil
+	for _, key := range keys {
+		model.queuedCmds = append(model.queuedCmds, model.handleKey(key))
+		model.handleReplayedKeys()
+	}
+	model.keysToReplay = outerKeysToReplay
+}
+
+// Backs out of whatever was left half-done by a run of keys (like Vim does at the end of ":normal"), leaving the model
+// in normal mode
+func (model *Model) finishPendingInput() {
+	model.nGraphBuffer = nil
+	if model.pendingSubstitution != nil {
+		model.stopConfirmingSubstitution()
+	}
+	if model.commandLine != nil {
+		model.closeCommandLine(false)
+	}
+	switch model.mode {
+	case InsertMode, ReplaceMode:
+		model.handleKey(tea.KeyMsg{Type: tea.KeyEsc})
+	case VisualMode, VisualLineMode, VisualBlockMode:
+		model.exitVisualMode()
+	}
+}
+
 func (model Model) renderStatusBar() string {
 	if !model.isFocused {
 		return strings.Repeat(" ", model.width)
 	}
+	if model.pendingSubstitution != nil {
+		return model.renderSubstitutionPrompt()
+	}
+	if model.commandLine != nil {
+		return model.renderCommandLine()
+	}
 
 	// First calculate the ngraph panel size, leaving room for at least one char of mode panel
 	// This means the digraph panel will be the first to get space when the window expands, up to its limit
@@ -404,16 +596,38 @@ func (model Model) renderStatusBar() string {
 	// This means the mode placard will get extra space second
 	modePlacardSize := clamp(model.width-ngraphPanelSize, minModePlacardCharacters, maxModePlacardCharacters+2*desiredModePlacardPadding)
 
-	// Finally, pad any extra space
+	// Finally, pad any extra space, which is where messages and the macro recording indicator go
 	numPads := max(0, model.width-modePlacardSize-ngraphPanelSize)
 	padStr := strings.Repeat(" ", numPads)
+	var message string
+	switch {
+	case model.statusMessage != "":
+		message = " " + model.statusMessage
+	case model.macroRegister != 0:
+		message = " recording @" + string(model.macroRegister)
+	}
+	if message != "" {
+		messageRunes := []rune(message)
+		if len(messageRunes) > numPads {
+			messageRunes = messageRunes[:numPads]
+		}
+		padStr = string(messageRunes) + strings.Repeat(" ", numPads-len(messageRunes))
+	}
 
 	var modePlacardStyle lipgloss.Style
 	switch model.mode {
 	case InsertMode:
 		modePlacardStyle = model.InsertModePlacardStyle
+	case ReplaceMode:
+		modePlacardStyle = model.ReplaceModePlacardStyle
 	case NormalMode:
 		modePlacardStyle = model.NormalModePlacardStyle
+	case VisualMode:
+		modePlacardStyle = model.VisualModePlacardStyle
+	case VisualLineMode:
+		modePlacardStyle = model.VisualLineModePlacardStyle
+	case VisualBlockMode:
+		modePlacardStyle = model.VisualBlockModePlacardStyle
 	default:
 		modePlacardStyle = unknownModePlacardStyle
 	}
@@ -421,11 +635,24 @@ func (model Model) renderStatusBar() string {
 	modePlacardStr = modePlacardStyle.Render(modePlacardStr)
 
 	// TODO get rid of magic consts
-	ngraphPanelStr := coerceToWidth(model.nGraphBuffer, ngraphPanelSize, false)
+	ngraphPanelStr := coerceToWidth(renderKeys(model.nGraphBuffer), ngraphPanelSize, false)
 
 	return modePlacardStr + padStr + ngraphPanelStr
 }
 
+// Renders keypresses the way Vim displays them (e.g. "ctrl+v" becomes "^V")
+func renderKeys(keys []string) string {
+	resultBuilder := strings.Builder{}
+	for _, key := range keys {
+		if strings.HasPrefix(key, "ctrl+") {
+			resultBuilder.WriteString("^" + strings.ToUpper(strings.TrimPrefix(key, "ctrl+")))
+			continue
+		}
+		resultBuilder.WriteString(key)
+	}
+	return resultBuilder.String()
+}
+
 // Takes the given string, centers it, truncating as needed, and adds padds if the desired size is bigger than
 // the string itself
 // If shouldTruncateWithFirstChars is set, truncating of the string will use the first N characters; if not, the last N
@@ -464,3 +691,10 @@ func max(a, b int) int {
 	}
 	return b
 }
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,63 @@
+package vim
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// A test of what sending keys to a model holding some text does to the text and the cursor
+type keysTest struct {
+	value string
+	row   int
+	col   int
+
+	// Written in Vim's key notation (e.g. "ciwfoo<Esc>")
+	keys string
+
+	wantValue string
+	// A wantRow of -1 means the cursor isn't checked
+	wantRow int
+	wantCol int
+}
+
+// Makes a focused model holding the text, with the cursor at the start of it
+func newTestModel(value string) *Model {
+	model := New()
+	model.Focus()
+	model.Resize(80, 20)
+	model.SetValue(value)
+	model.area.SetCursorPosition(textarea.Position{Row: 0, Col: 0})
+	return &model
+}
+
+// Sends the keys, written in Vim's key notation, to the model one at a time, returning the command from the last one
+func sendKeys(model *Model, keys string) tea.Cmd {
+	var cmd tea.Cmd
+	for _, key := range parseKeyNotation(keys) {
+		cmd = model.Update(key)
+	}
+	return cmd
+}
+
+func runKeysTests(t *testing.T, tests []keysTest) {
+	t.Helper()
+	for _, test := range tests {
+		model := newTestModel(test.value)
+		model.area.SetCursorPosition(textarea.Position{Row: test.row, Col: test.col})
+		sendKeys(model, test.keys)
+
+		gotValue := model.GetValue()
+		gotCursor := model.area.GetCursorPosition()
+		isCursorWrong := test.wantRow >= 0 && gotCursor != textarea.Position{Row: test.wantRow, Col: test.wantCol}
+		if gotValue != test.wantValue || isCursorWrong {
+			t.Errorf(
+				"%q at %d,%d after %q: got %q at %d,%d, want %q at %d,%d",
+				test.value, test.row, test.col, test.keys,
+				gotValue, gotCursor.Row, gotCursor.Col,
+				test.wantValue, test.wantRow, test.wantCol,
+			)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package vim
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+// A selection made in visual mode, remembered so that "gv" can reselect it
+type visualSelection struct {
+	// Empty if there hasn't been a selection yet
+	mode Mode
+
+	anchor textarea.Position
+	cursor textarea.Position
+}
+
+// The text typed on the first row of a visual block change, which gets copied to the other rows of the block when
+// insert mode ends
+type blockInsert struct {
+	startRow int
+	endRow   int
+	col      int
+
+	// Used to figure out how much text was typed
+	originalLineLength int
+	originalNumRows    int
+}
+
+// An operator as it's applied to the selection in visual mode
+type visualOperator struct {
+	operator operator
+
+	// Forces the operator to act on whole lines, regardless of the visual mode (e.g. "D" or "Y")
+	isLinewise bool
+}
+
+var visualOperators = map[string]visualOperator{
+	"d":      {operator: operators["d"]},
+	"x":      {operator: operators["d"]},
+	"delete": {operator: operators["d"]},
+	"X":      {operator: operators["d"], isLinewise: true},
+	"D":      {operator: operators["d"], isLinewise: true},
+	"c":      {operator: operators["c"]},
+	"s":      {operator: operators["c"]},
+	"S":      {operator: operators["c"], isLinewise: true},
+	"R":      {operator: operators["c"], isLinewise: true},
+	"C":      {operator: operators["c"], isLinewise: true},
+	"y":      {operator: operators["y"]},
+	"Y":      {operator: operators["y"], isLinewise: true},
+	">":      {operator: operators[">"]},
+	"<":      {operator: operators["<"]},
+	"~":      {operator: operators["g~"]},
+	"g~":     {operator: operators["g~"]},
+	"u":      {operator: operators["gu"]},
+	"gu":     {operator: operators["gu"]},
+	"U":      {operator: operators["gU"]},
+	"gU":     {operator: operators["gU"]},
+	"=":      {operator: operators["="]},
+	"J":      {operator: joinOperator},
+	"gJ":     {operator: joinWithoutSpacesOperator},
+}
+
+var visualActions = map[string]action{
+	"esc":    {isChange: false, execute: exitVisualModeAction},
+	"v":      {isChange: false, execute: switchVisualMode},
+	"V":      {isChange: false, execute: switchVisualMode},
+	"ctrl+v": {isChange: false, execute: switchVisualMode},
+	"o":      {isChange: false, execute: swapSelectionEnds},
+	"gv":     {isChange: false, execute: swapWithLastSelection},
+	":":      {isChange: false, execute: openExCommandLineForSelection},
+	"zt":     {isChange: false, execute: scrollCursorRow},
+	"zz":     {isChange: false, execute: scrollCursorRow},
+	"zb":     {isChange: false, execute: scrollCursorRow},
+	"ctrl+e": {isChange: false, execute: scrollByRows},
+	"ctrl+y": {isChange: false, execute: scrollByRows},
+	"ctrl+d": {isChange: false, execute: scrollHalfPage},
+	"ctrl+u": {isChange: false, execute: scrollHalfPage},
+	"ctrl+f": {isChange: false, execute: scrollPage},
+	"ctrl+b": {isChange: false, execute: scrollPage},
+	"pgdown": {isChange: false, execute: scrollPage},
+	"pgup":   {isChange: false, execute: scrollPage},
+}
+
+// The key that enters each of the visual modes
+var visualModeKeys = map[string]Mode{
+	"v":      VisualMode,
+	"V":      VisualLineMode,
+	"ctrl+v": VisualBlockMode,
+}
+
+// Handles a keypress in one of the visual modes, in much the same way as normal mode except that operators get
+// applied to the selection immediately
+func (model *Model) handleVisualModeKey(msg tea.KeyMsg) {
+	if len(model.nGraphBuffer) == 0 {
+		model.rememberCursorBeforeChange()
+	}
+	model.nGraphBuffer = append(model.nGraphBuffer, msg.String())
+
+	if model.isStopRecordingKey() {
+		model.stopRecordingMacro()
+		return
+	}
+
+	cmd, result := parseVisualCommand(model.nGraphBuffer)
+	switch result {
+	case parseResult_Incomplete:
+		return
+	case parseResult_Invalid:
+		model.nGraphBuffer = nil
+		model.abortReplay()
+		return
+	}
+	model.nGraphBuffer = nil
+
+	model.runVisualCommand(cmd)
+}
+
+// Runs the given visual mode command, along with everything that has to happen after a command
+func (model *Model) runVisualCommand(cmd normalCommand) {
+	if cmd.isAwaitingSearchPattern() {
+		model.openSearchCommandLine(cmd, (*Model).runVisualCommand)
+		return
+	}
+
+	// Repeating a visual mode change with "." acts on the same amount of text, so we have to capture the size of the
+	// selection before the change gets rid of it
+	var repeatKeyNames []string
+	if _, found := visualOperators[cmd.action]; found {
+		repeatKeyNames = model.getSelectionKeyNames()
+		if cmd.register != 0 {
+			repeatKeyNames = append(repeatKeyNames, `"`, string(cmd.register))
+		}
+		repeatKeyNames = append(repeatKeyNames, splitKeyName(cmd.action)...)
+	}
+
+	isChange := model.executeVisualCommand(cmd)
+	if repeatKeyNames != nil && (isChange || model.mode.isInsertOrReplace()) {
+		model.recordChange(repeatableChange{keys: getKeyMsgs(repeatKeyNames)})
+	}
+
+	if model.mode != NormalMode {
+		return
+	}
+	model.bindCursorToLine()
+	if isChange {
+		model.CheckpointHistory()
+	}
+}
+
+// Runs the given visual mode command, returning whether it modified the buffer
+func (model *Model) executeVisualCommand(cmd normalCommand) bool {
+	cmd, canExecute := model.resolveCharacterFindRepeat(cmd)
+	if !canExecute {
+		return false
+	}
+
+	if cmd.motion != "" {
+		if !model.moveByMotion(cmd) {
+			model.abortReplay()
+		}
+		return false
+	}
+
+	if cmd.textObject != "" {
+		if !model.selectTextObjectInVisualMode(cmd) {
+			model.abortReplay()
+		}
+		return false
+	}
+
+	if visualOperatorDef, found := visualOperators[cmd.action]; found {
+		if isReadOnlyRegister(cmd.register) {
+			return false
+		}
+
+		rng := model.getSelectionRange()
+		if visualOperatorDef.isLinewise {
+			rng.kind = rangeKind_Linewise
+		}
+
+		model.exitVisualMode()
+		visualOperatorDef.operator.apply(model, cmd, rng)
+		return visualOperatorDef.operator.isChange
+	}
+
+	actionDef := visualActions[cmd.action]
+	actionDef.execute(model, cmd)
+	return actionDef.isChange
+}
+
+// Parses the keys typed so far in visual mode
+func parseVisualCommand(keys []string) (normalCommand, parseResult) {
+	cmd, numPrefixKeys, result := parseCommandPrefix(keys)
+	if result != parseResult_Complete {
+		return cmd, result
+	}
+	keys = keys[numPrefixKeys:]
+
+	var candidateNames []string
+	for name := range motions {
+		candidateNames = append(candidateNames, name)
+	}
+	for name := range visualOperators {
+		candidateNames = append(candidateNames, name)
+	}
+	for name := range visualActions {
+		candidateNames = append(candidateNames, name)
+	}
+	for name := range textObjects {
+		candidateNames = append(candidateNames, name)
+	}
+
+	name, numKeysConsumed, result := matchCommandName(keys, candidateNames)
+	if result != parseResult_Complete {
+		return cmd, result
+	}
+
+	if _, found := textObjects[name]; found {
+		cmd.textObject = name
+		return cmd, parseResult_Complete
+	}
+
+	if motionDef, found := motions[name]; found {
+		cmd.motion = name
+		if motionDef.takesArgument {
+			return parseArgument(cmd, keys[numKeysConsumed:])
+		}
+		return cmd, parseResult_Complete
+	}
+
+	cmd.action = name
+	return cmd, parseResult_Complete
+}
+
+func (model *Model) enterVisualMode(mode Mode, anchor textarea.Position) {
+	model.mode = mode
+	model.visualAnchor = anchor
+	model.area.SetSelection(getSelectionMode(mode), anchor)
+}
+
+func (model *Model) exitVisualMode() {
+	model.lastVisualSelection = visualSelection{
+		mode:   model.mode,
+		anchor: model.visualAnchor,
+		cursor: model.area.GetCursorPosition(),
+	}
+	start, end := model.visualAnchor, model.area.GetCursorPosition()
+	if end.IsBefore(start) {
+		start, end = end, start
+	}
+	model.setMark('<', start)
+	model.setMark('>', end)
+	model.area.ClearSelection()
+	model.mode = NormalMode
+}
+
+// Gets the range of text covered by the current visual mode selection
+func (model *Model) getSelectionRange() textRange {
+	start, end := model.visualAnchor, model.area.GetCursorPosition()
+	if end.IsBefore(start) {
+		start, end = end, start
+	}
+
+	switch model.mode {
+	case VisualLineMode:
+		return textRange{start: start, end: end, kind: rangeKind_Linewise}
+	case VisualBlockMode:
+		leftCol := min(model.visualAnchor.Col, model.area.GetCursorColumn())
+		rightCol := max(model.visualAnchor.Col, model.area.GetCursorColumn())
+		return textRange{
+			start: textarea.Position{Row: start.Row, Col: leftCol},
+			end:   textarea.Position{Row: end.Row, Col: rightCol + 1},
+			kind:  rangeKind_Blockwise,
+		}
+	}
+
+	// The selection includes the character under the cursor, which is the newline if we're past the end of the line
+	if end.Col >= model.area.GetLineLength(end.Row) && end.Row < model.area.GetNumRows()-1 {
+		end = textarea.Position{Row: end.Row + 1, Col: 0}
+	} else {
+		end.Col = min(end.Col+1, model.area.GetLineLength(end.Row))
+	}
+	return textRange{start: start, end: end, kind: rangeKind_Characterwise}
+}
+
+// Copies the text typed on the first row of a visual block change to the rest of the block's rows
+func (model *Model) finishBlockInsert() {
+	pending := model.pendingBlockInsert
+	model.pendingBlockInsert = nil
+	if pending == nil {
+		return
+	}
+
+	// If the user typed a newline or moved somewhere else, there's no sensible way to copy what they typed
+	numInsertedRunes := model.area.GetLineLength(pending.startRow) - pending.originalLineLength
+	if numInsertedRunes <= 0 || model.area.GetNumRows() != pending.originalNumRows {
+		return
+	}
+	insertedText := string(model.area.GetLine(pending.startRow)[pending.col : pending.col+numInsertedRunes])
+
+	cursorPos := model.area.GetCursorPosition()
+	for row := pending.startRow + 1; row <= pending.endRow; row++ {
+		// Like Vim, rows too short to reach the block are left alone
+		if model.area.GetLineLength(row) < pending.col {
+			continue
+		}
+		insertPos := textarea.Position{Row: row, Col: pending.col}
+		model.area.ReplaceRange(insertPos, insertPos, insertedText)
+	}
+	model.area.SetCursorPosition(cursorPos)
+}
+
+func getSelectionMode(mode Mode) textarea.SelectionMode {
+	switch mode {
+	case VisualMode:
+		return textarea.SelectionMode_Characterwise
+	case VisualLineMode:
+		return textarea.SelectionMode_Linewise
+	case VisualBlockMode:
+		return textarea.SelectionMode_Blockwise
+	}
+	return textarea.SelectionMode_None
+}
+
+// ====================================================================================================
+//
+//	Action Implementations
+//
+// ====================================================================================================
+func enterVisualModeAction(model *Model, cmd normalCommand) {
+	model.enterVisualMode(visualModeKeys[cmd.action], model.area.GetCursorPosition())
+}
+
+func reselectLastSelection(model *Model, cmd normalCommand) {
+	lastSelection := model.lastVisualSelection
+	if lastSelection.mode == "" {
+		return
+	}
+	model.area.SetCursorPosition(lastSelection.cursor)
+	model.enterVisualMode(lastSelection.mode, lastSelection.anchor)
+}
+
+func exitVisualModeAction(model *Model, cmd normalCommand) {
+	model.exitVisualMode()
+}
+
+// Pressing the key for the current visual mode leaves visual mode, while pressing the key for another one switches
+// to it (keeping the selection)
+func switchVisualMode(model *Model, cmd normalCommand) {
+	newMode := visualModeKeys[cmd.action]
+	if newMode == model.mode {
+		model.exitVisualMode()
+		return
+	}
+	model.enterVisualMode(newMode, model.visualAnchor)
+}
+
+func swapSelectionEnds(model *Model, cmd normalCommand) {
+	cursorPos := model.area.GetCursorPosition()
+	model.area.SetCursorPosition(model.visualAnchor)
+	model.enterVisualMode(model.mode, cursorPos)
+}
+
+func swapWithLastSelection(model *Model, cmd normalCommand) {
+	lastSelection := model.lastVisualSelection
+	if lastSelection.mode == "" {
+		return
+	}
+
+	// Exiting visual mode records the current selection as the last one, so we grab the last one beforehand
+	model.exitVisualMode()
+	model.area.SetCursorPosition(lastSelection.cursor)
+	model.enterVisualMode(lastSelection.mode, lastSelection.anchor)
+}
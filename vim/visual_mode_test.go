@@ -0,0 +1,35 @@
+package vim
+
+import "testing"
+
+func TestVisualMode(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"one two three", 0, 0, "vwd", "wo three", 0, 0},
+		{"abcdef", 0, 1, "vllohd", "ef", 0, 0},
+		{"abc\ndef", 0, 1, "vjyP", "abc\ndebc\ndef", 0, 1},
+		{"abc", 0, 0, "v~", "Abc", 0, 0},
+		{"abc", 0, 0, "vl>", "    abc", 0, 4},
+		{"abc\ndef", 0, 0, "vlYjp", "abc\ndef\nabc", 2, 0},
+
+		// Pressing the key of the current visual mode leaves it, and the other keys switch to their mode
+		{"abc", 0, 0, "vvd", "abc", 0, 0},
+		{"abc\ndef", 0, 0, "vjVd", "", 0, 0},
+
+		{"abc\ndef", 0, 0, "vl<Esc>jgvd", "c\ndef", 0, 0},
+	})
+}
+
+func TestLinewiseVisualMode(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"a\nb\nc", 0, 0, "Vjd", "c", 0, 0},
+		{"abc\ndef", 0, 0, "VjU", "ABC\nDEF", 0, 0},
+		{"a\n  b\nc", 0, 0, "VjJ", "a b\nc", 0, 1},
+	})
+}
+
+func TestBlockwiseVisualMode(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"abc\ndef\nghi", 0, 0, "<C-v>jld", "c\nf\nghi", 0, 0},
+		{"abc\ndef\nghi", 0, 1, "<C-v>jjcX<Esc>", "aXc\ndXf\ngXi", 0, 1},
+	})
+}
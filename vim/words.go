@@ -0,0 +1,135 @@
+package vim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The kinds of characters that words are made of, where a word is a run of characters of the same class
+// Whitespace is 0, to match the textarea's character classifiers.
+type charClass int
+
+const (
+	charClass_Whitespace charClass = iota
+	charClass_Punctuation
+	charClass_Keyword
+)
+
+// The characters below 256 that are part of keywords, as given by the "iskeyword" option
+// Characters from 256 up are keywords if they're letters or digits, like in Vim.
+type keywordCharSet [256]bool
+
+// Gets the class of the character for word motions and objects, where WORDs (e.g. "W" or "iW") are made of any
+// non-whitespace characters and words (e.g. "w" or "iw") are made of either keyword characters or other
+// non-whitespace characters
+func (model *Model) getCharClass(char rune, isBigWord bool) charClass {
+	switch {
+	case unicode.IsSpace(char):
+		return charClass_Whitespace
+	case isBigWord || model.isKeywordRune(char):
+		return charClass_Keyword
+	}
+	return charClass_Punctuation
+}
+
+// Gets the function the textarea uses to find word boundaries
+func (model *Model) getWordClassifier(isBigWord bool) func(char rune) int {
+	return func(char rune) int {
+		return int(model.getCharClass(char, isBigWord))
+	}
+}
+
+func (model *Model) isKeywordRune(char rune) bool {
+	if int(char) >= len(model.keywordChars) {
+		return char == '_' || unicode.IsLetter(char) || unicode.IsDigit(char)
+	}
+
+	// The option gets parsed again whenever it changes, since the host can change the settings directly
+	if model.keywordCharsSpec != model.Settings.IsKeyword {
+		if keywordChars, err := parseKeywordChars(model.Settings.IsKeyword); err == nil {
+			model.keywordChars = keywordChars
+		}
+		model.keywordCharsSpec = model.Settings.IsKeyword
+	}
+	return model.keywordChars[char]
+}
+
+// Parses a value of the "iskeyword" option, which is a comma-separated list of parts, where each part is one of:
+//   - a single character (e.g. "_") or character code (e.g. "95")
+//   - a range of characters (e.g. "a-z") or character codes (e.g. "48-57")
+//   - "@", meaning all letters (and "@-@", meaning the "@" character)
+//   - any of the above preceded by "^", to exclude the characters instead (where "^" alone means the "^" character)
+func parseKeywordChars(spec string) (keywordCharSet, error) {
+	var result keywordCharSet
+	for _, part := range strings.Split(spec, ",") {
+		if part == "" {
+			continue
+		}
+
+		isExcluded := false
+		if len(part) > 1 && part[0] == '^' {
+			isExcluded = true
+			part = part[1:]
+		}
+
+		if part == "@" {
+			for char := 0; char < len(result); char++ {
+				if unicode.IsLetter(rune(char)) {
+					result[char] = !isExcluded
+				}
+			}
+			continue
+		}
+
+		first, rest, err := parseKeywordCharBound(part)
+		if err != nil {
+			return keywordCharSet{}, err
+		}
+		last := first
+		if rest != "" {
+			if rest[0] != '-' {
+				return keywordCharSet{}, fmt.Errorf("E474: Invalid argument: %s", part)
+			}
+			if last, rest, err = parseKeywordCharBound(rest[1:]); err != nil {
+				return keywordCharSet{}, err
+			}
+			if rest != "" || last < first {
+				return keywordCharSet{}, fmt.Errorf("E474: Invalid argument: %s", part)
+			}
+		}
+		for char := first; char <= last; char++ {
+			result[char] = !isExcluded
+		}
+	}
+	return result, nil
+}
+
+func validateKeywordChars(spec string) error {
+	_, err := parseKeywordChars(spec)
+	return err
+}
+
+// Parses a character code or a single character at the start of a part of the "iskeyword" option, returning the
+// character and the rest of the part
+func parseKeywordCharBound(part string) (int, string, error) {
+	numDigits := 0
+	for numDigits < len(part) && part[numDigits] >= '0' && part[numDigits] <= '9' {
+		numDigits++
+	}
+	if numDigits > 0 {
+		code, err := strconv.Atoi(part[:numDigits])
+		if err != nil || code >= len(keywordCharSet{}) {
+			return 0, "", fmt.Errorf("E474: Invalid argument: %s", part)
+		}
+		return code, part[numDigits:], nil
+	}
+
+	char, size := utf8.DecodeRuneInString(part)
+	if char == utf8.RuneError || int(char) >= len(keywordCharSet{}) {
+		return 0, "", fmt.Errorf("E474: Invalid argument: %s", part)
+	}
+	return int(char), part[size:], nil
+}
@@ -0,0 +1,71 @@
+package vim
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mieubrisse/vim-bubble/textarea"
+)
+
+func TestWordAndWORDMotions(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"foo.bar baz", 0, 0, "w", "foo.bar baz", 0, 3},
+		{"foo.bar baz", 0, 0, "ww", "foo.bar baz", 0, 4},
+		{"foo.bar baz", 0, 0, "W", "foo.bar baz", 0, 8},
+		{"foo.bar baz", 0, 0, "e", "foo.bar baz", 0, 2},
+		{"foo.bar baz", 0, 0, "E", "foo.bar baz", 0, 6},
+		{"foo.bar baz", 0, 8, "b", "foo.bar baz", 0, 4},
+		{"foo.bar baz", 0, 8, "B", "foo.bar baz", 0, 0},
+		{"foo.bar baz", 0, 8, "ge", "foo.bar baz", 0, 6},
+		{"foo.bar baz", 0, 6, "ge", "foo.bar baz", 0, 3},
+		{"foo.bar baz", 0, 6, "gE", "foo.bar baz", 0, 0},
+		{"foo.bar baz", 0, 8, "gE", "foo.bar baz", 0, 6},
+		{"a,,b", 0, 0, "w", "a,,b", 0, 1},
+		{"ab\n.c", 0, 0, "w", "ab\n.c", 1, 0},
+		{"foo.bar baz", 0, 0, "dw", ".bar baz", 0, 0},
+		{"foo.bar baz", 0, 0, "dW", "baz", 0, 0},
+
+		// "cw" and "cW" act like "ce" and "cE"
+		{"foo.bar baz", 0, 0, "cwx<Esc>", "x.bar baz", 0, 0},
+		{"foo.bar baz", 0, 0, "cWx<Esc>", "x baz", 0, 0},
+		{"a.b", 0, 0, "cwx<Esc>", "x.b", 0, 0},
+	})
+}
+
+func TestIsKeyword(t *testing.T) {
+	runKeysTests(t, []keysTest{
+		{"foo-bar baz", 0, 0, ":set isk+=-<CR>dw", "baz", 0, 0},
+		{"foo-bar baz", 0, 0, ":set isk+=-<CR>diw", " baz", 0, 0},
+	})
+
+	// The host can change the setting directly too
+	model := newTestModel("foo-bar baz")
+	model.Settings.IsKeyword = "a-z,-"
+	sendKeys(model, "dw")
+	if value := model.GetValue(); value != "baz" {
+		t.Errorf("got %q after dw with \"-\" as a keyword character", value)
+	}
+
+	model = newTestModel("foo-bar foo-bar")
+	model.Settings.IsKeyword = "^a-z,@,-"
+	sendKeys(model, "*")
+	if cursor := model.area.GetCursorPosition(); cursor != (textarea.Position{Row: 0, Col: 8}) {
+		t.Errorf("got the cursor at %v after * with \"-\" as a keyword character", cursor)
+	}
+}
+
+func TestSetIsKeyword(t *testing.T) {
+	model := newTestModel("x")
+	sendKeys(model, ":set isk=zz-a<CR>")
+	if !strings.Contains(model.statusMessage, "E474") {
+		t.Errorf("got status message %q for an invalid value, want E474", model.statusMessage)
+	}
+	if model.Settings.IsKeyword != DefaultSettings().IsKeyword {
+		t.Errorf("got %q after setting an invalid value, want it unchanged", model.Settings.IsKeyword)
+	}
+
+	sendKeys(model, ":set isk?<CR>")
+	if model.statusMessage != "iskeyword=@,48-57,_,192-255" {
+		t.Errorf("got status message %q", model.statusMessage)
+	}
+}